@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// AccessLogSpec configures the access log of the REST gateway and Connect
+// listeners. Sync renders it into the generated accesslog_gen.go, which logs
+// one wool entry per request with its trace ID.
+//
+// A JSON request body is logged only when it fits in BodyLimit bytes; the
+// values of fields marked [debug_redact = true] in the proto, and of the
+// RedactFields names, are replaced before it is written. Headers are never
+// logged.
+type AccessLogSpec struct {
+	// BodyLimit is how many bytes of a request body are captured while the
+	// handler reads it. 0 keeps the default of 4096; -1 logs no bodies.
+	BodyLimit int `yaml:"body-limit,omitempty"`
+	// SampleRate is the fraction of successful requests logged, between 0
+	// and 1. Unset logs all of them; failed requests are always logged.
+	SampleRate *float64 `yaml:"sample-rate,omitempty"`
+	// RedactFields names JSON fields redacted in every body, in addition to
+	// the debug_redact ones.
+	RedactFields []string `yaml:"redact-fields,omitempty"`
+}
+
+// accessLogPolicy is the effective access log the accesslog_gen.go template
+// renders. BodyLimit is 0 when bodies are not logged.
+type accessLogPolicy struct {
+	BodyLimit    int
+	SampleRate   float64
+	RedactFields []string
+}
+
+const (
+	defaultAccessLogBodyLimit = 4096
+	maxAccessLogBodyLimit     = 1 << 20
+)
+
+// AccessLogPolicy is the declared access log with the defaults applied.
+func (s *Settings) AccessLogPolicy() accessLogPolicy {
+	policy := accessLogPolicy{BodyLimit: defaultAccessLogBodyLimit, SampleRate: 1}
+	if s.AccessLog == nil {
+		return policy
+	}
+	switch {
+	case s.AccessLog.BodyLimit < 0:
+		policy.BodyLimit = 0
+	case s.AccessLog.BodyLimit > 0:
+		policy.BodyLimit = s.AccessLog.BodyLimit
+	}
+	if s.AccessLog.SampleRate != nil {
+		policy.SampleRate = *s.AccessLog.SampleRate
+	}
+	policy.RedactFields = s.AccessLog.RedactFields
+	return policy
+}
+
+// jsonFieldName matches a proto field name or its lowerCamelCase JSON name.
+var jsonFieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate rejects an access-log block that would buffer without bound or
+// sample outside [0, 1].
+func (a *AccessLogSpec) Validate() error {
+	if a == nil {
+		return nil
+	}
+	if a.BodyLimit < -1 || a.BodyLimit > maxAccessLogBodyLimit {
+		return fmt.Errorf("access-log body-limit must be -1 or between 0 and %d bytes (got %d)", maxAccessLogBodyLimit, a.BodyLimit)
+	}
+	if a.SampleRate != nil && (*a.SampleRate < 0 || *a.SampleRate > 1) {
+		return fmt.Errorf("access-log sample-rate must be between 0 and 1 (got %v)", *a.SampleRate)
+	}
+	for _, field := range a.RedactFields {
+		if !jsonFieldName.MatchString(field) {
+			return fmt.Errorf("access-log redact-fields entry %q is not a field name", field)
+		}
+	}
+	return nil
+}
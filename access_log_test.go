@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogPolicyBoundsBodiesAndLogsEveryRequestByDefault(t *testing.T) {
+	var settings Settings
+	want := accessLogPolicy{BodyLimit: defaultAccessLogBodyLimit, SampleRate: 1}
+	if got := settings.AccessLogPolicy(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("AccessLogPolicy() = %#v, want %#v", got, want)
+	}
+
+	rate := 0.1
+	settings.AccessLog = &AccessLogSpec{BodyLimit: -1, SampleRate: &rate, RedactFields: []string{"apiKey"}}
+	want = accessLogPolicy{BodyLimit: 0, SampleRate: 0.1, RedactFields: []string{"apiKey"}}
+	if got := settings.AccessLogPolicy(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("AccessLogPolicy() = %#v, want %#v", got, want)
+	}
+
+	settings.AccessLog = &AccessLogSpec{BodyLimit: 512}
+	if got := settings.AccessLogPolicy(); got.BodyLimit != 512 || got.SampleRate != 1 {
+		t.Fatalf("AccessLogPolicy() = %#v, want a 512-byte limit and every request", got)
+	}
+}
+
+func TestAccessLogSpecValidate(t *testing.T) {
+	half, negative, over := 0.5, -0.1, 1.5
+	tests := map[string]struct {
+		spec AccessLogSpec
+		want string
+	}{
+		"defaults":          {AccessLogSpec{}, ""},
+		"no bodies":         {AccessLogSpec{BodyLimit: -1}, ""},
+		"sampled":           {AccessLogSpec{BodyLimit: 1024, SampleRate: &half, RedactFields: []string{"password", "api_key"}}, ""},
+		"negative limit":    {AccessLogSpec{BodyLimit: -2}, "body-limit"},
+		"unbounded limit":   {AccessLogSpec{BodyLimit: maxAccessLogBodyLimit + 1}, "body-limit"},
+		"negative rate":     {AccessLogSpec{SampleRate: &negative}, "sample-rate"},
+		"rate above one":    {AccessLogSpec{SampleRate: &over}, "sample-rate"},
+		"dotted field path": {AccessLogSpec{RedactFields: []string{"user.password"}}, "not a field name"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.spec.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
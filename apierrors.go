@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ErrorsSpec configures how deployments of the generated apierrors package
+// answer internal failures. Deploy redacts their messages in production
+// environments only, so development and staging keep the detail a failing
+// call needs.
+type ErrorsSpec struct {
+	// ProductionEnvironments names the codefly environments whose
+	// deployments redact internal error messages. Unset means "production".
+	ProductionEnvironments []string `yaml:"production-environments,omitempty"`
+}
+
+// defaultProductionEnvironments is the production environment of a service
+// without an errors block.
+var defaultProductionEnvironments = []string{"production"}
+
+// RedactErrors reports whether a deployment to environment replaces the
+// message of internal errors before they reach callers.
+func (s *Settings) RedactErrors(environment string) bool {
+	production := defaultProductionEnvironments
+	if s.Errors != nil && len(s.Errors.ProductionEnvironments) > 0 {
+		production = s.Errors.ProductionEnvironments
+	}
+	return slices.Contains(production, environment)
+}
+
+// Validate rejects a production environment no deployment could match.
+func (e *ErrorsSpec) Validate() error {
+	if e == nil {
+		return nil
+	}
+	for _, environment := range e.ProductionEnvironments {
+		if environment == "" {
+			return fmt.Errorf("errors production-environments must not list an empty environment")
+		}
+	}
+	return nil
+}
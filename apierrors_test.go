@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactErrorsInProductionEnvironmentsOnly(t *testing.T) {
+	tests := map[string]struct {
+		errors      *ErrorsSpec
+		environment string
+		want        bool
+	}{
+		"default production":  {nil, "production", true},
+		"default development": {nil, "development", false},
+		"declared production": {&ErrorsSpec{ProductionEnvironments: []string{"prod-eu", "prod-us"}}, "prod-us", true},
+		"undeclared default":  {&ErrorsSpec{ProductionEnvironments: []string{"prod-eu"}}, "production", false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings := Settings{Errors: test.errors}
+			if got := settings.RedactErrors(test.environment); got != test.want {
+				t.Fatalf("RedactErrors(%q) = %v, want %v", test.environment, got, test.want)
+			}
+		})
+	}
+}
+
+func TestErrorsSpecValidate(t *testing.T) {
+	if err := (&ErrorsSpec{ProductionEnvironments: []string{"production"}}).Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	err := (&ErrorsSpec{ProductionEnvironments: []string{"production", ""}}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "empty environment") {
+		t.Fatalf("Validate() error = %v, want an empty environment rejected", err)
+	}
+}
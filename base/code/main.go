@@ -22,9 +22,11 @@ func doWork(ctx context.Context) (Clean, error) {
 import (
 	"codefly-base/pkg/adapters"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/codefly-dev/core/shared"
 	"github.com/codefly-dev/core/standards"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -58,12 +60,22 @@ func WithConfigure(c Configure) {
 }
 
 func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run serves until SIGINT or SIGTERM and returns once the server has shut
+// down, or with the error that stopped it; main exits non-zero on the latter
+// after the clean hooks have run.
+func run() error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	provider, err := codefly.Init(ctx)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	ctx = provider.Inject(ctx)
 
@@ -81,7 +93,7 @@ func main() {
 	if configure != nil {
 		clean, err := configure(ctx, config)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		defer func() {
 			if clean != nil {
@@ -89,23 +101,31 @@ func main() {
 			}
 		}()
 	}
-
+	// `migrate status|up` runs plugin migrations against the database the
+	// Configure hook provided and exits without serving.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return migrate(ctx, config, os.Args[2:])
+	}
+	// Pending plugin migrations run before any listener accepts traffic; a
+	// drifted checksum of an already-applied file aborts startup.
+	if _, err := adapters.Migrate(ctx, config); err != nil {
+		return err
+	}
 	server, err := adapters.NewServer(config)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
+	serving := make(chan error, 1)
 	go func() {
-		err = server.Start(ctx)
-		if err != nil {
-			panic(err)
-		}
+		serving <- server.Start(ctx)
 	}()
 
 	if work != nil {
 		clean, err := work(ctx)
 		if err != nil {
-			panic(err)
+			server.Stop()
+			return errors.Join(err, <-serving)
 		}
 		defer func() {
 			if clean == nil {
@@ -115,8 +135,34 @@ func main() {
 		}()
 	}
 
-	<-ctx.Done()
-	server.Stop()
-	fmt.Println("got interruption signal")
+	return <-serving
+}
 
+func migrate(ctx context.Context, config *adapters.Configuration, args []string) error {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		return fmt.Errorf("usage: migrate status|up")
+	}
+	if args[0] == "up" {
+		ran, err := adapters.Migrate(ctx, config)
+		for _, migration := range ran {
+			fmt.Printf("applied %s/%s\n", migration.Plugin, migration.Version)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) applied\n", len(ran))
+		return nil
+	}
+	statuses, err := adapters.MigrationStatuses(ctx, config)
+	if err != nil {
+		return err
+	}
+	for _, migration := range statuses {
+		state := "pending"
+		if migration.Applied {
+			state = "applied"
+		}
+		fmt.Printf("%-8s %s/%s %s\n", state, migration.Plugin, migration.Version, migration.Checksum)
+	}
+	return nil
 }
@@ -0,0 +1,227 @@
+package adapters
+
+/* -----------------------------------------------------------------
+
+⚠️ This code is generated by the agent. Do not edit this file!
+
+The REST gateway and Connect listeners log one entry per request through
+wool, with its trace ID. The policy below is rendered from the `access-log`
+block of service.codefly.yaml: a JSON request body is captured up to the
+body limit while the handler reads it, and logged only whole, with the
+values of fields marked [debug_redact = true] (and of redact-fields)
+replaced. Headers are never logged. Successful requests are sampled;
+failed ones are always logged.
+
+----------------------------------------------------------------- */
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codefly-dev/core/wool"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type accessLogPolicy struct {
+	// bodyLimit is how many bytes of a JSON request body are captured; 0
+	// logs no bodies.
+	bodyLimit int
+	// sampleRate is the fraction of successful requests logged.
+	sampleRate   float64
+	redactFields []string
+}
+
+var accessLog = accessLogPolicy{
+	bodyLimit:    4096,
+	sampleRate:   1,
+	redactFields: []string{},
+}
+
+// redactedValue replaces the value of a redacted field in a logged body.
+const redactedValue = "[REDACTED]"
+
+var redactedFields = sync.OnceValue(func() map[string]bool {
+	fields := map[string]bool{}
+	for _, field := range accessLog.redactFields {
+		fields[field] = true
+	}
+	protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		collectRedactedFields(file.Messages(), fields)
+		return true
+	})
+	return fields
+})
+
+// collectRedactedFields adds the proto and JSON names of every field marked
+// debug_redact in messages and the messages nested in them.
+func collectRedactedFields(messages protoreflect.MessageDescriptors, fields map[string]bool) {
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		for j := 0; j < message.Fields().Len(); j++ {
+			field := message.Fields().Get(j)
+			if options, ok := field.Options().(*descriptorpb.FieldOptions); ok && options.GetDebugRedact() {
+				fields[string(field.Name())] = true
+				fields[field.JSONName()] = true
+			}
+		}
+		collectRedactedFields(message.Messages(), fields)
+	}
+}
+
+// AccessLog logs every request next serves on listener.
+func AccessLog(listener string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var body *bodyCapture
+		if accessLog.bodyLimit > 0 && r.Body != nil && isJSON(r.Header.Get("Content-Type")) {
+			body = &bodyCapture{ReadCloser: r.Body, limit: accessLog.bodyLimit}
+			r.Body = body
+		}
+		rec := &accessLogWriter{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		failed := status >= http.StatusBadRequest
+		if !failed && rand.Float64() >= accessLog.sampleRate {
+			return
+		}
+		size := r.ContentLength
+		if body != nil {
+			size = body.size
+		}
+		logger := wool.Get(r.Context()).In("access-log")
+		log := logger.Info
+		if failed {
+			log = logger.Warn
+		}
+		log(r.Method+" "+r.URL.Path,
+			wool.Field("listener", listener),
+			wool.Field("status", status),
+			wool.Field("duration", time.Since(start)),
+			wool.Field("request_bytes", size),
+			wool.Field("response_bytes", rec.size),
+			wool.Field("trace_id", traceID(r)),
+			wool.Field("body", body.logged(redactedFields())))
+	})
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// traceID is the trace ID of the W3C traceparent header, else the request's
+// X-Request-Id.
+func traceID(r *http.Request) string {
+	if parts := strings.Split(r.Header.Get("Traceparent"), "-"); len(parts) == 4 && len(parts[1]) == 32 {
+		return parts[1]
+	}
+	return r.Header.Get("X-Request-Id")
+}
+
+// bodyCapture keeps the first limit bytes of a request body as the handler
+// reads it, so the body is never buffered whole or read twice.
+type bodyCapture struct {
+	io.ReadCloser
+	limit    int
+	captured []byte
+	size     int64
+	complete bool
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if room := b.limit - len(b.captured); room > 0 {
+		b.captured = append(b.captured, p[:min(n, room)]...)
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+// logged is the body with the values of fields redacted, or "" when it was
+// not captured, not read to the end, longer than the limit or not JSON.
+func (b *bodyCapture) logged(fields map[string]bool) string {
+	if b == nil || !b.complete || b.size > int64(len(b.captured)) || len(b.captured) == 0 {
+		return ""
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b.captured))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return ""
+	}
+	redacted, err := json.Marshal(redact(value, fields))
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+func redact(value any, fields map[string]bool) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			if fields[key] {
+				value[key] = redactedValue
+			} else {
+				value[key] = redact(item, fields)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = redact(item, fields)
+		}
+	}
+	return value
+}
+
+// accessLogWriter records the status and size of a response.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (rsp *accessLogWriter) WriteHeader(code int) {
+	if rsp.status == 0 && code >= http.StatusOK {
+		rsp.status = code
+	}
+	rsp.ResponseWriter.WriteHeader(code)
+}
+
+func (rsp *accessLogWriter) Write(p []byte) (int, error) {
+	if rsp.status == 0 {
+		rsp.status = http.StatusOK
+	}
+	n, err := rsp.ResponseWriter.Write(p)
+	rsp.size += int64(n)
+	return n, err
+}
+
+// Unwrap returns the original http.ResponseWriter. This is necessary
+// to expose Flush() and Push() on the underlying response writer.
+func (rsp *accessLogWriter) Unwrap() http.ResponseWriter {
+	return rsp.ResponseWriter
+}
+
+// Flush sends buffered stream messages to the client as they are written.
+func (rsp *accessLogWriter) Flush() {
+	_ = http.NewResponseController(rsp.ResponseWriter).Flush()
+}
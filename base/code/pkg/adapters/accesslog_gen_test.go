@@ -0,0 +1,69 @@
+package adapters
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func readCaptured(t *testing.T, body string, limit int) *bodyCapture {
+	t.Helper()
+	capture := &bodyCapture{ReadCloser: io.NopCloser(strings.NewReader(body)), limit: limit}
+	read, err := io.ReadAll(capture)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if string(read) != body {
+		t.Fatalf("handler read %q, want the whole body %q", read, body)
+	}
+	return capture
+}
+
+func TestAccessLogRedactsCapturedBodies(t *testing.T) {
+	capture := readCaptured(t, `{"name":"widget","nested":{"secret":"s3cr3t"},"items":[{"secret":1}]}`, 4096)
+	got := capture.logged(map[string]bool{"secret": true})
+	if strings.Contains(got, "s3cr3t") || strings.Contains(got, `"secret":1`) {
+		t.Fatalf("logged body %s leaks a redacted field", got)
+	}
+	if want := `{"items":[{"secret":"[REDACTED]"}],"name":"widget","nested":{"secret":"[REDACTED]"}}`; got != want {
+		t.Fatalf("logged body = %s, want %s", got, want)
+	}
+}
+
+func TestAccessLogCapturesAtMostTheLimit(t *testing.T) {
+	capture := readCaptured(t, `{"name":"`+strings.Repeat("x", 64)+`"}`, 16)
+	if len(capture.captured) != 16 || capture.size != 75 {
+		t.Fatalf("captured %d of %d bytes, want 16 of 75", len(capture.captured), capture.size)
+	}
+	if got := capture.logged(map[string]bool{"secret": true}); got != "" {
+		t.Fatalf("logged a truncated body: %s", got)
+	}
+
+	partial := &bodyCapture{ReadCloser: io.NopCloser(strings.NewReader(`{"name":"widget"}`)), limit: 4096}
+	if _, err := partial.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if got := partial.logged(redactedFields()); got != "" {
+		t.Fatalf("logged a body the handler did not finish reading: %s", got)
+	}
+}
+
+func TestAccessLogPassesRequestsThrough(t *testing.T) {
+	handler := AccessLog("rest", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/widgets", strings.NewReader(`{"secret":"s3cr3t"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"secret":"s3cr3t"}` {
+		t.Fatalf("response = %d %q, want the handler's own", rec.Code, rec.Body.String())
+	}
+}
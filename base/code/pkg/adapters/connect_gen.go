@@ -4,19 +4,29 @@ package adapters
 
 ⚠️ This code is generated by the agent. Do not edit this file!
 
+Every RPC of every service is bridged to the gRPC listener, so Connect,
+gRPC-Web and native gRPC callers reach the same implementations (the
+Configuration service fields) through the same validation and interceptors.
+
 ----------------------------------------------------------------- */
 
 import (
 	"codefly-base/pkg/gen"
 	"codefly-base/pkg/gen/genconnect"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"connectrpc.com/connect"
-	codefly "github.com/codefly-dev/sdk-go"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 // ConnectServer serves the Connect, gRPC, and gRPC-Web protocols over HTTP.
@@ -24,27 +34,235 @@ import (
 type ConnectServer struct {
 	config *Configuration
 	server *http.Server
+	conn   *grpc.ClientConn
 }
 
 func NewConnectServer(c *Configuration) (*ConnectServer, error) {
+	conn, err := grpc.NewClient(fmt.Sprintf("0.0.0.0:%d", c.EndpointGrpcPort), grpc.WithTransportCredentials(c.TLS.LoopbackCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Connect bridge connection: %w", err)
+	}
 	return &ConnectServer{
 		config: c,
 		server: &http.Server{Addr: fmt.Sprintf(":%d", *c.EndpointConnectPort)},
+		conn:   conn,
 	}, nil
 }
 
-// connectHandler wraps the GrpcServer to implement the Connect handler interface.
-type connectHandler struct {
-	// Embedding keeps a service with Connect disabled buildable as protobuf
-	// methods evolve. Enabled Connect services must explicitly implement their
-	// substantive handlers rather than accidentally inheriting a gRPC facade.
+// connectWebServiceBridge forwards each WebService Connect call to the
+// gRPC listener.
+type connectWebServiceBridge struct {
+	// Embedding keeps the file buildable when the service gains a method
+	// between Syncs; the next Sync bridges it.
 	genconnect.UnimplementedWebServiceHandler
+	client gen.WebServiceClient
+}
+
+func (b *connectWebServiceBridge) Version(ctx context.Context, req *connect.Request[gen.VersionRequest]) (*connect.Response[gen.VersionResponse], error) {
+	return bridgeUnary(ctx, req, b.client.Version)
+}
+
+func bridgeUnary[Req, Res any](ctx context.Context, req *connect.Request[Req], call func(context.Context, *Req, ...grpc.CallOption) (*Res, error)) (*connect.Response[Res], error) {
+	var header, trailer metadata.MD
+	res, err := call(bridgeOutgoing(ctx, req.Header()), req.Msg, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		return nil, bridgeError(err, trailer)
+	}
+	response := connect.NewResponse(res)
+	bridgeMetadata(response.Header(), header)
+	bridgeMetadata(response.Trailer(), trailer)
+	return response, nil
+}
+
+func bridgeServerStream[Req, Res any](ctx context.Context, req *connect.Request[Req], stream *connect.ServerStream[Res], call func(context.Context, *Req, ...grpc.CallOption) (grpc.ServerStreamingClient[Res], error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	upstream, err := call(bridgeOutgoing(ctx, req.Header()), req.Msg)
+	if err != nil {
+		return bridgeError(err, nil)
+	}
+	return bridgeResponses(stream.ResponseHeader(), stream.ResponseTrailer(), upstream, stream.Send)
+}
+
+func bridgeClientStream[Req, Res any](ctx context.Context, stream *connect.ClientStream[Req], call func(context.Context, ...grpc.CallOption) (grpc.ClientStreamingClient[Req, Res], error)) (*connect.Response[Res], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	upstream, err := call(bridgeOutgoing(ctx, stream.RequestHeader()))
+	if err != nil {
+		return nil, bridgeError(err, nil)
+	}
+	for stream.Receive() {
+		// io.EOF means the server already ended the call; CloseAndRecv
+		// reports its status.
+		if err := upstream.Send(stream.Msg()); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, bridgeError(err, upstream.Trailer())
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	res, err := upstream.CloseAndRecv()
+	if err != nil {
+		return nil, bridgeError(err, upstream.Trailer())
+	}
+	response := connect.NewResponse(res)
+	if header, err := upstream.Header(); err == nil {
+		bridgeMetadata(response.Header(), header)
+	}
+	bridgeMetadata(response.Trailer(), upstream.Trailer())
+	return response, nil
+}
+
+func bridgeBidiStream[Req, Res any](ctx context.Context, stream *connect.BidiStream[Req, Res], call func(context.Context, ...grpc.CallOption) (grpc.BidiStreamingClient[Req, Res], error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	upstream, err := call(bridgeOutgoing(ctx, stream.RequestHeader()))
+	if err != nil {
+		return bridgeError(err, nil)
+	}
+	received := make(chan error, 1)
+	go func() {
+		err := bridgeRequests(stream, upstream)
+		// Reported before cancelling, so the cancelled upstream call does not
+		// hide the reason.
+		received <- err
+		if err != nil {
+			cancel()
+		}
+	}()
+	err = bridgeResponses(stream.ResponseHeader(), stream.ResponseTrailer(), upstream, stream.Send)
+	select {
+	case receiveErr := <-received:
+		if receiveErr != nil {
+			return receiveErr
+		}
+		return err
+	default:
+	}
+	// The call ended before the caller half-closed. connect-go forbids using
+	// the stream once the handler returns, so stop the receiving goroutine
+	// first: closing the request body ends its Receive, cancel its Send.
+	cancel()
+	if body, ok := ctx.Value(requestBodyKey{}).(io.Closer); ok {
+		_ = body.Close()
+	}
+	<-received
+	return err
+}
+
+// bridgeRequests relays the caller's messages upstream until it half-closes.
+// An error is the caller's: it went away or sent an invalid message.
+func bridgeRequests[Req, Res any](stream *connect.BidiStream[Req, Res], upstream grpc.BidiStreamingClient[Req, Res]) error {
+	for {
+		req, err := stream.Receive()
+		if errors.Is(err, io.EOF) {
+			_ = upstream.CloseSend()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := upstream.Send(req); err != nil {
+			// The server ended the call; bridgeResponses reports how.
+			return nil
+		}
+	}
+}
+
+// requestBodyKey carries the request body to bridgeBidiStream, which closes
+// it to stop receiving when the call ends before the caller half-closed.
+type requestBodyKey struct{}
+
+// withRequestBody exposes each request's body through requestBodyKey.
+func withRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestBodyKey{}, r.Body)))
+	})
+}
+
+// bridgeResponses relays a gRPC response stream, its headers before the first
+// message and its trailers after the last.
+func bridgeResponses[Res any](header, trailer http.Header, upstream interface {
+	Recv() (*Res, error)
+	Header() (metadata.MD, error)
+	Trailer() metadata.MD
+}, send func(*Res) error) error {
+	if md, err := upstream.Header(); err == nil {
+		bridgeMetadata(header, md)
+	}
+	for {
+		res, err := upstream.Recv()
+		if errors.Is(err, io.EOF) {
+			bridgeMetadata(trailer, upstream.Trailer())
+			return nil
+		}
+		if err != nil {
+			return bridgeError(err, upstream.Trailer())
+		}
+		if err := send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// bridgeOutgoing forwards the caller's headers as gRPC metadata, leaving out
+// the ones owned by the HTTP and RPC protocols themselves.
+func bridgeOutgoing(ctx context.Context, header http.Header) context.Context {
+	md := metadata.MD{}
+	for key, values := range header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "connect-") || strings.HasPrefix(key, "grpc-") {
+			continue
+		}
+		switch key {
+		case "accept-encoding", "connection", "content-encoding", "content-length", "content-type",
+			"host", "keep-alive", "proxy-connection", "te", "trailer", "transfer-encoding", "upgrade", "user-agent":
+			continue
+		}
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				decoded, err := connect.DecodeBinaryHeader(value)
+				if err != nil {
+					continue
+				}
+				value = string(decoded)
+			}
+			md.Append(key, value)
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, md)
 }
 
-func (h *connectHandler) Version(ctx context.Context, req *connect.Request[gen.VersionRequest]) (*connect.Response[gen.VersionResponse], error) {
-	return connect.NewResponse(&gen.VersionResponse{
-		Version: codefly.ServiceVersion(),
-	}), nil
+func bridgeMetadata(target http.Header, md metadata.MD) {
+	for key, values := range md {
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				value = connect.EncodeBinaryHeader([]byte(value))
+			}
+			target.Add(key, value)
+		}
+	}
+}
+
+// bridgeError carries the gRPC status, its details and trailers over to the
+// Connect error; the two protocols share the code space.
+func bridgeError(err error, trailer metadata.MD) error {
+	st := status.Convert(err)
+	bridged := connect.NewError(connect.Code(st.Code()), errors.New(st.Message()))
+	for _, detail := range st.Details() {
+		message, ok := detail.(proto.Message)
+		if !ok {
+			continue
+		}
+		if errorDetail, err := connect.NewErrorDetail(message); err == nil {
+			bridged.AddDetail(errorDetail)
+		}
+	}
+	bridgeMetadata(bridged.Meta(), trailer)
+	return bridged
 }
 
 func (s *ConnectServer) Run(ctx context.Context) error {
@@ -56,18 +274,39 @@ func (s *ConnectServer) Run(ctx context.Context) error {
 
 	mux := http.NewServeMux()
 
-	// Register the Connect handler (serves Connect, gRPC, and gRPC-Web)
-	path, handler := genconnect.NewWebServiceHandler(&connectHandler{})
-	mux.Handle(path, handler)
+	// Register the Connect handlers (serve Connect, gRPC, and gRPC-Web)
+	mux.Handle(genconnect.NewWebServiceHandler(&connectWebServiceBridge{client: gen.NewWebServiceClient(s.conn)}, connect.WithInterceptors(connectValidation{})))
+
+	// Browsers calling Connect get the same origin policy as the REST gateway.
+	c, err := ConnectCors()
+	if err != nil {
+		return err
+	}
+
+	handler := AccessLog("connect", c.Handler(withRequestBody(mux)))
 
-	// Use h2c for HTTP/2 without TLS (development mode)
-	s.server.Handler = h2c.NewHandler(mux, &http2.Server{})
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	// HTTP/2 is negotiated over TLS; without it, h2c carries plaintext HTTP/2.
+	if s.config.TLS != nil {
+		s.server.Handler = handler
+		s.server.TLSConfig = s.config.TLS.Server
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		s.server.Handler = h2c.NewHandler(handler, &http2.Server{})
+		err = s.server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return err
 	}
 	return nil
 }
 
+// Shutdown waits for requests in flight until ctx is done, then closes the
+// connections still open.
 func (s *ConnectServer) Shutdown(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	defer s.conn.Close()
+	if err := s.server.Shutdown(ctx); err != nil {
+		_ = s.server.Close()
+		return err
+	}
+	return nil
 }
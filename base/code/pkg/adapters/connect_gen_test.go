@@ -0,0 +1,100 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// chatUpstream answers the first message and ends the call without waiting
+// for the caller to half-close. It counts the messages relayed to it after
+// the Connect handler returned.
+type chatUpstream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	first    chan *wrapperspb.StringValue
+	answered bool
+	returned atomic.Bool
+	sent     atomic.Bool
+	late     atomic.Int32
+}
+
+func (u *chatUpstream) Send(req *wrapperspb.StringValue) error {
+	if u.returned.Load() {
+		u.late.Add(1)
+	}
+	if u.sent.CompareAndSwap(false, true) {
+		u.first <- req
+	}
+	return nil
+}
+
+func (u *chatUpstream) Recv() (*wrapperspb.StringValue, error) {
+	if u.answered {
+		return nil, io.EOF
+	}
+	select {
+	case req := <-u.first:
+		u.answered = true
+		return wrapperspb.String("echo " + req.GetValue()), nil
+	case <-u.ctx.Done():
+		return nil, u.ctx.Err()
+	}
+}
+
+func (u *chatUpstream) Header() (metadata.MD, error) { return metadata.MD{}, nil }
+func (u *chatUpstream) Trailer() metadata.MD         { return metadata.MD{} }
+func (u *chatUpstream) CloseSend() error             { return nil }
+
+func TestBridgeBidiStreamStopsReceivingBeforeReturning(t *testing.T) {
+	upstream := &chatUpstream{first: make(chan *wrapperspb.StringValue, 1)}
+	mux := http.NewServeMux()
+	mux.Handle("/test.Chat/Chat", connect.NewBidiStreamHandler("/test.Chat/Chat",
+		func(ctx context.Context, stream *connect.BidiStream[wrapperspb.StringValue, wrapperspb.StringValue]) error {
+			defer upstream.returned.Store(true)
+			return bridgeBidiStream(ctx, stream, func(ctx context.Context, _ ...grpc.CallOption) (grpc.BidiStreamingClient[wrapperspb.StringValue, wrapperspb.StringValue], error) {
+				upstream.ctx = ctx
+				return upstream, nil
+			})
+		}))
+	server := httptest.NewUnstartedServer(withRequestBody(mux))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](server.Client(), server.URL+"/test.Chat/Chat")
+	stream := client.CallBidiStream(ctx)
+	// The caller keeps sending and never half-closes, so the bridge is
+	// relaying when the upstream ends the call.
+	sending := make(chan struct{})
+	go func() {
+		defer close(sending)
+		for stream.Send(wrapperspb.String("hello")) == nil {
+		}
+	}()
+	res, err := stream.Receive()
+	if err != nil || res.GetValue() != "echo hello" {
+		t.Fatalf("receive = %v, %v, want the echo", res, err)
+	}
+	if _, err := stream.Receive(); !errors.Is(err, io.EOF) {
+		t.Fatalf("receive after the upstream ended = %v, want io.EOF", err)
+	}
+	_ = stream.CloseResponse()
+	<-sending
+	_ = stream.CloseRequest()
+	if late := upstream.late.Load(); late != 0 {
+		t.Fatalf("%d message(s) relayed upstream after the handler returned", late)
+	}
+}
@@ -3,19 +3,133 @@ package adapters
 import (
 	"fmt"
 	"github.com/rs/cors"
+	"os"
+	"strconv"
+	"strings"
 )
 
 /* -----------------------------------------------------------------
 
 ⚠️ This code is generated by the agent. Do not edit this file!
 
+The policy below is rendered from the `cors` block of service.codefly.yaml.
+Override it per environment with a `cors` configuration (ALLOWED_ORIGINS,
+ALLOWED_METHODS, ALLOWED_HEADERS, EXPOSED_HEADERS, ALLOW_CREDENTIALS, MAX_AGE).
+
 ----------------------------------------------------------------- */
 
-func Cors() *cors.Cors {
-	fmt.Println("setting up cors: TODO")
-	return cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowedHeaders: []string{"*"},
-	})
+func corsPolicy() cors.Options {
+	return cors.Options{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
+		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{},
+		AllowCredentials: false,
+		MaxAge:           0,
+	}
+}
+
+// corsOverridePrefix names the environment variables codefly injects for this
+// service's own `cors` configuration. Dependencies' configurations are injected
+// as well, under their own module and service names.
+const corsOverridePrefix = "CODEFLY__SERVICE_CONFIGURATION__APP__CODEFLY_BASE__CORS__"
+
+func corsOverride(key string) (string, bool) {
+	return os.LookupEnv(corsOverridePrefix + key)
+}
+
+func corsList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// CorsOptions returns the rendered policy with the environment's overrides
+// applied.
+func CorsOptions() (cors.Options, error) {
+	options := corsPolicy()
+	if value, ok := corsOverride("ALLOWED_ORIGINS"); ok {
+		options.AllowedOrigins = corsList(value)
+	}
+	if value, ok := corsOverride("ALLOWED_METHODS"); ok {
+		options.AllowedMethods = corsList(value)
+	}
+	if value, ok := corsOverride("ALLOWED_HEADERS"); ok {
+		options.AllowedHeaders = corsList(value)
+	}
+	if value, ok := corsOverride("EXPOSED_HEADERS"); ok {
+		options.ExposedHeaders = corsList(value)
+	}
+	if value, ok := corsOverride("ALLOW_CREDENTIALS"); ok {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return options, fmt.Errorf("cors ALLOW_CREDENTIALS: %w", err)
+		}
+		options.AllowCredentials = allow
+	}
+	if value, ok := corsOverride("MAX_AGE"); ok {
+		maxAge, err := strconv.Atoi(value)
+		if err != nil || maxAge < 0 {
+			return options, fmt.Errorf("cors MAX_AGE %q must be a non-negative number of seconds", value)
+		}
+		options.MaxAge = maxAge
+	}
+	if options.AllowCredentials {
+		for _, origin := range options.AllowedOrigins {
+			if origin == "*" {
+				return options, fmt.Errorf("cors ALLOW_CREDENTIALS cannot be combined with the \"*\" origin")
+			}
+		}
+	}
+	return options, nil
+}
+
+func Cors() (*cors.Cors, error) {
+	options, err := CorsOptions()
+	if err != nil {
+		return nil, err
+	}
+	return cors.New(options), nil
+}
+
+// The Connect, gRPC-Web and gRPC protocols need browsers to be allowed to send
+// and read these methods and headers.
+var (
+	connectCorsMethods        = []string{"GET", "POST"}
+	connectCorsAllowedHeaders = []string{"Content-Type", "Connect-Protocol-Version", "Connect-Timeout-Ms", "Grpc-Timeout", "X-Grpc-Web", "X-User-Agent"}
+	connectCorsExposedHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+)
+
+// ConnectCors applies the same origin policy to the Connect listener, adding
+// the protocol headers its clients depend on.
+func ConnectCors() (*cors.Cors, error) {
+	options, err := CorsOptions()
+	if err != nil {
+		return nil, err
+	}
+	options.AllowedMethods = corsUnion(options.AllowedMethods, connectCorsMethods)
+	options.AllowedHeaders = corsUnion(options.AllowedHeaders, connectCorsAllowedHeaders)
+	options.ExposedHeaders = corsUnion(options.ExposedHeaders, connectCorsExposedHeaders)
+	return cors.New(options), nil
+}
+
+func corsUnion(values, required []string) []string {
+	union := append([]string(nil), values...)
+	for _, value := range required {
+		found := false
+		for _, existing := range union {
+			if existing == "*" || strings.EqualFold(existing, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			union = append(union, value)
+		}
+	}
+	return union
 }
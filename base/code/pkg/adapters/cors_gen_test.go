@@ -0,0 +1,26 @@
+package adapters
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCorsOptionsIgnoreDependencyConfigurations(t *testing.T) {
+	t.Setenv("CODEFLY__SERVICE_CONFIGURATION__APP__USERS__CORS__ALLOWED_ORIGINS", "https://users.example.com")
+	options, err := CorsOptions()
+	if err != nil {
+		t.Fatalf("CorsOptions() error: %v", err)
+	}
+	if want := corsPolicy().AllowedOrigins; !reflect.DeepEqual(options.AllowedOrigins, want) {
+		t.Fatalf("AllowedOrigins = %v, want the rendered %v", options.AllowedOrigins, want)
+	}
+
+	t.Setenv(corsOverridePrefix+"ALLOWED_ORIGINS", "https://app.example.com, https://admin.example.com")
+	options, err = CorsOptions()
+	if err != nil {
+		t.Fatalf("CorsOptions() error: %v", err)
+	}
+	if want := []string{"https://app.example.com", "https://admin.example.com"}; !reflect.DeepEqual(options.AllowedOrigins, want) {
+		t.Fatalf("AllowedOrigins = %v, want the service's override %v", options.AllowedOrigins, want)
+	}
+}
@@ -0,0 +1,39 @@
+package adapters
+
+/* -----------------------------------------------------------------
+
+⚠️ This code is generated by the agent. Do not edit this file!
+
+Every error a handler returns goes through apierrors.Status on the gRPC
+listener, so gRPC callers get its status and google.rpc details, Connect
+callers the same details bridged by bridgeError, and REST callers the
+problem+json rendering of rest_gen.go.
+
+----------------------------------------------------------------- */
+
+import (
+	"codefly-base/pkg/apierrors"
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// errorOptions installs the interceptors that map handler errors to their
+// status. They run outermost, so errors from GRPCServerOptions interceptors
+// are mapped too.
+func errorOptions() []grpc.ServerOption {
+	unary := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		res, err := handler(ctx, req)
+		if err != nil {
+			return nil, apierrors.Status(err).Err()
+		}
+		return res, nil
+	}
+	stream := func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, ss); err != nil {
+			return apierrors.Status(err).Err()
+		}
+		return nil
+	}
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream)}
+}
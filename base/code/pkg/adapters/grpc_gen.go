@@ -10,47 +10,24 @@ implement your APIs there.
 ----------------------------------------------------------------- */
 
 import (
-	"buf.build/go/protovalidate"
 	"codefly-base/pkg/gen"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net"
-
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-
-	"google.golang.org/protobuf/proto"
+	"time"
 
 	"google.golang.org/grpc/reflection"
 
 	codefly "github.com/codefly-dev/sdk-go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
-var validator protovalidate.Validator
-
-func init() {
-	v, err := protovalidate.New()
-	if err != nil {
-		panic(fmt.Errorf("failed to create validator: %w", err))
-	}
-	validator = v
-}
-
-func Validate(req proto.Message) error {
-	err := validator.Validate(req)
-	if err != nil {
-		return status.Error(codes.InvalidArgument, err.Error())
-	}
-	return nil
-}
-
 func (s *GrpcServer) Version(ctx context.Context, req *gen.VersionRequest) (*gen.VersionResponse, error) {
-	if err := Validate(req); err != nil {
-		return nil, err
-	}
 	return &gen.VersionResponse{
 		Version: codefly.ServiceVersion(),
 	}, nil
@@ -62,10 +39,34 @@ type Configuration struct {
 	EndpointConnectPort *uint16
 	// GRPCServerOptions installs transport policy such as authentication,
 	// authorization, telemetry, and rate limiting before the listener starts.
+	// Their interceptors run before request validation.
 	GRPCServerOptions []grpc.ServerOption
+	// ValidateResponses also checks every response against its protovalidate
+	// rules; an invalid one reaches the caller as Internal.
+	ValidateResponses bool
+	// TLS secures the gRPC, REST and Connect listeners. NewServer loads it
+	// from the CODEFLY_TLS_* environment when nil; see LoadTLS.
+	TLS *TLS
+	// DrainPeriod is how long health reports NOT_SERVING on shutdown before
+	// the listeners stop accepting requests, and ShutdownTimeout how long
+	// requests in flight then get to finish. Zero keeps the service's
+	// `shutdown` settings; see Server.Start.
+	DrainPeriod     time.Duration
+	ShutdownTimeout time.Duration
 	// Service replaces the generated Version-only implementation when the
 	// service owns substantive RPCs with constructor-injected dependencies.
 	Service gen.WebServiceServer
+	// Database receives the plugin migrations declared through
+	// framework.Plugin.Migrations(). Required only when a plugin declares any.
+	Database *sql.DB
+	// SQLPlaceholder renders the n-th (1-based) bind parameter of the
+	// migration bookkeeping queries. Defaults to PostgreSQL-style $n.
+	SQLPlaceholder func(n int) string
+	// MigrationLock is held on conn, the connection Migrate runs on, while
+	// it applies pending migrations, so replicas starting together run each
+	// file once; it returns the release. Defaults to a PostgreSQL advisory
+	// lock; set it for other databases.
+	MigrationLock func(ctx context.Context, conn *sql.Conn) (release func() error, err error)
 }
 
 type GrpcServer struct {
@@ -73,15 +74,16 @@ type GrpcServer struct {
 	configuration *Configuration
 	gRPC          *grpc.Server
 	health        *health.Server
-	validator     protovalidate.Validator
 }
 
 func NewGrpServer(c *Configuration) (*GrpcServer, error) {
-	grpcServer := grpc.NewServer(c.GRPCServerOptions...)
-	v, err := protovalidate.New()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create validator: %w", err)
+	// Error mapping runs outermost and validation innermost, around the
+	// interceptors of GRPCServerOptions.
+	options := append(append(errorOptions(), c.GRPCServerOptions...), validationOptions(c.ValidateResponses)...)
+	if c.TLS != nil {
+		options = append([]grpc.ServerOption{grpc.Creds(credentials.NewTLS(c.TLS.Server))}, options...)
 	}
+	grpcServer := grpc.NewServer(options...)
 
 	healthServer := health.NewServer()
 	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
@@ -92,7 +94,6 @@ func NewGrpServer(c *Configuration) (*GrpcServer, error) {
 		configuration: c,
 		gRPC:          grpcServer,
 		health:        healthServer,
-		validator:     v,
 	}
 	service := gen.WebServiceServer(&s)
 	if c.Service != nil {
@@ -110,7 +111,8 @@ func (s *GrpcServer) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	if err := s.gRPC.Serve(lis); err != nil {
+	// A server stopped before it served has nothing left to do.
+	if err := s.gRPC.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
 		return fmt.Errorf("failed to serve: %s", err)
 	}
 	return nil
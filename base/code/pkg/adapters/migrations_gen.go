@@ -0,0 +1,303 @@
+package adapters
+
+/* -----------------------------------------------------------------
+
+⚠️ This code is generated by the agent. Do not edit this file!
+
+Plugins declare their SQL files through framework.Plugin.Migrations()
+and ship them through framework.MigrationSource. Provide the database in
+your Configure hook (config.Database) and they are applied before any
+listener starts.
+
+----------------------------------------------------------------- */
+
+import (
+	"codefly-base/pkg/framework"
+	"codefly-base/plugins"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// MigrationTable records every applied plugin migration with the checksum of
+// the file that was run.
+const MigrationTable = "codefly_schema_migrations"
+
+// MigrationStatus describes one declared migration file.
+type MigrationStatus struct {
+	Plugin   string
+	Version  string
+	Path     string
+	Checksum string
+	Applied  bool
+}
+
+type pluginMigration struct {
+	MigrationStatus
+	body []byte
+}
+
+// collectMigrations reads every plugin's migration files in registry order,
+// each plugin's files in the order it declares them, from the file system
+// the plugin ships them in: the image carries no SQL files beside the
+// binary. The file base name is the version recorded in MigrationTable.
+func collectMigrations(registered []framework.Plugin) ([]pluginMigration, error) {
+	var migrations []pluginMigration
+	for _, p := range registered {
+		declared := p.Migrations()
+		if len(declared) == 0 {
+			continue
+		}
+		source, ok := p.(framework.MigrationSource)
+		if !ok {
+			return nil, fmt.Errorf("plugin %s declares migrations but does not implement framework.MigrationSource: embed its SQL files and return them from MigrationFiles", p.Name())
+		}
+		files := source.MigrationFiles()
+		seen := map[string]string{}
+		for _, file := range declared {
+			version := path.Base(file)
+			if previous, ok := seen[version]; ok {
+				return nil, fmt.Errorf("plugin %s declares migration %s twice (%s and %s)", p.Name(), version, previous, file)
+			}
+			seen[version] = file
+			body, err := fs.ReadFile(files, file)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s migration %s: %w", p.Name(), version, err)
+			}
+			sum := sha256.Sum256(body)
+			migrations = append(migrations, pluginMigration{
+				MigrationStatus: MigrationStatus{
+					Plugin:   p.Name(),
+					Version:  version,
+					Path:     file,
+					Checksum: hex.EncodeToString(sum[:]),
+				},
+				body: body,
+			})
+		}
+	}
+	return migrations, nil
+}
+
+func migrationPlaceholder(c *Configuration, n int) string {
+	if c.SQLPlaceholder != nil {
+		return c.SQLPlaceholder(n)
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// MigrationStatuses reports every declared migration and whether it has been
+// applied. An applied file whose content changed since is an error: the
+// database no longer matches what the code declares. It only reads: without
+// MigrationTable nothing has been applied, and the table is not created.
+func MigrationStatuses(ctx context.Context, c *Configuration) ([]MigrationStatus, error) {
+	return migrationStatuses(ctx, c, plugins.All())
+}
+
+func migrationStatuses(ctx context.Context, c *Configuration, registered []framework.Plugin) ([]MigrationStatus, error) {
+	migrations, err := collectMigrations(registered)
+	if err != nil || len(migrations) == 0 {
+		return nil, err
+	}
+	if c.Database == nil {
+		return nil, fmt.Errorf("plugins declare %d migration(s) but Configuration.Database is not set", len(migrations))
+	}
+	exists, err := migrationTableExists(ctx, c.Database)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]string{}
+	if exists {
+		if applied, err = appliedMigrations(ctx, c.Database); err != nil {
+			return nil, err
+		}
+	}
+	if err := markApplied(migrations, applied); err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		statuses = append(statuses, migration.MigrationStatus)
+	}
+	return statuses, nil
+}
+
+// Migrate applies every pending plugin migration, each in its own
+// transaction together with its bookkeeping row, so a failed file leaves
+// neither partial schema changes nor a record claiming it ran.
+//
+// Every replica migrates on startup: Migrate holds Configuration's
+// MigrationLock while it reads what was applied and applies the rest, so
+// replicas starting together wait for each other instead of running a file
+// twice.
+func Migrate(ctx context.Context, c *Configuration) ([]MigrationStatus, error) {
+	return migrate(ctx, c, plugins.All())
+}
+
+func migrate(ctx context.Context, c *Configuration, registered []framework.Plugin) (ran []MigrationStatus, err error) {
+	migrations, err := collectMigrations(registered)
+	if err != nil || len(migrations) == 0 {
+		return nil, err
+	}
+	if c.Database == nil {
+		return nil, fmt.Errorf("plugins declare %d migration(s) but Configuration.Database is not set", len(migrations))
+	}
+	// Session locks belong to one connection, so the whole run uses one.
+	conn, err := c.Database.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect for migrations: %w", err)
+	}
+	defer conn.Close()
+	release, err := lockMigrations(ctx, c, conn)
+	if err != nil {
+		return nil, fmt.Errorf("lock migrations: %w", err)
+	}
+	defer func() {
+		if releaseErr := release(); releaseErr != nil {
+			err = errors.Join(err, fmt.Errorf("unlock migrations: %w", releaseErr))
+		}
+	}()
+
+	if err := createMigrationTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := markApplied(migrations, applied); err != nil {
+		return nil, err
+	}
+	for _, migration := range migrations {
+		if migration.Applied {
+			continue
+		}
+		if err := applyMigration(ctx, c, conn, migration); err != nil {
+			return ran, err
+		}
+		migration.Applied = true
+		ran = append(ran, migration.MigrationStatus)
+	}
+	return ran, nil
+}
+
+// lockMigrations takes Configuration.MigrationLock, by default a PostgreSQL
+// session advisory lock keyed on MigrationTable.
+func lockMigrations(ctx context.Context, c *Configuration, conn *sql.Conn) (func() error, error) {
+	if c.MigrationLock != nil {
+		return c.MigrationLock(ctx, conn)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SELECT pg_advisory_lock(hashtext('%s'))", MigrationTable)); err != nil {
+		return nil, err
+	}
+	return func() error {
+		// Not ctx: a cancelled startup must still hand the lock back before
+		// the connection returns to the pool.
+		_, err := conn.ExecContext(context.Background(), fmt.Sprintf("SELECT pg_advisory_unlock(hashtext('%s'))", MigrationTable))
+		return err
+	}, nil
+}
+
+// markApplied pairs the declared migrations with the applied ones and fails
+// on checksum drift of an already-applied file.
+func markApplied(migrations []pluginMigration, applied map[string]string) error {
+	for index := range migrations {
+		migration := &migrations[index]
+		checksum, ok := applied[migration.Plugin+"/"+migration.Version]
+		if !ok {
+			continue
+		}
+		if checksum != migration.Checksum {
+			return fmt.Errorf("plugin %s migration %s was modified after it was applied (checksum %s, applied %s)", migration.Plugin, migration.Version, migration.Checksum, checksum)
+		}
+		migration.Applied = true
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, c *Configuration, conn *sql.Conn, migration pluginMigration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("plugin %s migration %s: begin: %w", migration.Plugin, migration.Version, err)
+	}
+	if _, err := tx.ExecContext(ctx, string(migration.body)); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("plugin %s migration %s: %w", migration.Plugin, migration.Version, err)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (plugin, version, checksum) VALUES (%s, %s, %s)", MigrationTable,
+		migrationPlaceholder(c, 1), migrationPlaceholder(c, 2), migrationPlaceholder(c, 3))
+	if _, err := tx.ExecContext(ctx, insert, migration.Plugin, migration.Version, migration.Checksum); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("plugin %s migration %s: record: %w", migration.Plugin, migration.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("plugin %s migration %s: commit: %w", migration.Plugin, migration.Version, err)
+	}
+	return nil
+}
+
+// migrationQuerier is the *sql.DB MigrationStatuses reads through or the
+// *sql.Conn Migrate holds its lock on.
+type migrationQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func createMigrationTable(ctx context.Context, db migrationQuerier) error {
+	create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	plugin VARCHAR(255) NOT NULL,
+	version VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (plugin, version)
+)`, MigrationTable)
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("create %s: %w", MigrationTable, err)
+	}
+	return nil
+}
+
+// missingTableErrors are how PostgreSQL, SQLite and MySQL report a table that
+// does not exist. database/sql has no portable error for it.
+var missingTableErrors = []string{"does not exist", "no such table", "doesn't exist"}
+
+// migrationTableExists probes MigrationTable with a query that reads no row,
+// as every SQL database answers it the same way. Only a missing table means
+// nothing was applied: any other failure, such as an unreachable database, is
+// returned so status does not report every migration as pending.
+func migrationTableExists(ctx context.Context, db migrationQuerier) (bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE 1 = 0", MigrationTable))
+	if err != nil {
+		for _, missing := range missingTableErrors {
+			if strings.Contains(err.Error(), missing) {
+				return false, nil
+			}
+		}
+		return false, fmt.Errorf("read %s: %w", MigrationTable, err)
+	}
+	_ = rows.Close()
+	return true, nil
+}
+
+func appliedMigrations(ctx context.Context, db migrationQuerier) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT plugin, version, checksum FROM %s", MigrationTable))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", MigrationTable, err)
+	}
+	defer rows.Close()
+	applied := map[string]string{}
+	for rows.Next() {
+		var plugin, version, checksum string
+		if err := rows.Scan(&plugin, &version, &checksum); err != nil {
+			return nil, fmt.Errorf("read %s: %w", MigrationTable, err)
+		}
+		applied[plugin+"/"+version] = checksum
+	}
+	return applied, rows.Err()
+}
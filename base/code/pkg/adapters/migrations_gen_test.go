@@ -0,0 +1,342 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"codefly-base/pkg/framework"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+)
+
+type migrationPlugin struct {
+	name  string
+	files fstest.MapFS
+	paths []string
+}
+
+func (p *migrationPlugin) Name() string              { return p.name }
+func (p *migrationPlugin) RegisterGRPC(*grpc.Server) {}
+func (p *migrationPlugin) RegisterREST(context.Context, *runtime.ServeMux, string, []grpc.DialOption) error {
+	return nil
+}
+func (p *migrationPlugin) Migrations() []string  { return p.paths }
+func (p *migrationPlugin) MigrationFiles() fs.FS { return p.files }
+
+// migrationDatabase is the state behind the migrationtest driver: the
+// bookkeeping table and the migration bodies that were committed.
+type migrationDatabase struct {
+	mu         sync.Mutex
+	table      bool
+	rows       [][]driver.Value
+	schema     []string
+	statements []string
+	locked     bool
+	// queryErr, when set, fails every query as an unreachable database would.
+	queryErr error
+}
+
+var (
+	migrationDatabasesMu sync.Mutex
+	migrationDatabases   = map[string]*migrationDatabase{}
+)
+
+func init() {
+	sql.Register("migrationtest", migrationDriver{})
+}
+
+func openMigrationDatabase(t *testing.T) (*sql.DB, *migrationDatabase) {
+	t.Helper()
+	state := &migrationDatabase{}
+	migrationDatabasesMu.Lock()
+	migrationDatabases[t.Name()] = state
+	migrationDatabasesMu.Unlock()
+	db, err := sql.Open("migrationtest", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db, state
+}
+
+type migrationDriver struct{}
+
+func (migrationDriver) Open(name string) (driver.Conn, error) {
+	migrationDatabasesMu.Lock()
+	defer migrationDatabasesMu.Unlock()
+	return &migrationConn{db: migrationDatabases[name]}, nil
+}
+
+type migrationConn struct {
+	db *migrationDatabase
+	tx *migrationTx
+}
+
+type migrationTx struct {
+	conn   *migrationConn
+	rows   [][]driver.Value
+	schema []string
+}
+
+func (c *migrationConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("migrationtest: prepared statements are not supported")
+}
+func (c *migrationConn) Close() error { return nil }
+func (c *migrationConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *migrationConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.tx = &migrationTx{conn: c}
+	return c.tx, nil
+}
+
+func (tx *migrationTx) Commit() error {
+	db := tx.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rows = append(db.rows, tx.rows...)
+	db.schema = append(db.schema, tx.schema...)
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *migrationTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+func (c *migrationConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, query)
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS "+MigrationTable):
+		db.table = true
+	case strings.Contains(query, "pg_advisory_lock"):
+		db.locked = true
+	case strings.Contains(query, "pg_advisory_unlock"):
+		db.locked = false
+	case strings.HasPrefix(query, "INSERT INTO "+MigrationTable):
+		row := []driver.Value{args[0].Value, args[1].Value, args[2].Value}
+		for _, applied := range append(append([][]driver.Value(nil), db.rows...), c.tx.rows...) {
+			if applied[0] == row[0] && applied[1] == row[1] {
+				return nil, fmt.Errorf("duplicate key %v/%v", row[0], row[1])
+			}
+		}
+		c.tx.rows = append(c.tx.rows, row)
+	case strings.Contains(query, "syntax error"):
+		return nil, errors.New("syntax error at or near \"syntax\"")
+	default:
+		if c.tx == nil {
+			return nil, fmt.Errorf("migrationtest: %q ran outside a transaction", query)
+		}
+		c.tx.schema = append(c.tx.schema, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *migrationConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, query)
+	if db.queryErr != nil {
+		return nil, db.queryErr
+	}
+	if !db.table {
+		return nil, fmt.Errorf("relation %q does not exist", MigrationTable)
+	}
+	if strings.HasPrefix(query, "SELECT 1 FROM") {
+		return &migrationRows{columns: []string{"?column?"}}, nil
+	}
+	return &migrationRows{columns: []string{"plugin", "version", "checksum"}, rows: append([][]driver.Value(nil), db.rows...)}, nil
+}
+
+type migrationRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *migrationRows) Columns() []string { return r.columns }
+func (r *migrationRows) Close() error      { return nil }
+func (r *migrationRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func ordersPlugin() *migrationPlugin {
+	return &migrationPlugin{
+		name: "orders",
+		files: fstest.MapFS{
+			"migrations/001_orders.sql": {Data: []byte("CREATE TABLE orders (id BIGINT PRIMARY KEY)")},
+			"migrations/002_index.sql":  {Data: []byte("CREATE INDEX orders_id ON orders (id)")},
+		},
+		paths: []string{"migrations/001_orders.sql", "migrations/002_index.sql"},
+	}
+}
+
+func TestCollectMigrationsReadsThePluginFiles(t *testing.T) {
+	migrations, err := collectMigrations([]framework.Plugin{ordersPlugin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != "001_orders.sql" || migrations[1].Version != "002_index.sql" {
+		t.Fatalf("collectMigrations() = %+v, want both files in declared order", migrations)
+	}
+	if string(migrations[0].body) != "CREATE TABLE orders (id BIGINT PRIMARY KEY)" || len(migrations[0].Checksum) != 64 {
+		t.Fatalf("collectMigrations() read %q with checksum %q", migrations[0].body, migrations[0].Checksum)
+	}
+
+	missing := ordersPlugin()
+	missing.paths = append(missing.paths, "migrations/003_missing.sql")
+	if _, err := collectMigrations([]framework.Plugin{missing}); err == nil || !strings.Contains(err.Error(), "003_missing.sql") {
+		t.Fatalf("collectMigrations() error = %v, want the missing file named", err)
+	}
+}
+
+func TestMigrateAppliesPendingMigrationsOnce(t *testing.T) {
+	db, state := openMigrationDatabase(t)
+	c := &Configuration{Database: db}
+	registered := []framework.Plugin{ordersPlugin()}
+
+	statuses, err := migrationStatuses(context.Background(), c, registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].Applied || statuses[1].Applied {
+		t.Fatalf("status before migrating = %+v, want both pending", statuses)
+	}
+	if state.table {
+		t.Fatal("status created the bookkeeping table")
+	}
+
+	ran, err := migrate(context.Background(), c, registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || len(state.schema) != 2 || len(state.rows) != 2 {
+		t.Fatalf("migrate() ran %+v, committed %v and recorded %v, want both files", ran, state.schema, state.rows)
+	}
+	if state.locked {
+		t.Fatal("migrate() kept the migration lock")
+	}
+
+	ran, err = migrate(context.Background(), c, registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 0 || len(state.schema) != 2 {
+		t.Fatalf("second migrate() ran %+v, want the applied files skipped", ran)
+	}
+	statuses, err = migrationStatuses(context.Background(), c, registered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Applied || !statuses[1].Applied {
+		t.Fatalf("status after migrating = %+v, want both applied", statuses)
+	}
+}
+
+func TestMigrationStatusReportsAnUnreachableDatabase(t *testing.T) {
+	db, state := openMigrationDatabase(t)
+	state.queryErr = errors.New("dial tcp 10.0.0.7:5432: connect: connection refused")
+	_, err := migrationStatuses(context.Background(), &Configuration{Database: db}, []framework.Plugin{ordersPlugin()})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("migrationStatuses() error = %v, want the connection failure rather than pending migrations", err)
+	}
+}
+
+func TestMigrateRejectsAModifiedAppliedMigration(t *testing.T) {
+	db, state := openMigrationDatabase(t)
+	c := &Configuration{Database: db}
+	plugin := ordersPlugin()
+	if _, err := migrate(context.Background(), c, []framework.Plugin{plugin}); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin.files["migrations/001_orders.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE orders (id UUID PRIMARY KEY)")}
+	if _, err := migrate(context.Background(), c, []framework.Plugin{plugin}); err == nil || !strings.Contains(err.Error(), "001_orders.sql was modified after it was applied") {
+		t.Fatalf("migrate() error = %v, want checksum drift", err)
+	}
+	if _, err := migrationStatuses(context.Background(), c, []framework.Plugin{plugin}); err == nil || !strings.Contains(err.Error(), "was modified after it was applied") {
+		t.Fatalf("migrationStatuses() error = %v, want checksum drift", err)
+	}
+	if len(state.schema) != 2 || state.locked {
+		t.Fatalf("drift ran %v and left the lock held: %v", state.schema, state.locked)
+	}
+}
+
+func TestMigrateRollsBackAFailedMigration(t *testing.T) {
+	db, state := openMigrationDatabase(t)
+	plugin := ordersPlugin()
+	plugin.files["migrations/002_index.sql"] = &fstest.MapFile{Data: []byte("CREATE INDEX syntax error")}
+	plugin.files["migrations/003_later.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE orders ADD COLUMN total BIGINT")}
+	plugin.paths = append(plugin.paths, "migrations/003_later.sql")
+
+	ran, err := migrate(context.Background(), &Configuration{Database: db}, []framework.Plugin{plugin})
+	if err == nil || !strings.Contains(err.Error(), "plugin orders migration 002_index.sql") {
+		t.Fatalf("migrate() error = %v, want the failed file named", err)
+	}
+	if len(ran) != 1 || ran[0].Version != "001_orders.sql" {
+		t.Fatalf("migrate() ran %+v, want only the file before the failure", ran)
+	}
+	if len(state.rows) != 1 || len(state.schema) != 1 {
+		t.Fatalf("failed migration left schema %v and records %v, want only 001's", state.schema, state.rows)
+	}
+	if state.locked {
+		t.Fatal("a failed migrate() kept the migration lock")
+	}
+}
+
+func TestMigrateHoldsTheConfiguredLock(t *testing.T) {
+	db, state := openMigrationDatabase(t)
+	var held, released bool
+	c := &Configuration{Database: db, MigrationLock: func(ctx context.Context, conn *sql.Conn) (func() error, error) {
+		held = true
+		return func() error { released = true; return nil }, nil
+	}}
+	if _, err := migrate(context.Background(), c, []framework.Plugin{ordersPlugin()}); err != nil {
+		t.Fatal(err)
+	}
+	if !held || !released {
+		t.Fatalf("MigrationLock held %v, released %v", held, released)
+	}
+	for _, statement := range state.statements {
+		if strings.Contains(statement, "pg_advisory") {
+			t.Fatalf("migrate() took the default lock beside the configured one: %q", statement)
+		}
+	}
+}
+
+func TestMigrateRequiresPluginsToShipTheirFiles(t *testing.T) {
+	_, err := collectMigrations([]framework.Plugin{&pathsOnlyPlugin{ordersPlugin()}})
+	if err == nil || !strings.Contains(err.Error(), "does not implement framework.MigrationSource") {
+		t.Fatalf("collectMigrations() error = %v, want the missing MigrationSource named", err)
+	}
+}
+
+// pathsOnlyPlugin declares migrations without a file system to read them from.
+type pathsOnlyPlugin struct{ plugin *migrationPlugin }
+
+func (p *pathsOnlyPlugin) Name() string              { return p.plugin.Name() }
+func (p *pathsOnlyPlugin) RegisterGRPC(*grpc.Server) {}
+func (p *pathsOnlyPlugin) RegisterREST(context.Context, *runtime.ServeMux, string, []grpc.DialOption) error {
+	return nil
+}
+func (p *pathsOnlyPlugin) Migrations() []string { return p.plugin.Migrations() }
@@ -7,15 +7,15 @@ package adapters
 ----------------------------------------------------------------- */
 
 import (
-	"bytes"
+	"codefly-base/pkg/apierrors"
 	"codefly-base/pkg/gen"
 	"codefly-base/plugins"
 	"context"
+	"encoding/json"
 	"fmt"
-	"google.golang.org/grpc/grpclog"
-	"google.golang.org/grpc/status"
-	"io"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/codefly-dev/core/wool"
 
@@ -23,8 +23,17 @@ import (
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// ndjsonContentType asks for a server-streaming RPC as one JSON object
+	// per line, which is what the gateway streams by default.
+	ndjsonContentType = "application/x-ndjson"
+	// sseContentType asks for a server-streaming RPC as Server-Sent Events,
+	// one "data:" event per message.
+	sseContentType = "text/event-stream"
 )
 
 type RestServer struct {
@@ -45,32 +54,46 @@ func CustomHeaderToGRPCMetadataAnnotator(ctx context.Context, req *http.Request)
 	return wool.MetadataFromRequest(ctx, req)
 }
 
-func customErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
-	// Check if it's a "not found" error
-	if runtime.HTTPStatusFromCode(status.Code(err)) == http.StatusNotFound {
-		http.Error(w, "Route not found", http.StatusNotFound)
-		return
+// problemErrorHandler answers every gateway error, from the service or from
+// routing, as RFC 7807 problem+json with the status and its details.
+func problemErrorHandler(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := apierrors.Status(err)
+	httpStatus := runtime.HTTPStatusFromCode(st.Code())
+	problem := apierrors.NewProblem(st, httpStatus, r.URL.Path)
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Type", apierrors.ProblemContentType)
+	if problem.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(problem.RetryAfter))))
+	}
+	w.WriteHeader(httpStatus)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		wool.Get(r.Context()).In("rest").Error("failed to write problem response", wool.ErrField(err))
 	}
-
-	// For other errors, use the default error handler
-	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
 }
 
 func (s *RestServer) Run(ctx context.Context) error {
 	fmt.Println("Starting Rest server at", *s.config.EndpointHttpPort)
 
 	// Create a CORS handler
-	c := Cors()
+	c, err := Cors()
+	if err != nil {
+		return err
+	}
 
 	gwMux := runtime.NewServeMux(
 		runtime.WithMetadata(CustomHeaderToGRPCMetadataAnnotator),
-		runtime.WithErrorHandler(customErrorHandler))
+		runtime.WithErrorHandler(problemErrorHandler),
+		// Server-streaming RPCs are chosen between NDJSON and SSE by the
+		// Accept header; other requests keep the default JSON marshaler.
+		runtime.WithMarshalerOption(ndjsonContentType, &streamMarshaler{JSONPb: newRestJSON(), contentType: ndjsonContentType, delimiter: []byte("\n")}),
+		runtime.WithMarshalerOption(sseContentType, &streamMarshaler{JSONPb: newRestJSON(), contentType: sseContentType, event: true}))
 
 	// Register generated gateway handlers
 
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(s.config.TLS.LoopbackCredentials())}
 
-	err := gen.RegisterWebServiceHandlerFromEndpoint(ctx, gwMux, fmt.Sprintf("0.0.0.0:%d", s.config.EndpointGrpcPort), opts)
+	err = gen.RegisterWebServiceHandlerFromEndpoint(ctx, gwMux, fmt.Sprintf("0.0.0.0:%d", s.config.EndpointGrpcPort), opts)
 	if err != nil {
 		return err
 	}
@@ -104,55 +127,64 @@ func (s *RestServer) Run(ctx context.Context) error {
 	// Wrap your mux with the CORS handler
 	handler := c.Handler(gwMux)
 
-	s.server.Handler = logRequestBody(handler)
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	s.server.Handler = AccessLog("rest", handler)
+	if s.config.TLS != nil {
+		s.server.TLSConfig = s.config.TLS.Server
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		err = s.server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return err
 	}
 	return nil
 }
 
+// Shutdown waits for requests in flight until ctx is done, then closes the
+// connections still open.
 func (s *RestServer) Shutdown(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	if err := s.server.Shutdown(ctx); err != nil {
+		_ = s.server.Close()
+		return err
+	}
+	return nil
 }
 
-type logResponseWriter struct {
-	http.ResponseWriter
-	statusCode int
+// newRestJSON is the gateway's default JSON encoding: unpopulated fields are
+// emitted and unknown request fields ignored.
+func newRestJSON() *runtime.JSONPb {
+	return &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
 }
 
-func (rsp *logResponseWriter) WriteHeader(code int) {
-	rsp.statusCode = code
-	rsp.ResponseWriter.WriteHeader(code)
+// streamMarshaler writes each message of a server-streaming RPC, wrapped by
+// the gateway as {"result": ...} or {"error": ...}, as one JSON line or, with
+// event set, as one Server-Sent Event. The gateway flushes after every
+// message. A unary response is a single line or event.
+type streamMarshaler struct {
+	*runtime.JSONPb
+	contentType string
+	delimiter   []byte
+	event       bool
 }
 
-// Unwrap returns the original http.ResponseWriter. This is necessary
-// to expose Flush() and Push() on the underlying response writer.
-func (rsp *logResponseWriter) Unwrap() http.ResponseWriter {
-	return rsp.ResponseWriter
+func (m *streamMarshaler) ContentType(any) string {
+	return m.contentType
 }
 
-func newLogResponseWriter(w http.ResponseWriter) *logResponseWriter {
-	return &logResponseWriter{w, http.StatusOK}
+func (m *streamMarshaler) Marshal(v any) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil || !m.event {
+		return data, err
+	}
+	event := make([]byte, 0, len(data)+8)
+	event = append(event, "data: "...)
+	event = append(event, data...)
+	return append(event, "\n\n"...), nil
 }
 
-// logRequestBody logs the request body when the response status code is not 200.
-func logRequestBody(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		lw := newLogResponseWriter(w)
-
-		// Note that buffering the entire request body could consume a lot of memory.
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
-			return
-		}
-		clonedR := r.Clone(r.Context())
-		clonedR.Body = io.NopCloser(bytes.NewReader(body))
-
-		h.ServeHTTP(lw, clonedR)
-
-		if lw.statusCode != http.StatusOK {
-			grpclog.Errorf("http error %+v request body %+v", lw.statusCode, string(body))
-		}
-	})
+func (m *streamMarshaler) Delimiter() []byte {
+	return m.delimiter
 }
@@ -4,23 +4,58 @@ package adapters
 
 ⚠️ This code is generated by the agent. Do not edit this file!
 
+The shutdown policy below is rendered from the `shutdown` block of
+service.codefly.yaml, which also sizes the deployment's
+terminationGracePeriodSeconds. CODEFLY_SHUTDOWN_DRAIN_PERIOD and
+CODEFLY_SHUTDOWN_TIMEOUT override it.
 
 ----------------------------------------------------------------- */
 
 import (
 	"codefly-base/plugins"
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
 	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultDrainPeriod     = "5s"
+	defaultShutdownTimeout = "20s"
 )
 
 type Server struct {
 	grpc    *GrpcServer
 	rest    *RestServer
 	connect *ConnectServer
+
+	drainPeriod     time.Duration
+	shutdownTimeout time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
 }
 
 func NewServer(config *Configuration) (*Server, error) {
+	if config.TLS == nil {
+		tlsConfig, err := LoadTLS()
+		if err != nil {
+			return nil, err
+		}
+		config.TLS = tlsConfig
+	}
+
+	drainPeriod, err := shutdownDuration(config.DrainPeriod, "CODEFLY_SHUTDOWN_DRAIN_PERIOD", defaultDrainPeriod)
+	if err != nil {
+		return nil, err
+	}
+	shutdownTimeout, err := shutdownDuration(config.ShutdownTimeout, "CODEFLY_SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	if err != nil {
+		return nil, err
+	}
 
 	grpc, err := NewGrpServer(config)
 	if err != nil {
@@ -31,7 +66,6 @@ func NewServer(config *Configuration) (*Server, error) {
 	for _, p := range plugins.All() {
 		p.RegisterGRPC(grpc.gRPC)
 	}
-
 	var rest *RestServer
 	if config.EndpointHttpPort != nil {
 		rest, err = NewRestServer(config)
@@ -52,45 +86,107 @@ func NewServer(config *Configuration) (*Server, error) {
 		grpc:    grpc,
 		rest:    rest,
 		connect: conn,
+
+		drainPeriod:     drainPeriod,
+		shutdownTimeout: shutdownTimeout,
+		stop:            make(chan struct{}),
 	}, nil
 }
 
+// shutdownDuration is configured when set, else the environment's override,
+// else the rendered fallback.
+func shutdownDuration(configured time.Duration, env, fallback string) (time.Duration, error) {
+	if configured != 0 {
+		return configured, nil
+	}
+	value, ok := os.LookupEnv(env)
+	if !ok {
+		value = fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", env, err)
+	}
+	return duration, nil
+}
+
+// Start serves every listener until ctx is done or Stop is called, then shuts
+// them down: health turns NOT_SERVING, the listeners keep serving for the
+// drain period so load balancers route away, and requests in flight get the
+// shutdown timeout to finish before the listeners are closed. A listener that
+// fails stops the others at once. Start returns that failure, or nil after a
+// clean shutdown.
 func (server *Server) Start(ctx context.Context) error {
+	// Listeners outlive ctx until they are shut down, so requests in flight
+	// while draining still reach the gRPC listener.
+	serving := context.WithoutCancel(ctx)
+	group, failed := errgroup.WithContext(serving)
+	group.Go(func() error {
+		return server.grpc.Run(serving)
+	})
 	if server.rest != nil {
-		go func() {
-			err := server.rest.Run(ctx)
-			if err != nil {
-				panic(err)
-			}
-		}()
+		group.Go(func() error {
+			return server.rest.Run(serving)
+		})
 	}
 	if server.connect != nil {
-		go func() {
-			err := server.connect.Run(ctx)
-			if err != nil {
-				panic(err)
-			}
-		}()
+		group.Go(func() error {
+			return server.connect.Run(serving)
+		})
 	}
-	return server.grpc.Run(ctx)
+	group.Go(func() error {
+		drain := server.drainPeriod
+		select {
+		case <-ctx.Done():
+		case <-server.stop:
+		case <-failed.Done():
+			drain = 0
+		}
+		return server.shutdown(drain)
+	})
+	return group.Wait()
 }
 
+// Stop shuts a started server down as if its context were done. Start returns
+// once the shutdown completes.
 func (server *Server) Stop() {
+	server.stopOnce.Do(func() {
+		close(server.stop)
+	})
+}
+
+func (server *Server) shutdown(drain time.Duration) error {
 	fmt.Println("Stopping server...")
+	server.grpc.health.Shutdown()
+	time.Sleep(drain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), server.shutdownTimeout)
+	defer cancel()
+
+	// The HTTP listeners go first: their requests in flight are proxied to
+	// the gRPC listener, which finishes its own last.
+	var errs []error
 	if server.rest != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		if err := server.rest.Shutdown(ctx); err != nil {
-			fmt.Printf("failed to stop REST server: %v\n", err)
+			errs = append(errs, fmt.Errorf("failed to stop REST server: %w", err))
 		}
-		cancel()
 	}
 	if server.connect != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		if err := server.connect.Shutdown(ctx); err != nil {
-			fmt.Printf("failed to stop Connect server: %v\n", err)
+			errs = append(errs, fmt.Errorf("failed to stop Connect server: %w", err))
 		}
-		cancel()
 	}
-	server.grpc.health.Shutdown()
-	server.grpc.gRPC.GracefulStop()
+
+	stopped := make(chan struct{})
+	go func() {
+		server.grpc.gRPC.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.grpc.gRPC.Stop()
+		errs = append(errs, fmt.Errorf("gRPC requests still in flight after %s", server.shutdownTimeout))
+	}
+	return errors.Join(errs...)
 }
@@ -7,9 +7,12 @@ import (
 	"net/http"
 	"testing"
 	"time"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func TestServerStopReleasesHTTPListeners(t *testing.T) {
+	t.Setenv("CODEFLY_SHUTDOWN_DRAIN_PERIOD", "0s")
 	ports := unusedPorts(t, 3)
 	config := &Configuration{
 		EndpointGrpcPort:    ports[0],
@@ -43,6 +46,78 @@ func TestServerStopReleasesHTTPListeners(t *testing.T) {
 	}
 }
 
+func TestServerStartReturnsListenerFailures(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("occupy port: %v", err)
+	}
+	defer busy.Close()
+	ports := unusedPorts(t, 1)
+	config := &Configuration{
+		EndpointGrpcPort:    uint16(busy.Addr().(*net.TCPAddr).Port),
+		EndpointConnectPort: portPointer(ports[0]),
+		DrainPeriod:         time.Minute,
+	}
+	server, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start(context.Background())
+	}()
+	select {
+	case err := <-started:
+		if err == nil {
+			t.Fatal("Start returned nil although the gRPC port is taken")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a failed listener did not stop the server without draining")
+	}
+}
+
+func TestServerDrainsBeforeStopping(t *testing.T) {
+	ports := unusedPorts(t, 2)
+	config := &Configuration{
+		EndpointGrpcPort:    ports[0],
+		EndpointConnectPort: portPointer(ports[1]),
+		DrainPeriod:         300 * time.Millisecond,
+	}
+	server, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start(context.Background())
+	}()
+	url := fmt.Sprintf("http://127.0.0.1:%d/", *config.EndpointConnectPort)
+	waitForHTTP(t, url)
+	server.Stop()
+
+	// Draining, the listeners still answer while health is NOT_SERVING.
+	time.Sleep(100 * time.Millisecond)
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Connect listener closed while draining: %v", err)
+	}
+	response.Body.Close()
+	health, err := server.grpc.health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil || health.GetStatus() != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("health while draining = %v, %v; want NOT_SERVING", health.GetStatus(), err)
+	}
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("stop server: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop after draining")
+	}
+}
+
 func unusedPorts(t *testing.T, count int) []uint16 {
 	t.Helper()
 	listeners := make([]net.Listener, 0, count)
@@ -0,0 +1,103 @@
+package adapters
+
+/* -----------------------------------------------------------------
+
+⚠️ This code is generated by the agent. Do not edit this file!
+
+The `tls` block of service.codefly.yaml reaches the service through these
+variables: the codefly runtime points them at the declared files or at a
+certificate from its development CA, and the deployment at the mounted secret.
+
+----------------------------------------------------------------- */
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	TLSCertFileEnv   = "CODEFLY_TLS_CERT_FILE"
+	TLSKeyFileEnv    = "CODEFLY_TLS_KEY_FILE"
+	TLSCAFileEnv     = "CODEFLY_TLS_CA_FILE"
+	TLSClientAuthEnv = "CODEFLY_TLS_CLIENT_AUTH"
+)
+
+// TLS secures every listener. Loopback is what the REST gateway and the
+// Connect bridge present when they dial the gRPC listener.
+type TLS struct {
+	Server   *tls.Config
+	Loopback *tls.Config
+}
+
+// LoadTLS reads the TLS environment. Without a certificate it returns nil and
+// the listeners serve plaintext.
+func LoadTLS() (*TLS, error) {
+	certFile, keyFile := os.Getenv(TLSCertFileEnv), os.Getenv(TLSKeyFileEnv)
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	server := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	switch mode := os.Getenv(TLSClientAuthEnv); mode {
+	case "", "none":
+	case "request":
+		server.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		server.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("%s %q must be none, request or require", TLSClientAuthEnv, mode)
+	}
+	if caFile := os.Getenv(TLSCAFileEnv); caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA: %w", err)
+		}
+		server.ClientCAs = x509.NewCertPool()
+		if !server.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in TLS CA %s", caFile)
+		}
+	} else if server.ClientAuth != tls.NoClientCert {
+		return nil, fmt.Errorf("client certificate verification requires %s", TLSCAFileEnv)
+	}
+
+	// The gateway and the bridge dial this very process, so instead of
+	// checking names the loopback pins the listener's own certificate.
+	leaf := certificate.Certificate[0]
+	loopback := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) == 0 || !bytes.Equal(raw[0], leaf) {
+				return errors.New("loopback peer does not present the server certificate")
+			}
+			return nil
+		},
+	}
+	if server.ClientAuth == tls.RequireAndVerifyClientCert {
+		// The certificate must then be valid for client authentication too.
+		loopback.Certificates = []tls.Certificate{certificate}
+	}
+	return &TLS{Server: server, Loopback: loopback}, nil
+}
+
+// LoopbackCredentials are the transport credentials for dialing the gRPC
+// listener from inside the service.
+func (t *TLS) LoopbackCredentials() credentials.TransportCredentials {
+	if t == nil {
+		return insecure.NewCredentials()
+	}
+	return credentials.NewTLS(t.Loopback)
+}
@@ -0,0 +1,163 @@
+package adapters
+
+/* -----------------------------------------------------------------
+
+⚠️ This code is generated by the agent. Do not edit this file!
+
+Every message a handler receives is checked against its protovalidate rules
+before the handler runs, on the gRPC listener and at the Connect edge alike,
+so handlers do not need to call Validate themselves.
+
+----------------------------------------------------------------- */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"buf.build/go/protovalidate"
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var validator protovalidate.Validator
+
+func init() {
+	v, err := protovalidate.New()
+	if err != nil {
+		panic(fmt.Errorf("failed to create validator: %w", err))
+	}
+	validator = v
+}
+
+// Validate checks a request against its protovalidate rules. A violation is
+// an InvalidArgument status whose errdetails.BadRequest names each field at
+// fault and the rule it broke.
+func Validate(req proto.Message) error {
+	err := validator.Validate(req)
+	if err == nil {
+		return nil
+	}
+	var invalid *protovalidate.ValidationError
+	if !errors.As(err, &invalid) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range invalid.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       protovalidate.FieldPathString(violation.Proto.GetField()),
+			Description: violation.Proto.GetMessage(),
+			Reason:      violation.Proto.GetRuleId(),
+		})
+	}
+	st, detailErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(badRequest)
+	if detailErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return st.Err()
+}
+
+// validateResponse checks a message the service sends back. An invalid
+// response is the server's fault, so the caller gets Internal.
+func validateResponse(res proto.Message) error {
+	if err := validator.Validate(res); err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("invalid response: %v", err))
+	}
+	return nil
+}
+
+func validateMessage(m any, validate func(proto.Message) error) error {
+	if message, ok := m.(proto.Message); ok {
+		return validate(message)
+	}
+	return nil
+}
+
+// validationOptions installs the interceptors that validate every request a
+// gRPC handler receives and, with responses set, every response it returns
+// or sends.
+func validationOptions(responses bool) []grpc.ServerOption {
+	unary := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := validateMessage(req, Validate); err != nil {
+			return nil, err
+		}
+		res, err := handler(ctx, req)
+		if err != nil || !responses {
+			return res, err
+		}
+		if err := validateMessage(res, validateResponse); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	stream := func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingServerStream{ServerStream: ss, responses: responses})
+	}
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream)}
+}
+
+// validatingServerStream validates the messages of a streaming RPC as the
+// handler receives and, with responses set, sends them.
+type validatingServerStream struct {
+	grpc.ServerStream
+	responses bool
+}
+
+func (s *validatingServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateMessage(m, Validate)
+}
+
+func (s *validatingServerStream) SendMsg(m any) error {
+	if s.responses {
+		if err := validateMessage(m, validateResponse); err != nil {
+			return err
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// connectValidation rejects invalid Connect requests before they are bridged,
+// with the same InvalidArgument and field violations as the gRPC listener.
+// Responses come back through the gRPC listener, which validates them when
+// ValidateResponses is set.
+type connectValidation struct{}
+
+func (connectValidation) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if err := validateMessage(req.Any(), Validate); err != nil {
+			return nil, bridgeError(err, nil)
+		}
+		return next(ctx, req)
+	}
+}
+
+func (connectValidation) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (connectValidation) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return next(ctx, &validatingConnectConn{StreamingHandlerConn: conn})
+	}
+}
+
+type validatingConnectConn struct {
+	connect.StreamingHandlerConn
+}
+
+func (c *validatingConnectConn) Receive(m any) error {
+	if err := c.StreamingHandlerConn.Receive(m); err != nil {
+		return err
+	}
+	if err := validateMessage(m, Validate); err != nil {
+		return bridgeError(err, nil)
+	}
+	return nil
+}
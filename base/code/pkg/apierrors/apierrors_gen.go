@@ -0,0 +1,306 @@
+package apierrors
+
+/* -----------------------------------------------------------------
+
+⚠️ This code is generated by the agent. Do not edit this file!
+
+Errors returned by handlers reach gRPC, REST and Connect callers as the same
+status and google.rpc details: ErrorInfo names the failure, BadRequest the
+fields at fault and RetryInfo when to try again. Business code returns an
+*Error, or a sentinel declared once with Map:
+
+	var ErrWidgetNotFound = errors.New("widget not found")
+
+	apierrors.Map(ErrWidgetNotFound, codes.NotFound, "WIDGET_NOT_FOUND")
+
+	return nil, apierrors.NotFound("WIDGET_NOT_FOUND", "widget %s does not exist", id)
+
+----------------------------------------------------------------- */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain is the ErrorInfo domain of the service's errors.
+const Domain = "codefly-base"
+
+// RedactEnv turns redaction on when set to true, as deployments to production
+// environments do: the message of an Internal, Unknown or DataLoss error is
+// replaced by a generic one and only its ErrorInfo is kept, so causes never
+// reach callers.
+const RedactEnv = "CODEFLY_ERRORS_REDACT"
+
+// redactedMessage replaces the message of a redacted error.
+const redactedMessage = "internal error"
+
+var redact = os.Getenv(RedactEnv) == "true"
+
+// Error is a domain error with the status code callers see and the details
+// that explain it. Build one with New or a constructor named after its code.
+type Error struct {
+	code       codes.Code
+	reason     string
+	message    string
+	metadata   map[string]string
+	violations []*errdetails.BadRequest_FieldViolation
+	retryDelay time.Duration
+	cause      error
+}
+
+// New is an error with code, an UPPER_SNAKE_CASE reason identifying the
+// failure and a message for the caller.
+func New(code codes.Code, reason, format string, args ...any) *Error {
+	return &Error{code: code, reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// InvalidArgument and the constructors after it are New with the code they
+// are named after.
+func InvalidArgument(reason, format string, args ...any) *Error {
+	return New(codes.InvalidArgument, reason, format, args...)
+}
+
+func NotFound(reason, format string, args ...any) *Error {
+	return New(codes.NotFound, reason, format, args...)
+}
+
+func AlreadyExists(reason, format string, args ...any) *Error {
+	return New(codes.AlreadyExists, reason, format, args...)
+}
+
+func FailedPrecondition(reason, format string, args ...any) *Error {
+	return New(codes.FailedPrecondition, reason, format, args...)
+}
+
+func PermissionDenied(reason, format string, args ...any) *Error {
+	return New(codes.PermissionDenied, reason, format, args...)
+}
+
+func Unauthenticated(reason, format string, args ...any) *Error {
+	return New(codes.Unauthenticated, reason, format, args...)
+}
+
+func ResourceExhausted(reason, format string, args ...any) *Error {
+	return New(codes.ResourceExhausted, reason, format, args...)
+}
+
+func Unavailable(reason, format string, args ...any) *Error {
+	return New(codes.Unavailable, reason, format, args...)
+}
+
+func Internal(reason, format string, args ...any) *Error {
+	return New(codes.Internal, reason, format, args...)
+}
+
+// WithMetadata adds a key to the ErrorInfo metadata.
+func (e *Error) WithMetadata(key, value string) *Error {
+	if e.metadata == nil {
+		e.metadata = map[string]string{}
+	}
+	e.metadata[key] = value
+	return e
+}
+
+// WithFieldViolation names a request field at fault in the BadRequest detail.
+func (e *Error) WithFieldViolation(field, description string) *Error {
+	e.violations = append(e.violations, &errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+	return e
+}
+
+// WithRetryDelay tells the caller, through RetryInfo, when to try again.
+func (e *Error) WithRetryDelay(delay time.Duration) *Error {
+	e.retryDelay = delay
+	return e
+}
+
+// Wrap records the cause, kept for errors.Is and errors.As and never sent to
+// the caller.
+func (e *Error) Wrap(cause error) *Error {
+	e.cause = cause
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.cause == nil {
+		return e.message
+	}
+	return e.message + ": " + e.cause.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// GRPCStatus lets gRPC send the error with its details wherever it is
+// returned.
+func (e *Error) GRPCStatus() *status.Status {
+	return redacted(e.status())
+}
+
+func (e *Error) status() *status.Status {
+	st := status.New(e.code, e.message)
+	var details []protoadapt.MessageV1
+	if e.reason != "" {
+		details = append(details, &errdetails.ErrorInfo{Reason: e.reason, Domain: Domain, Metadata: e.metadata})
+	}
+	if len(e.violations) > 0 {
+		details = append(details, &errdetails.BadRequest{FieldViolations: e.violations})
+	}
+	if e.retryDelay > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(e.retryDelay)})
+	}
+	if len(details) == 0 {
+		return st
+	}
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+type mapping struct {
+	target error
+	code   codes.Code
+	reason string
+}
+
+var (
+	mappingsMu sync.RWMutex
+	mappings   []mapping
+)
+
+// Map declares the code and reason of a domain error: any error matching
+// target with errors.Is is sent that way, with its own message.
+func Map(target error, code codes.Code, reason string) {
+	mappingsMu.Lock()
+	defer mappingsMu.Unlock()
+	mappings = append(mappings, mapping{target: target, code: code, reason: reason})
+}
+
+func mapped(err error) (mapping, bool) {
+	mappingsMu.RLock()
+	defer mappingsMu.RUnlock()
+	for _, m := range mappings {
+		if errors.Is(err, m.target) {
+			return m, true
+		}
+	}
+	return mapping{}, false
+}
+
+// Status is the status callers see for err: an *Error with its details, a
+// mapped domain error, a context error, a gRPC status as is, and anything
+// else as Internal. Internal failures are redacted when RedactEnv is set.
+func Status(err error) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return redacted(apiErr.status())
+	}
+	if m, ok := mapped(err); ok {
+		return redacted(New(m.code, m.reason, "%s", err.Error()).status())
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	}
+	if st, ok := status.FromError(err); ok {
+		return redacted(st)
+	}
+	return redacted(status.New(codes.Internal, err.Error()))
+}
+
+func redacted(st *status.Status) *status.Status {
+	if !redact {
+		return st
+	}
+	switch st.Code() {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+	default:
+		return st
+	}
+	safe := status.New(st.Code(), redactedMessage)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if withInfo, err := safe.WithDetails(info); err == nil {
+				safe = withInfo
+			}
+		}
+	}
+	return safe
+}
+
+// Problem is an RFC 7807 application/problem+json body carrying a status and
+// its details as extension members.
+type Problem struct {
+	Type       string            `json:"type"`
+	Title      string            `json:"title"`
+	Status     int               `json:"status"`
+	Detail     string            `json:"detail,omitempty"`
+	Instance   string            `json:"instance,omitempty"`
+	Code       string            `json:"code"`
+	Reason     string            `json:"reason,omitempty"`
+	Domain     string            `json:"domain,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Violations []FieldViolation  `json:"violations,omitempty"`
+	// RetryAfter is RetryInfo's delay in seconds.
+	RetryAfter float64 `json:"retryAfter,omitempty"`
+}
+
+// FieldViolation is a BadRequest field violation in a Problem.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// ProblemContentType is the media type of a Problem.
+const ProblemContentType = "application/problem+json"
+
+// NewProblem renders st, answered with httpStatus for the request path
+// instance.
+func NewProblem(st *status.Status, httpStatus int, instance string) *Problem {
+	problem := &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(httpStatus),
+		Status:   httpStatus,
+		Detail:   st.Message(),
+		Instance: instance,
+		Code:     st.Code().String(),
+	}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			problem.Reason = detail.GetReason()
+			problem.Domain = detail.GetDomain()
+			problem.Metadata = detail.GetMetadata()
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				problem.Violations = append(problem.Violations, FieldViolation{
+					Field:       violation.GetField(),
+					Description: violation.GetDescription(),
+					Reason:      violation.GetReason(),
+				})
+			}
+		case *errdetails.RetryInfo:
+			problem.RetryAfter = detail.GetRetryDelay().AsDuration().Seconds()
+		}
+	}
+	return problem
+}
@@ -0,0 +1,74 @@
+package apierrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatusCarriesTheErrorDetails(t *testing.T) {
+	err := fmt.Errorf("load widget: %w", InvalidArgument("WIDGET_INVALID", "widget %s is invalid", "w1").
+		WithMetadata("widget", "w1").
+		WithFieldViolation("name", "must not be empty").
+		WithRetryDelay(2*time.Second))
+
+	st := Status(err)
+	if st.Code() != codes.InvalidArgument || st.Message() != "widget w1 is invalid" {
+		t.Fatalf("Status() = %v", st)
+	}
+	problem := NewProblem(st, http.StatusBadRequest, "/widgets/w1")
+	if problem.Reason != "WIDGET_INVALID" || problem.Domain != Domain || problem.Metadata["widget"] != "w1" {
+		t.Errorf("problem error info = %+v", problem)
+	}
+	if len(problem.Violations) != 1 || problem.Violations[0].Field != "name" || problem.RetryAfter != 2 {
+		t.Errorf("problem details = %+v", problem)
+	}
+	if problem.Title != "Bad Request" || problem.Code != "InvalidArgument" || problem.Instance != "/widgets/w1" {
+		t.Errorf("problem = %+v", problem)
+	}
+	// gRPC finds the details on the error itself.
+	if fromError, _ := status.FromError(err); len(fromError.Details()) != 3 {
+		t.Errorf("GRPCStatus details = %v", fromError.Details())
+	}
+}
+
+func TestStatusMapsDomainErrors(t *testing.T) {
+	errMissing := errors.New("widget not found")
+	Map(errMissing, codes.NotFound, "WIDGET_NOT_FOUND")
+
+	st := Status(fmt.Errorf("get w1: %w", errMissing))
+	if st.Code() != codes.NotFound || st.Message() != "get w1: widget not found" {
+		t.Fatalf("Status() = %v", st)
+	}
+	if info, ok := st.Details()[0].(*errdetails.ErrorInfo); !ok || info.GetReason() != "WIDGET_NOT_FOUND" {
+		t.Fatalf("details = %v", st.Details())
+	}
+	if st := Status(errors.New("boom")); st.Code() != codes.Internal {
+		t.Fatalf("unmapped error = %v", st)
+	}
+	if st := Status(status.Error(codes.Unavailable, "down")); st.Code() != codes.Unavailable || st.Message() != "down" {
+		t.Fatalf("status error = %v", st)
+	}
+}
+
+func TestStatusRedactsInternalErrors(t *testing.T) {
+	redact = true
+	t.Cleanup(func() { redact = false })
+
+	st := Status(Internal("DB_DOWN", "connect to 10.0.0.3: refused"))
+	if st.Message() != redactedMessage || len(st.Details()) != 1 {
+		t.Fatalf("redacted status = %v %v", st, st.Details())
+	}
+	if st := Status(errors.New("secret path /var/lib/x")); st.Message() != redactedMessage {
+		t.Fatalf("redacted plain error = %v", st)
+	}
+	if st := Status(NotFound("WIDGET_NOT_FOUND", "widget w1 does not exist")); st.Message() != "widget w1 does not exist" {
+		t.Fatalf("caller error was redacted: %v", st)
+	}
+}
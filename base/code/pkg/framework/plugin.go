@@ -2,6 +2,7 @@ package framework
 
 import (
 	"context"
+	"io/fs"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
@@ -19,7 +20,14 @@ type Plugin interface {
 	// RegisterREST registers the plugin's REST gateway handlers.
 	RegisterREST(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error
 
-	// Migrations returns an ordered list of SQL migration file paths.
-	// Return nil if the plugin has no migrations.
+	// Migrations returns an ordered list of SQL migration file paths within
+	// the plugin's MigrationFiles. Return nil if the plugin has no migrations.
 	Migrations() []string
 }
+
+// MigrationSource is implemented by plugins that declare migrations. The
+// files are read from MigrationFiles, not the working directory, so embed
+// them (embed.FS) for the built image to carry them.
+type MigrationSource interface {
+	MigrationFiles() fs.FS
+}
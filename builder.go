@@ -11,17 +11,18 @@ import (
 	"go/token"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"golang.org/x/mod/modfile"
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/imports"
+	protobuf "google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
 
-	"github.com/bufbuild/protocompile/ast"
-	"github.com/bufbuild/protocompile/parser"
-	"github.com/bufbuild/protocompile/reporter"
 	"github.com/codefly-dev/core/agents/communicate"
 	dockerhelpers "github.com/codefly-dev/core/agents/helpers/docker"
 	"github.com/codefly-dev/core/agents/services"
@@ -108,6 +109,10 @@ func (s *Builder) Load(ctx context.Context, req *builderv0.LoadRequest) (*builde
 		return resp, nil
 	}
 
+	if err := s.GoGrpc.recoverSync(); err != nil {
+		return s.Base.Builder.LoadError(err)
+	}
+
 	// Discover the protocol endpoints. gRPC is mandatory.
 	s.GoGrpc.GrpcEndpoint, err = resources.FindGRPCEndpoint(ctx, s.Endpoints)
 	if err != nil {
@@ -131,62 +136,254 @@ func (s *Builder) Sync(ctx context.Context, request *builderv0.SyncRequest) (*bu
 	defer s.Wool.Catch()
 	ctx = s.Wool.Inject(ctx)
 
-	if err := s.GoGrpc.Settings.Validate(); err != nil {
+	transaction, err := s.GoGrpc.stageSync(ctx)
+	if err != nil {
 		return s.Base.Builder.SyncError(err)
 	}
-	transaction, err := newSyncTransaction(s.Location, s.Identity.RelativeToWorkspace)
+	defer func() { _ = transaction.Close() }()
+
+	changed, err := transaction.ChangedFiles()
 	if err != nil {
 		return s.Base.Builder.SyncError(err)
 	}
-	defer func() { _ = transaction.Close() }()
+	// A dry-run shows how the files drifted, not only which: the patch is
+	// left in .codefly/ and summarized in the response.
+	var changes []syncChange
+	if request.GetDryRun() {
+		changes, err = transaction.Changes()
+		if err != nil {
+			return s.Base.Builder.SyncError(err)
+		}
+		if err := writeSyncPatch(s.Location, changes); err != nil {
+			return s.Base.Builder.SyncError(fmt.Errorf("write sync patch: %w", err))
+		}
+	} else if err := transaction.Apply(); err != nil {
+		return s.Base.Builder.SyncError(err)
+	}
+	if len(changed) == 0 || !request.GetDryRun() {
+		s.GoGrpc.recordSync(transaction)
+	}
+	response, err := s.Base.Builder.SyncResponse()
+	if err != nil {
+		return response, err
+	}
+	response.ChangedFiles = changed
+	if response.State != nil {
+		var message strings.Builder
+		if len(changes) > 0 {
+			message.WriteString(syncDryRunMessage(changes))
+		}
+		message.WriteString(s.GoGrpc.syncReport(transaction))
+		response.State.Message = message.String()
+	}
+	return response, nil
+}
+
+// stageSync stages every generator-owned artifact in a new transaction. Sync
+// and the proto command share it, so both produce the same tree; the caller
+// reports or applies the changes and closes the transaction.
+func (s *Service) stageSync(ctx context.Context) (*syncTransaction, error) {
+	if err := s.Settings.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.recoverSync(); err != nil {
+		return nil, err
+	}
+	inputs, err := s.syncInputs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := inputs.fingerprint(s.Location)
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := newSyncTransaction(s.Location, s.Identity.RelativeToWorkspace)
+	if err != nil {
+		return nil, err
+	}
+	// Unchanged inputs over untouched outputs generate the same tree: skip
+	// buf and the scaffolds, and hand back a transaction with nothing to do.
+	upToDate, err := syncUpToDate(s.Location, fingerprint)
+	if err != nil {
+		_ = transaction.Close()
+		return nil, err
+	}
+	if upToDate {
+		s.Wool.Debug("sync inputs unchanged, skipping generation")
+		return transaction, nil
+	}
+	if err := s.generateSync(ctx, transaction); err != nil {
+		_ = transaction.Close()
+		return nil, err
+	}
+	transaction.fingerprint = fingerprint
+	return transaction, nil
+}
 
+// syncInputs lists what generateSync reads: the proto tree with its buf
+// configuration and lock, the plugin manifest, the module's go.mod, the
+// rpcs.go stubs are appended to, the settings, the agent version (which pins
+// the embedded templates), the proto-breaking baseline and the endpoints of
+// the services it generates clients for.
+func (s *Service) syncInputs(ctx context.Context) (syncInputs, error) {
+	moduleRoot, _ := golanghelpers.SplitSourceDir(s.Settings.GoSourceDir())
+	protoDir := s.Settings.protocolSourceDir()
+	settings, err := yaml.Marshal(s.Settings)
+	if err != nil {
+		return syncInputs{}, err
+	}
+	information, err := yaml.Marshal(s.Information)
+	if err != nil {
+		return syncInputs{}, err
+	}
+	scaffoldTargets, err := generatedScaffoldTargets(s.Location, filepath.Join(s.Location, protoDir))
+	if err != nil {
+		return syncInputs{}, err
+	}
+	inputs := syncInputs{
+		Paths:   []string{protoDir, pluginManifestPath, filepath.Join(moduleRoot, "go.mod"), filepath.Join("code", "pkg", "adapters", rpcStubsFile)},
+		Exclude: s.Settings.protocolOutputDirs(),
+		Values: map[string][]byte{
+			"agent":       []byte(agent.Name + "@" + agent.Version),
+			"settings":    settings,
+			"information": information,
+			"scaffold":    []byte(strings.Join(scaffoldTargets, "\n")),
+			// A skipped generation skips the breaking check with it, so a
+			// moved baseline must count as a change.
+			"proto-baseline": protoBaselineIdentity(ctx, s.Location, s.Settings.ProtoBreaking.against()),
+		},
+	}
+	for _, dep := range s.Base.Service.ServiceDependencies {
+		ep, err := resources.FindGRPCEndpointFromService(ctx, dep, s.DependencyEndpoints)
+		if err != nil {
+			return syncInputs{}, err
+		}
+		if ep == nil {
+			continue
+		}
+		endpoint, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(ep)
+		if err != nil {
+			return syncInputs{}, err
+		}
+		inputs.Values["dependency "+dep.Unique()] = endpoint
+	}
+	return inputs, nil
+}
+
+// recoverSync finishes a Sync whose Apply the agent did not survive, before
+// anything reads the generated tree.
+func (s *Service) recoverSync() error {
+	phase, err := recoverSyncJournal(s.Location)
+	if err != nil {
+		return fmt.Errorf("recover interrupted sync: %w", err)
+	}
+	if phase != "" {
+		s.Wool.Warn("recovered an interrupted sync", wool.Field("phase", phase))
+	}
+	return nil
+}
+
+// recordSync remembers a sync that left the tree matching its stage, so the
+// next one can skip generation when nothing changed. Failing to is only a
+// lost shortcut.
+func (s *Service) recordSync(transaction *syncTransaction) {
+	if err := transaction.RecordState(); err != nil {
+		s.Wool.Warn("cannot record sync state", wool.ErrField(err))
+	}
+}
+
+func (s *Service) generateSync(ctx context.Context, transaction *syncTransaction) error {
 	// Protocol input and output paths are service-root-relative, not derived
 	// from the Go module root. This keeps the conventional proto/ + code/
 	// layout while allowing an explicit nested source directory for existing
 	// services. moduleRoot only scopes generated Go dependency stubs below.
-	moduleRoot, _ := golanghelpers.SplitSourceDir(s.GoGrpc.Settings.GoSourceDir())
-	protoDir := s.GoGrpc.Settings.protocolSourceDir()
+	moduleRoot, _ := golanghelpers.SplitSourceDir(s.Settings.GoSourceDir())
+	protoDir := s.Settings.protocolSourceDir()
+
+	// Refuse to generate code for a proto change that breaks the clients of
+	// the baseline, before anything is staged.
+	breaking, err := checkProtoBreaking(ctx, s.Location, protoDir, s.Settings.ProtoBreaking.against())
+	if err != nil {
+		return err
+	}
+	if breaking.breaking() {
+		if !s.Settings.ProtoBreaking.allowBreaking() {
+			return fmt.Errorf("%sset proto-breaking.allow-breaking to sync them anyway", breaking)
+		}
+		s.Wool.Warn("syncing breaking proto changes", wool.Field("report", breaking.String()))
+	}
+
 	if err := transaction.CopyInput(protoDir); err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
 	if err := redirectEscapingBufOutputs(transaction.StageRoot(), protoDir); err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
 
-	scaffoldTargets, err := generatedScaffoldTargets(s.Location, filepath.Join(s.Location, protoDir), s.Information.Service.Name.Title+"Service")
+	scaffoldTargets, err := generatedScaffoldTargets(s.Location, filepath.Join(s.Location, protoDir))
 	if err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
 	if len(scaffoldTargets) > 0 {
-		create := CreateConfiguration{Information: s.Information, Settings: s.GoGrpc.Settings, Envs: []string{}}
+		// plugins.yaml is user-owned input; registry_gen.go, one of the scaffold
+		// targets, is rendered from it so a dry-run reports registry drift.
+		plugins, err := loadPluginRegistry(s.Location, filepath.Join(s.Location, moduleRoot))
+		if err != nil {
+			return err
+		}
+		create := CreateConfiguration{Information: s.Information, Settings: s.Settings, Envs: []string{}, Plugins: plugins,
+			CorsOverridePrefix: corsOverridePrefix(s.Identity.Module, s.Identity.Name)}
+		// The adapters register, route and bridge every declared service.
+		// Method types are only needed by the Connect bridge.
+		create.Proto, err = loadProtoAPI(filepath.Join(s.Location, protoDir), s.Information.Service.Name.Title+"Service", s.Settings.ConnectEndpoint)
+		if err != nil {
+			return err
+		}
 		generated := services.WithFactory(factoryFS).
 			WithPathSelect(generatedScaffoldSelect()).
 			WithOverride(shared.OverrideAll()).
 			WithDestination("%s", transaction.StageRoot())
 		if err := s.Templates(ctx, create, generated); err != nil {
-			return s.Base.Builder.SyncError(err)
+			return err
+		}
+		// A target edited by hand is either left out of the transaction, or
+		// regenerated with the edited file staged beside it.
+		transaction.conflicts, err = scaffoldConflicts(s.Location, scaffoldTargets)
+		if err != nil {
+			return err
 		}
 		for _, target := range scaffoldTargets {
+			if slices.Contains(transaction.conflicts, target) {
+				if s.Settings.scaffoldConflicts() == scaffoldConflictKeep {
+					continue
+				}
+				if err := stageScaffoldOrig(transaction, target); err != nil {
+					return err
+				}
+			}
 			if err := transaction.TrackFile(target); err != nil {
-				return s.Base.Builder.SyncError(err)
+				return err
 			}
 		}
+		if err := s.stageRPCStubs(transaction, protoDir, scaffoldTargets); err != nil {
+			return err
+		}
 	}
 
 	bufRoot := filepath.Dir(filepath.Join(transaction.StageRoot(), protoDir))
 	buf, err := proto.NewBuf(ctx, bufRoot)
 	if err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
 	// Cache generation inputs outside the source tree but across transactions.
 	// A transaction-local cache disappears after every Sync, forcing repeated
 	// BSR requests even when proto inputs are unchanged.
 	generationCache := filepath.Join(s.Location, ".codefly", "cache")
 	if err := os.MkdirAll(generationCache, 0o755); err != nil {
-		return s.Base.Builder.SyncError(fmt.Errorf("create generation cache: %w", err))
+		return fmt.Errorf("create generation cache: %w", err)
 	}
 	buf.WithCache(generationCache)
-	for _, relative := range s.GoGrpc.Settings.protocolOutputDirs() {
+	for _, relative := range s.Settings.protocolOutputDirs() {
 		// Preserve the current generated tree in the transaction. On a cache
 		// hit Buf intentionally does no work; without this baseline the staged
 		// output would be absent and downstream formatting/comparison would
@@ -194,38 +391,38 @@ func (s *Builder) Sync(ctx context.Context, request *builderv0.SyncRequest) (*bu
 		actualOutput := filepath.Join(s.Location, relative)
 		if _, err := os.Lstat(actualOutput); err == nil {
 			if err := transaction.CopyInput(relative); err != nil {
-				return s.Base.Builder.SyncError(err)
+				return err
 			}
 		} else if !os.IsNotExist(err) {
-			return s.Base.Builder.SyncError(fmt.Errorf("stat generated output %q: %w", relative, err))
+			return fmt.Errorf("stat generated output %q: %w", relative, err)
 		}
 		if err := transaction.TrackDirectory(relative); err != nil {
-			return s.Base.Builder.SyncError(err)
+			return err
 		}
 		buf.WithGeneratedDirs(filepath.Join(transaction.StageRoot(), relative))
 	}
 	if err := transaction.TrackFile(filepath.Join(protoDir, "buf.lock")); err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
 	if err := buf.Generate(ctx); err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
 
 	s.Wool.Debug("dependencies", wool.Field("dependencies", s.Base.Service.ServiceDependencies))
 	for _, dep := range s.Base.Service.ServiceDependencies {
 		ep, err := resources.FindGRPCEndpointFromService(ctx, dep, s.DependencyEndpoints)
 		if err != nil {
-			return s.Base.Builder.SyncError(err)
+			return err
 		}
 		if ep == nil {
 			continue
 		}
 		destination := filepath.Join(moduleRoot, "external", dep.Unique())
 		if err := transaction.TrackDirectory(destination); err != nil {
-			return s.Base.Builder.SyncError(err)
+			return err
 		}
 		if err := proto.GenerateGRPC(ctx, languages.GO, filepath.Join(transaction.StageRoot(), destination), dep.Unique(), ep); err != nil {
-			return s.Base.Builder.SyncError(err)
+			return err
 		}
 	}
 
@@ -235,14 +432,14 @@ func (s *Builder) Sync(ctx context.Context, request *builderv0.SyncRequest) (*bu
 	// on the import path's last segment (v1), which never matches the package's
 	// own name (jobsv1). Resolve those references against the freshly generated
 	// tree and insert the missing imports before the goimports pass sorts them.
-	moduleImports := make([]string, 0, len(s.GoGrpc.Settings.protocolOutputDirs()))
-	for _, relative := range s.GoGrpc.Settings.protocolOutputDirs() {
+	moduleImports := make([]string, 0, len(s.Settings.protocolOutputDirs()))
+	for _, relative := range s.Settings.protocolOutputDirs() {
 		if relative == moduleRoot || pathContains(moduleRoot, relative) {
 			moduleImports = append(moduleImports, relative)
 		}
 	}
 	if err := addGeneratedCrossPackageImports(transaction.StageRoot(), filepath.Join(s.Location, moduleRoot, "go.mod"), moduleRoot, moduleImports); err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
 
 	// buf and the language plugins emit Go that the agent's own lint
@@ -252,24 +449,89 @@ func (s *Builder) Sync(ctx context.Context, request *builderv0.SyncRequest) (*bu
 	// byte-identical output — over the staged tree so generated code is
 	// lint-clean and sync-drift and lint agree on it.
 	if err := formatStagedGo(transaction.StageRoot()); err != nil {
-		return s.Base.Builder.SyncError(err)
+		return err
 	}
+	// Stamp the scaffold last, over its final content.
+	return stampStagedScaffold(transaction.StageRoot(), scaffoldTargets)
+}
 
-	changed, err := transaction.ChangedFiles()
+// stageRPCStubs appends a handler stub to the user-owned rpcs.go for every
+// RPC of the primary service GrpcServer has no method for, and notes the
+// handlers left without an RPC. Nothing already in rpcs.go is rewritten.
+func (s *Service) stageRPCStubs(transaction *syncTransaction, protoDir string, scaffoldTargets []string) error {
+	protoRoot := filepath.Join(s.Location, protoDir)
+	api, err := loadProtoAPI(protoRoot, s.Information.Service.Name.Title+"Service", true)
 	if err != nil {
-		return s.Base.Builder.SyncError(err)
+		// Stubs name every message type; the adapters themselves do not
+		// need to, so this is no reason to fail the sync.
+		s.Wool.Warn("cannot stub RPC handlers", wool.ErrField(err))
+		return nil
 	}
-	if !request.GetDryRun() {
-		if err := transaction.Apply(); err != nil {
-			return s.Base.Builder.SyncError(err)
-		}
+	index := slices.IndexFunc(api.Services, func(service protoService) bool { return service.Primary })
+	if index < 0 {
+		return nil
 	}
-	response, err := s.Base.Builder.SyncResponse()
+	declared, err := declaredProtoServices(protoRoot)
 	if err != nil {
-		return response, err
+		return err
 	}
-	response.ChangedFiles = changed
-	return response, nil
+	genImport, _ := splitGoPackage(declared[0].GoPackage)
+
+	// The generated adapters as this sync renders them, the user's files as
+	// they are.
+	adapters := filepath.Join("code", "pkg", "adapters")
+	generated := func(name string) bool { return slices.Contains(scaffoldTargets, filepath.Join(adapters, name)) }
+	methods := map[string]bool{}
+	if _, err := collectGrpcServerMethods(filepath.Join(transaction.StageRoot(), adapters), generated, methods); err != nil {
+		return err
+	}
+	handlers, err := collectGrpcServerMethods(filepath.Join(s.Location, adapters), func(name string) bool { return !generated(name) }, methods)
+	if err != nil {
+		return err
+	}
+	plan := planRPCStubs(api.Services[index], methods, handlers)
+	transaction.orphanRPCs = plan.Orphans
+	if len(plan.Missing) == 0 {
+		return nil
+	}
+
+	rpcs := filepath.Join(adapters, rpcStubsFile)
+	content, err := os.ReadFile(filepath.Join(s.Location, rpcs))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	stubbed, err := appendRPCStubs(content, genImport, api.Imports, plan.Missing)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(transaction.StageRoot(), rpcs), stubbed, 0o644); err != nil {
+		return err
+	}
+	for _, method := range plan.Missing {
+		transaction.stubbedRPCs = append(transaction.stubbedRPCs, method.Name)
+	}
+	return transaction.TrackFile(rpcs)
+}
+
+// syncReport is what Sync tells the user beyond the changed files: scaffold
+// conflicts, and the RPC handlers it stubbed or found orphaned.
+func (s *Service) syncReport(transaction *syncTransaction) string {
+	return formatScaffoldConflicts(transaction.conflicts, s.Settings.scaffoldConflicts()) +
+		formatRPCStubReport(transaction.stubbedRPCs, transaction.orphanRPCs)
+}
+
+// stageScaffoldOrig stages the hand-edited target as its .orig sibling, so
+// the edit survives the regeneration Apply swaps in.
+func stageScaffoldOrig(transaction *syncTransaction, target string) error {
+	content, err := os.ReadFile(filepath.Join(transaction.actualRoot, target))
+	if err != nil {
+		return err
+	}
+	orig := target + scaffoldOrigSuffix
+	if err := os.WriteFile(filepath.Join(transaction.StageRoot(), orig), content, 0o644); err != nil {
+		return err
+	}
+	return transaction.TrackFile(orig)
 }
 
 // formatStagedGo rewrites every staged .go file through the same goimports pass
@@ -485,14 +747,17 @@ type generatedScaffoldSelection struct{}
 
 func (generatedScaffoldSelection) Keep(name string) bool {
 	switch name {
-	case "code", "pkg", "adapters", "plugins", "main.go.tmpl":
+	case "code", "pkg", "adapters", "apierrors", "plugins", "main.go.tmpl":
 		return true
 	default:
 		return filepath.Ext(name) == ".tmpl" && filepath.Base(name) != "rpcs.go.tmpl" && bytes.HasSuffix([]byte(name), []byte("_gen.go.tmpl"))
 	}
 }
 
-func generatedScaffoldTargets(root, protoRoot, expectedService string) ([]string, error) {
+// generatedScaffoldTargets lists the adapter files Sync owns. A service is
+// scaffolded when main.go is still the generated one and every proto service
+// lives in one Go package, the gen package the adapters import.
+func generatedScaffoldTargets(root, protoRoot string) ([]string, error) {
 	mainPath := filepath.Join(root, "code", "main.go")
 	contents, err := os.ReadFile(mainPath)
 	if os.IsNotExist(err) {
@@ -508,59 +773,42 @@ func generatedScaffoldTargets(root, protoRoot, expectedService string) ([]string
 	if err != nil {
 		return nil, err
 	}
-	if len(services) != 1 || services[0] != expectedService {
+	if len(services) == 0 {
 		return nil, nil
 	}
+	genPath, _ := splitGoPackage(services[0].GoPackage)
+	for _, service := range services[1:] {
+		if importPath, _ := splitGoPackage(service.GoPackage); importPath != genPath {
+			return nil, nil
+		}
+	}
 	return []string{
 		filepath.Join("code", "main.go"),
+		filepath.Join("code", "pkg", "adapters", "accesslog_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "connect_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "cors_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "errors_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "grpc_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "migrations_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "rest_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "server_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "tls_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "validate_gen.go"),
+		filepath.Join("code", "pkg", "apierrors", "apierrors_gen.go"),
 		filepath.Join("code", "plugins", "registry_gen.go"),
 	}, nil
 }
 
-func declaredProtoServices(root string) ([]string, error) {
-	var services []string
-	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
-		if entry.IsDir() || filepath.Ext(path) != ".proto" {
-			return nil
-		}
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		node, parseErr := parser.Parse(path, file, reporter.NewHandler(nil))
-		closeErr := file.Close()
-		if parseErr != nil {
-			return parseErr
-		}
-		if closeErr != nil {
-			return closeErr
-		}
-		for _, declaration := range node.Decls {
-			if service, ok := declaration.(*ast.ServiceNode); ok {
-				services = append(services, service.Name.Val)
-			}
-		}
-		return nil
-	})
-	return services, err
-}
-
 // dockerTemplating extends the core DockerTemplating with the runtime assets
 // this repo's Dockerfile template copies into the final stage. Each entry is a
 // path relative to the Docker build context, which the template reproduces at
-// the same path under /app. The core struct has no field for them, so Build
+// the same path under /app. Ports are the container ports the image exposes,
+// one per enabled listener. The core struct has no field for them, so Build
 // renders with this superset instead of going through golanghelpers.BuildGoDocker.
 type dockerTemplating struct {
 	golanghelpers.DockerTemplating
 	RuntimeAssets []string
+	Ports         []uint16
 }
 
 // Build produces the service's Docker image. Uses a custom DockerTemplating
@@ -580,12 +828,14 @@ func (s *Builder) Build(ctx context.Context, req *builderv0.BuildRequest) (*buil
 		return s.Base.Builder.BuildError(err)
 	}
 	return buildGoDocker(ctx, s.Base.Builder, req, s.Location,
-		requirements, builderFS, GoVersion, AlpineVersion, assets, configure)
+		requirements, builderFS, GoVersion, AlpineVersion, assets,
+		s.GoGrpc.Settings.ContainerPorts().List(), configure)
 }
 
 // buildGoDocker mirrors golanghelpers.BuildGoDocker but renders the Dockerfile
 // with the local dockerTemplating superset so the final stage can copy runtime
-// assets. The core helper hardcodes its own struct, which carries no such field.
+// assets and expose the configured ports. The core helper hardcodes its own
+// struct, which carries no such fields.
 func buildGoDocker(
 	ctx context.Context,
 	builder *services.BuilderWrapper,
@@ -595,6 +845,7 @@ func buildGoDocker(
 	builderFS embed.FS,
 	goVersion, alpineVersion string,
 	assets []string,
+	ports []uint16,
 	opts ...func(*golanghelpers.DockerTemplating),
 ) (*builderv0.BuildResponse, error) {
 	w := wool.Get(ctx).In("go-grpc.buildGoDocker")
@@ -616,6 +867,7 @@ func buildGoDocker(
 			AlpineVersion: alpineVersion,
 		},
 		RuntimeAssets: assets,
+		Ports:         ports,
 	}
 	for _, opt := range opts {
 		opt(&templating.DockerTemplating)
@@ -800,13 +1052,114 @@ type DeploymentParameters struct {
 	ServiceAccount  *ServiceAccountSpec
 	RestEndpoint    bool
 	ConnectEndpoint bool
+	// TLS mounts the service's tls secret and points the listeners at it;
+	// nil leaves them plaintext.
+	TLS *DeploymentTLS
+	// RedactErrors sets CODEFLY_ERRORS_REDACT in the environment's ConfigMap:
+	// true when deploying to a production environment.
+	RedactErrors bool
+	// TerminationGracePeriodSeconds covers the service's shutdown drain and
+	// timeout; zero keeps the kubelet's 30s.
+	TerminationGracePeriodSeconds int
+	// Ports are the container ports of the enabled listeners; zero keeps a
+	// listener's standard port.
+	Ports DeploymentPorts
+	// Probes are the startup, readiness and liveness probes; zero probes the
+	// gRPC health server with the default timing.
+	Probes probePolicy
+	// Workload is the deployment block's own profile, rendered into the base;
+	// EnvironmentWorkload adds the deploying environment's overrides and is
+	// rendered into its overlay. Zero deploys the default resources.
+	Workload            deploymentPolicy
+	EnvironmentWorkload deploymentPolicy
+}
+
+// GRPCPort, RESTPort and ConnectPort are the container ports the templates
+// advertise and probe.
+func (p DeploymentParameters) GRPCPort() uint16 {
+	return portOrDefault(p.Ports.GRPC, defaultGRPCPort)
+}
+
+func (p DeploymentParameters) RESTPort() uint16 {
+	return portOrDefault(p.Ports.REST, defaultRESTPort)
+}
+
+func (p DeploymentParameters) ConnectPort() uint16 {
+	return portOrDefault(p.Ports.Connect, defaultConnectPort)
+}
+
+// BaseProfile and EnvironmentProfile are the workloads the base and the
+// overlay render.
+func (p DeploymentParameters) BaseProfile() deploymentPolicy {
+	return p.Workload.withDefaultResources()
+}
+
+func (p DeploymentParameters) EnvironmentProfile() deploymentPolicy {
+	return p.EnvironmentWorkload.withDefaultResources()
+}
+
+// PatchesDeployment reports whether the overlay patches the base Deployment.
+func (p DeploymentParameters) PatchesDeployment() bool {
+	return patchesDeployment(p.BaseProfile(), p.EnvironmentProfile())
+}
+
+// StartupProbe, ReadinessProbe and LivenessProbe are the probes the template
+// renders.
+func (p DeploymentParameters) StartupProbe() deploymentProbe {
+	return p.probe(p.probes().Startup)
+}
+
+func (p DeploymentParameters) ReadinessProbe() deploymentProbe {
+	return p.probe(p.probes().Readiness)
+}
+
+func (p DeploymentParameters) LivenessProbe() deploymentProbe {
+	return p.probe(p.probes().Liveness)
+}
+
+func (p DeploymentParameters) probes() probePolicy {
+	if p.Probes.Type == "" {
+		return defaultProbePolicy()
+	}
+	return p.Probes
+}
+
+func (p DeploymentParameters) probe(timing probeTiming) deploymentProbe {
+	return deploymentProbe{
+		probeTiming: timing,
+		Type:        p.probes().Type,
+		Port:        p.GRPCPort(),
+		HTTPS:       p.TLS != nil,
+	}
+}
+
+// DeploymentTLS is the tls block as the deployment applies it: the secret is
+// mounted at MountPath and ca.crt is only read when clients are verified.
+type DeploymentTLS struct {
+	Secret     string
+	MountPath  string
+	ClientAuth string
+}
+
+// deploymentTLS maps the tls block onto the deployment. Local cert and key
+// paths do not ship in the image, so a deployed TLS service needs a secret.
+func deploymentTLS(spec *TLSSpec) (*DeploymentTLS, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	if spec.Secret == "" {
+		return nil, fmt.Errorf("tls requires a secret to deploy: name the kubernetes.io/tls secret holding the listeners' certificate")
+	}
+	return &DeploymentTLS{Secret: spec.Secret, MountPath: tlsSecretMount, ClientAuth: spec.clientAuth()}, nil
 }
 
 // Deploy applies the k8s manifests in templates/deployment. It mirrors
 // golanghelpers.DeployGoKubernetes but threads the service-account spec and the
 // service's declared listeners into the templates so pods can run under an
 // annotated, workload-identity SA rather than the namespace default and so the
-// manifest advertises exactly the ports the service serves.
+// manifest advertises exactly the ports the service serves, on the ports the
+// environment's network mappings bind. With deployment-format helm it writes
+// the same deployment as a chart instead.
 func (s *Builder) Deploy(ctx context.Context, req *builderv0.DeploymentRequest) (*builderv0.DeploymentResponse, error) {
 	defer s.Wool.Catch()
 	ctx = s.Wool.Inject(ctx)
@@ -814,19 +1167,101 @@ func (s *Builder) Deploy(ctx context.Context, req *builderv0.DeploymentRequest)
 	if err := s.GoGrpc.Settings.Validate(); err != nil {
 		return s.Base.Builder.DeployError(err)
 	}
+	tls, err := deploymentTLS(s.GoGrpc.Settings.TLS)
+	if err != nil {
+		return s.Base.Builder.DeployError(err)
+	}
+	ports := s.GoGrpc.Settings.ContainerPorts()
+	err = checkNetworkMappings(ctx, req.NetworkMappings, []deploymentPort{
+		{name: "grpc", endpoint: s.GoGrpc.GrpcEndpoint, port: ports.GRPC},
+		{name: "rest", endpoint: s.GoGrpc.RestEndpoint, port: ports.REST},
+		{name: "connect", endpoint: s.GoGrpc.ConnectEndpoint, port: ports.Connect},
+	})
+	if err != nil {
+		return s.Base.Builder.DeployError(err)
+	}
+
+	params := DeploymentParameters{
+		ServiceAccount:  s.GoGrpc.Settings.ServiceAccount,
+		RestEndpoint:    s.GoGrpc.Settings.RestEndpoint,
+		ConnectEndpoint: s.GoGrpc.Settings.ConnectEndpoint,
+		TLS:             tls,
+		RedactErrors:    s.GoGrpc.Settings.RedactErrors(req.GetEnvironment().GetName()),
+
+		TerminationGracePeriodSeconds: s.GoGrpc.Settings.ShutdownPolicy().TerminationGracePeriodSeconds(),
+		Ports:                         ports,
+		Probes:                        s.GoGrpc.Settings.ProbePolicy(),
+		Workload:                      s.GoGrpc.Settings.DeploymentPolicy(""),
+		EnvironmentWorkload:           s.GoGrpc.Settings.DeploymentPolicy(req.GetEnvironment().GetName()),
+	}
+	if s.GoGrpc.Settings.DeploymentFormat == deploymentFormatHelm {
+		return s.deployHelm(ctx, req, params)
+	}
 
 	return s.Base.Builder.DeployKustomize(ctx, req, services.KustomizeDeployment{
 		EnvironmentVariables: s.EnvironmentVariables,
 		Templates:            deploymentFS,
 		Inputs:               services.ApplicationDeploymentInputs(),
-		Parameters: DeploymentParameters{
-			ServiceAccount:  s.GoGrpc.Settings.ServiceAccount,
-			RestEndpoint:    s.GoGrpc.Settings.RestEndpoint,
-			ConnectEndpoint: s.GoGrpc.Settings.ConnectEndpoint,
-		},
+		Parameters:           params,
 	})
 }
 
+// deployHelm writes the service's chart instead of applying the kustomize
+// manifests; the platform installs it with helm. The chart is linted before
+// it replaces the previous one.
+func (s *Builder) deployHelm(ctx context.Context, req *builderv0.DeploymentRequest, params DeploymentParameters) (*builderv0.DeploymentResponse, error) {
+	deployment, err := s.helmDeployment(ctx, req)
+	if err != nil {
+		return s.Base.Builder.DeployError(err)
+	}
+	policy := s.GoGrpc.Settings.HelmPolicy()
+	output := filepath.Join(s.Location, policy.Output)
+	chart := newHelmChart(s.Information.Service.Name.DNSCase, policy.ChartVersion, params, deployment)
+	if err := writeHelmChart(output, chart); err != nil {
+		return s.Base.Builder.DeployError(err)
+	}
+	s.Wool.Info("wrote helm chart", wool.Field("output", output))
+	return &builderv0.DeploymentResponse{}, nil
+}
+
+// helmDeployment reads from the request what DeployKustomize gives the
+// kustomize templates: the namespace, the image Build pushed and the
+// environment the pods read, configurations in the ConfigMap. Of the secrets
+// it keeps the names only, which the chart references in the Secret the
+// platform provisions: their values never reach the chart.
+func (s *Builder) helmDeployment(ctx context.Context, req *builderv0.DeploymentRequest) (helmDeployment, error) {
+	k8s, err := s.Base.Builder.KubernetesDeploymentRequest(ctx, req)
+	if err != nil {
+		return helmDeployment{}, s.Wool.Wrapf(err, "kubernetes deployment request")
+	}
+	image := s.Base.Builder.DockerImage(k8s.BuildContext)
+
+	if err := s.EnvironmentVariables.AddEndpoints(ctx, req.NetworkMappings, resources.NewContainerNetworkAccess()); err != nil {
+		return helmDeployment{}, s.Wool.Wrapf(err, "cannot add endpoints")
+	}
+	if err := s.EnvironmentVariables.AddConfigurations(ctx, req.Configuration); err != nil {
+		return helmDeployment{}, s.Wool.Wrapf(err, "cannot add configuration")
+	}
+	if err := s.EnvironmentVariables.AddConfigurations(ctx, req.DependenciesConfigurations...); err != nil {
+		return helmDeployment{}, s.Wool.Wrapf(err, "cannot add dependency configurations")
+	}
+	configMap, err := resources.EnvsAsConfigMapData(s.EnvironmentVariables.Configurations()...)
+	if err != nil {
+		return helmDeployment{}, s.Wool.Wrapf(err, "cannot build configmap data")
+	}
+	secrets, err := resources.EnvsAsSecretData(s.EnvironmentVariables.Secrets()...)
+	if err != nil {
+		return helmDeployment{}, s.Wool.Wrapf(err, "cannot build secret data")
+	}
+
+	return helmDeployment{
+		Namespace: k8s.Namespace,
+		Image:     helmImage{Repository: image.Name, Tag: image.Tag},
+		ConfigMap: configMap,
+		Secrets:   slices.Sorted(maps.Keys(secrets)),
+	}, nil
+}
+
 // CreateEndpoints materializes gRPC / REST / Connect Endpoint resources
 // from the proto and openapi descriptors scaffolded by Create.
 func (s *Builder) CreateEndpoints(ctx context.Context) error {
@@ -883,6 +1318,15 @@ type CreateConfiguration struct {
 	*services.Information
 	Settings *Settings
 	Envs     []string
+	// Plugins are the validated plugins.yaml entries registry_gen.go
+	// instantiates. Empty at Create: the factory manifest lists none.
+	Plugins []registeredPlugin
+	// Proto lists the declared services the adapters wire up. Methods are
+	// empty when connect-endpoint is disabled.
+	Proto protoAPI
+	// CorsOverridePrefix scopes cors_gen.go's runtime overrides to the
+	// service's own configuration.
+	CorsOverridePrefix string
 }
 
 // Create applies factory templates and creates the gRPC endpoint resources.
@@ -902,7 +1346,8 @@ func (s *Builder) Create(ctx context.Context, _ *builderv0.CreateRequest) (*buil
 		}
 	}
 
-	create := CreateConfiguration{Information: s.Information, Settings: s.GoGrpc.Settings, Envs: []string{}}
+	create := CreateConfiguration{Information: s.Information, Settings: s.GoGrpc.Settings, Envs: []string{}, Proto: defaultProtoAPI(s.Information.Service.Name.Title + "Service"),
+		CorsOverridePrefix: corsOverridePrefix(s.GoGrpc.Identity.Module, s.GoGrpc.Identity.Name)}
 	ignore := shared.NewIgnore("go.work*", "service.generation.codefly.yaml")
 	override := shared.OverrideException(shared.NewIgnore("*.proto"))
 
@@ -1010,3 +1455,8 @@ var builderFS embed.FS
 
 //go:embed templates/deployment
 var deploymentFS embed.FS
+
+// The all: prefix keeps the chart's _helpers.tpl.
+//
+//go:embed all:templates/helm
+var helmFS embed.FS
@@ -3,12 +3,19 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	agentv0 "github.com/codefly-dev/core/generated/go/codefly/services/agent/v0"
 	"github.com/codefly-dev/core/resources"
 	runners "github.com/codefly-dev/core/runners/base"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // registerCommands registers agent-specific commands.
@@ -17,33 +24,49 @@ import (
 func (s *Runtime) registerCommands() {
 	s.RegisterCommand(&agentv0.CommandDefinition{
 		Name:        "proto",
-		Description: "Regenerate protobuf Go code from .proto files via buf",
+		Description: "Regenerate the protocol code exactly as Sync does: buf over protocol-source-dir into protocol-output-dirs, plus the generated adapters, staged and swapped in as one unit. --dry-run lists the files that would change; --diff prints them as a unified diff. Neither touches the tree.",
+		Usage:       `proto [--dry-run | --diff]`,
 		Tags:        []string{"codegen", "proto"},
 		Aliases:     []string{"generate", "buf"},
 	}, s.cmdProto)
 
+	s.RegisterCommand(&agentv0.CommandDefinition{
+		Name:        "proto-breaking",
+		Description: "Compare the proto tree with a baseline and list the changes that break existing clients: removed or renumbered fields, changed types, removed or renamed RPCs and changed HTTP annotations. The baseline is the proto-breaking setting's (the stored .codefly/proto-baseline.binpb, else the last commit) unless --against=git|git:<revision>|baseline|<descriptor set> picks one; --update-baseline stores the current tree as the baseline.",
+		Usage:       `proto-breaking [--against=git:main] | proto-breaking --update-baseline`,
+		Tags:        []string{"proto", "diagnostic"},
+	}, s.cmdProtoBreaking)
+
 	s.RegisterCommand(&agentv0.CommandDefinition{
 		Name:        "health",
-		Description: "Check if the gRPC service is responding",
+		Description: "Check the running service: gRPC Health/Check for the server and each declared service, the REST /healthz route and the Connect listener, with latency. --watch[=<duration>] follows Health/Watch transitions instead (30s by default); --json prints structured results.",
+		Usage:       `health [--json] [--watch[=1m]]`,
 		Tags:        []string{"health", "diagnostic"},
 	}, s.cmdHealth)
 
-	// grpcurl family — introspect and invoke the running service's
-	// gRPC endpoint. All three use reflection over plaintext; if the
-	// service has TLS or reflection disabled, users can pass custom
-	// flags via `grpcurl` and override. Mode-consistent: runs in the
-	// plugin's active backend so the grpcurl binary's ability to reach
-	// the service matches the execution environment.
+	s.RegisterCommand(&agentv0.CommandDefinition{
+		Name:        "migrate",
+		Description: "Show (status) or apply (up) the SQL migrations declared by registered plugins, using the database the service's Configure hook provides.",
+		Usage:       `migrate status | migrate up`,
+		Tags:        []string{"database", "migrations"},
+	}, s.cmdMigrate)
+
+	// grpcurl family — introspect and invoke the running service's gRPC
+	// endpoint from inside the agent: no grpcurl binary is needed. The
+	// schema comes from server reflection or, when the server does not
+	// serve it, from the local proto tree. Calls use the service's TLS
+	// settings and accept -H "key: value" metadata and --deadline=<duration>.
 	s.RegisterCommand(&agentv0.CommandDefinition{
 		Name:        "grpcurl-list",
-		Description: "List gRPC services exposed by the running server (requires reflection).",
+		Description: "List the gRPC services exposed by the running server.",
+		Usage:       `grpcurl-list [-H "key: value"] [--deadline=5s]`,
 		Tags:        []string{"grpc", "introspect"},
 		Aliases:     []string{"grpc-list", "list-services"},
 	}, s.cmdGrpcurlList)
 
 	s.RegisterCommand(&agentv0.CommandDefinition{
 		Name:        "grpcurl-describe",
-		Description: "Describe a gRPC service or method. Pass the fully-qualified name as the first arg (e.g. `package.Service` or `package.Service.Method`). Without args, describes all services.",
+		Description: "Describe a gRPC service, method, message or enum. Pass the fully-qualified name as the first arg (e.g. `package.Service` or `package.Service.Method`). Without args, describes all services.",
 		Usage:       `grpcurl-describe my.package.MyService`,
 		Tags:        []string{"grpc", "introspect"},
 		Aliases:     []string{"grpc-describe"},
@@ -51,113 +74,289 @@ func (s *Runtime) registerCommands() {
 
 	s.RegisterCommand(&agentv0.CommandDefinition{
 		Name:        "grpcurl",
-		Description: "Invoke a gRPC method on the running server. Args: <method> [json-payload]. Plaintext + reflection; for custom flags edit the command or pipe directly.",
-		Usage:       `grpcurl my.package.MyService.MyMethod '{"field":"value"}'`,
+		Description: "Invoke a gRPC method on the running server. Args: <method> [json-payload | @file]; client and bidi streams take a JSON array or a sequence of JSON objects (e.g. an NDJSON file), and every response of a server stream is printed.",
+		Usage:       `grpcurl [-H "key: value"] [--deadline=5s] my.package.MyService.MyMethod '{"field":"value"}' | @requests.ndjson`,
 		Tags:        []string{"grpc", "invoke"},
 		Aliases:     []string{"grpc-invoke", "grpc-call"},
 	}, s.cmdGrpcurlInvoke)
 }
 
-func (s *Runtime) cmdProto(ctx context.Context, _ []string) (string, error) {
-	// Route `buf generate` through the plugin's active RunnerEnvironment
-	// (s.GoGrpc.Service.ActiveEnv) so proto compilation runs in the same
-	// mode (native/docker/nix) as the rest of the service — including
-	// the buf + protoc + language plugin subprocesses. Fallback to
-	// native when ActiveEnv is nil (pre-Init) so the command still works
-	// standalone.
-	protoDir := filepath.Clean(filepath.Join(s.Service.SourceLocation, "..", "proto"))
+func (s *Runtime) cmdProto(ctx context.Context, args []string) (string, error) {
+	var dryRun, diff bool
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run":
+			dryRun = true
+		case "--diff":
+			diff = true
+		default:
+			return "", fmt.Errorf("unknown proto argument %q (use --dry-run or --diff)", arg)
+		}
+	}
+	// The same staged pipeline as Builder.Sync, so the command never leaves
+	// output the sync-drift check would reject.
+	transaction, err := s.GoGrpc.stageSync(ctx)
+	if err != nil {
+		return "", fmt.Errorf("proto generation failed: %w", err)
+	}
+	defer func() { _ = transaction.Close() }()
+
+	changes, err := transaction.Changes()
+	if err != nil {
+		return "", err
+	}
+	report := s.GoGrpc.syncReport(transaction)
+	switch {
+	case diff:
+		return syncPatch(changes), nil
+	case len(changes) == 0:
+		s.GoGrpc.recordSync(transaction)
+		return "Generated code is up to date\n" + report, nil
+	case dryRun:
+		return fmt.Sprintf("%d file(s) would change:\n%s%s", len(changes), formatSyncChanges(changes), report), nil
+	}
+	if err := transaction.Apply(); err != nil {
+		return "", fmt.Errorf("proto generation failed: %w", err)
+	}
+	s.GoGrpc.recordSync(transaction)
+	return fmt.Sprintf("Regenerated %d file(s):\n%s%s", len(changes), formatSyncChanges(changes), report), nil
+}
+
+// cmdProtoBreaking runs the check Sync runs before generating code, and fails
+// the same way on breaking changes.
+func (s *Runtime) cmdProtoBreaking(ctx context.Context, args []string) (string, error) {
+	options, err := parseProtoBreakingArgs(args)
+	if err != nil {
+		return "", err
+	}
+	protoDir := s.GoGrpc.Settings.protocolSourceDir()
+	if options.updateBaseline {
+		count, err := writeProtoBaseline(s.Location, protoDir)
+		if err != nil {
+			return "", fmt.Errorf("cannot store the proto baseline: %w", err)
+		}
+		return fmt.Sprintf("Stored %d proto file(s) as the baseline in %s\n", count, protoBaselineFile), nil
+	}
+	against := options.against
+	if against == "" {
+		against = s.GoGrpc.Settings.ProtoBreaking.against()
+	}
+	report, err := checkProtoBreaking(ctx, s.Location, protoDir, against)
+	if err != nil {
+		return "", err
+	}
+	if report.breaking() {
+		return report.String(), fmt.Errorf("proto changes break clients of %s", report.Against)
+	}
+	return report.String(), nil
+}
+
+// cmdMigrate runs `go run . migrate <status|up>` in the Go source directory.
+// Migrations need the service's own database handle, which only its Configure
+// hook can build, so the generated main package serves the subcommand and the
+// agent supplies the same environment variables Start injects.
+func (s *Runtime) cmdMigrate(ctx context.Context, args []string) (string, error) {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		return "", fmt.Errorf("migrate requires one argument: status or up")
+	}
 	env := s.GoGrpc.Service.ActiveEnv
 	if env == nil {
-		native, nerr := runners.NewNativeEnvironment(ctx, protoDir)
+		native, nerr := runners.NewNativeEnvironment(ctx, s.Service.SourceLocation)
 		if nerr != nil {
 			return "", fmt.Errorf("cannot create runner environment: %w", nerr)
 		}
 		env = native
 	}
-	proc, err := env.NewProcess("buf", "generate")
+	proc, err := env.NewProcess("go", "run", ".", "migrate", args[0])
+	if err != nil {
+		return "", fmt.Errorf("cannot create migrate process: %w", err)
+	}
+	proc.WithDir(s.Service.SourceLocation)
+	envs, err := s.EnvironmentVariables.All()
 	if err != nil {
-		return "", fmt.Errorf("cannot create buf process: %w", err)
+		return "", fmt.Errorf("cannot get environment variables: %w", err)
 	}
-	proc.WithDir(protoDir)
+	proc.WithEnvironmentVariables(ctx, envs...)
 	var buf bytes.Buffer
 	proc.WithOutput(&buf)
 	if runErr := proc.Run(ctx); runErr != nil {
-		return buf.String(), fmt.Errorf("proto generation failed: %w", runErr)
+		return buf.String(), fmt.Errorf("migrate %s failed: %w", args[0], runErr)
 	}
-	return "Proto code regenerated successfully\n" + buf.String(), nil
+	return buf.String(), nil
 }
 
-func (s *Runtime) cmdHealth(_ context.Context, _ []string) (string, error) {
+// cmdHealth probes every listener of the running service. It fails when any
+// probe is not SERVING, so scripts can gate on it.
+func (s *Runtime) cmdHealth(ctx context.Context, args []string) (string, error) {
+	options, err := parseHealthArgs(args)
+	if err != nil {
+		return "", err
+	}
 	if s.runner == nil {
 		return "NOT RUNNING", nil
 	}
-	return "RUNNING", nil
+	conn, addr, tlsConfig, err := s.dialService(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	declared, err := declaredProtoServices(filepath.Join(s.Location, s.GoGrpc.Settings.protocolSourceDir()))
+	if err != nil {
+		return "", fmt.Errorf("cannot list declared services: %w", err)
+	}
+	services := make([]string, 0, len(declared))
+	for _, service := range declared {
+		services = append(services, service.FullName)
+	}
+
+	if options.watch > 0 {
+		watchCtx, cancel := context.WithTimeout(ctx, options.watch)
+		defer cancel()
+		return formatHealthTransitions(watchGRPCHealth(watchCtx, client, services), options.json)
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	results := checkGRPCHealth(checkCtx, client, addr, services)
+	httpClient := healthHTTPClient(tlsConfig)
+	if s.GoGrpc.Settings.RestEndpoint {
+		instance, err := resources.FindNetworkInstanceInNetworkMappings(ctx, s.NetworkMappings, s.GoGrpc.RestEndpoint, resources.NewNativeNetworkAccess())
+		if err != nil {
+			return "", fmt.Errorf("cannot resolve rest endpoint: %w", err)
+		}
+		results = append(results, checkHTTPHealth(checkCtx, httpClient, "rest", endpointURL(instance.Address, tlsConfig != nil, "/healthz"), true))
+	}
+	if s.GoGrpc.Settings.ConnectEndpoint {
+		instance, err := resources.FindNetworkInstanceInNetworkMappings(ctx, s.NetworkMappings, s.GoGrpc.ConnectEndpoint, resources.NewNativeNetworkAccess())
+		if err != nil {
+			return "", fmt.Errorf("cannot resolve connect endpoint: %w", err)
+		}
+		results = append(results, checkHTTPHealth(checkCtx, httpClient, "connect", endpointURL(instance.Address, tlsConfig != nil, "/"), false))
+	}
+
+	out, err := formatHealth(results, options.json)
+	if err != nil {
+		return "", err
+	}
+	if !healthy(results) {
+		return out, fmt.Errorf("service is not healthy")
+	}
+	return out, nil
 }
 
-// cmdGrpcurlList: `grpcurl -plaintext <addr> list`.
-func (s *Runtime) cmdGrpcurlList(ctx context.Context, _ []string) (string, error) {
-	return s.runGrpcurl(ctx, "list")
+// cmdGrpcurlList prints the services the server exposes, one per line.
+func (s *Runtime) cmdGrpcurlList(ctx context.Context, args []string) (string, error) {
+	options, positional, err := parseGrpcCallArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 0 {
+		return "", fmt.Errorf("grpcurl-list takes no arguments")
+	}
+	schema, conn, err := s.grpcSchema(ctx, options)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return strings.Join(schema.services, "\n") + "\n", nil
 }
 
-// cmdGrpcurlDescribe: `grpcurl -plaintext <addr> describe [target]`.
-// Without a target, describes all reflected services.
+// cmdGrpcurlDescribe prints a symbol, or every service, in proto syntax.
 func (s *Runtime) cmdGrpcurlDescribe(ctx context.Context, args []string) (string, error) {
-	extra := []string{"describe"}
-	if len(args) > 0 {
-		extra = append(extra, args[0])
+	options, positional, err := parseGrpcCallArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) > 1 {
+		return "", fmt.Errorf("grpcurl-describe takes at most one symbol")
+	}
+	schema, conn, err := s.grpcSchema(ctx, options)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	symbol := ""
+	if len(positional) == 1 {
+		symbol = positional[0]
 	}
-	return s.runGrpcurl(ctx, extra...)
+	return schema.describe(symbol)
 }
 
-// cmdGrpcurlInvoke: `grpcurl -plaintext -d <json> <addr> <method>`.
-// Accepts `<method>` or `<method> <json>`.
+// cmdGrpcurlInvoke calls a method with a JSON payload, given inline or as
+// @file, and prints the responses as JSON.
 func (s *Runtime) cmdGrpcurlInvoke(ctx context.Context, args []string) (string, error) {
-	if len(args) == 0 {
-		return "", fmt.Errorf("grpcurl invoke requires a method as the first argument (e.g. package.Service.Method)")
+	options, positional, err := parseGrpcCallArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		return "", fmt.Errorf("grpcurl invoke requires a method as the first argument (e.g. package.Service.Method) and an optional JSON payload")
+	}
+	payload := ""
+	if len(positional) == 2 {
+		payload, err = readGrpcPayload(s.Location, positional[1])
+		if err != nil {
+			return "", err
+		}
 	}
-	method := args[0]
-	extra := []string{}
-	if len(args) >= 2 {
-		extra = append(extra, "-d", args[1])
+	schema, conn, err := s.grpcSchema(ctx, options)
+	if err != nil {
+		return "", err
 	}
-	extra = append(extra, method)
-	return s.runGrpcurl(ctx, extra...)
+	defer conn.Close()
+	callCtx, cancel := options.context(ctx)
+	defer cancel()
+	var out bytes.Buffer
+	err = schema.invoke(callCtx, conn, positional[0], payload, &out)
+	return out.String(), err
 }
 
-// runGrpcurl builds `grpcurl -plaintext <host>:<port> <extraArgs...>` and
-// executes via the plugin's ActiveEnv — same mode (native/docker/nix)
-// as the service itself. Routes through NativeProc for pgid tracking
-// so an accidental Ctrl-C on the CLI doesn't orphan a stuck RPC.
-func (s *Runtime) runGrpcurl(ctx context.Context, extra ...string) (string, error) {
-	addr, err := s.grpcAddress(ctx)
+// grpcSchema connects to the running service and loads its schema. The
+// connection stays open for the caller.
+func (s *Runtime) grpcSchema(ctx context.Context, options grpcCallOptions) (*grpcSchema, *grpc.ClientConn, error) {
+	conn, _, _, err := s.dialService(ctx)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-	env := s.GoGrpc.Service.ActiveEnv
-	if env == nil {
-		native, nerr := runners.NewNativeEnvironment(ctx, s.Service.SourceLocation)
-		if nerr != nil {
-			return "", fmt.Errorf("cannot create runner environment: %w", nerr)
-		}
-		env = native
+	callCtx, cancel := options.context(ctx)
+	defer cancel()
+	schema, err := loadGrpcSchema(callCtx, conn, filepath.Join(s.Location, s.GoGrpc.Settings.protocolSourceDir()))
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("cannot load the gRPC schema: %w", err)
 	}
-	args := append([]string{"-plaintext", addr}, extra...)
-	proc, err := env.NewProcess("grpcurl", args...)
+	return schema, conn, nil
+}
+
+// dialService opens a client connection to the running service's gRPC
+// listener, over TLS when the service serves it. It also returns the address
+// and the TLS client configuration (nil for plaintext) for the HTTP probes.
+func (s *Runtime) dialService(ctx context.Context) (*grpc.ClientConn, string, *tls.Config, error) {
+	addr, err := s.grpcAddress(ctx)
 	if err != nil {
-		return "", fmt.Errorf("cannot create grpcurl process (is grpcurl installed?): %w", err)
+		return nil, "", nil, err
 	}
-	var buf bytes.Buffer
-	proc.WithOutput(&buf)
-	if runErr := proc.Run(ctx); runErr != nil {
-		return buf.String(), fmt.Errorf("grpcurl failed: %w", runErr)
+	tlsConfig, err := s.tls.clientConfig()
+	if err != nil {
+		return nil, "", nil, err
 	}
-	return buf.String(), nil
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("cannot create grpc client: %w", err)
+	}
+	return conn, addr, tlsConfig, nil
 }
 
 // grpcAddress resolves the running service's gRPC endpoint to a host:port
-// string for grpcurl. Returns an error if the service hasn't started yet
-// (no network mapping available) so users see a clear "start the service
-// first" hint instead of an obscure grpcurl error.
+// string for the client commands. Returns an error if the service hasn't
+// started yet (no network mapping available) so users see a clear "start the
+// service first" hint instead of an obscure connection error.
 func (s *Runtime) grpcAddress(ctx context.Context) (string, error) {
 	if s.runner == nil {
 		return "", fmt.Errorf("service is not running — start it first")
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// CorsSpec configures the CORS policy of the REST gateway and Connect
+// listeners. Sync renders it into the generated cors_gen.go; each field can be
+// overridden per environment at runtime through the service's `cors`
+// configuration (ALLOWED_ORIGINS, ALLOWED_METHODS, ALLOWED_HEADERS,
+// EXPOSED_HEADERS as comma-separated lists, ALLOW_CREDENTIALS, MAX_AGE).
+//
+// An origin is either "*" alone or scheme://host[:port], where the host may
+// start with "*." to match every subdomain (https://*.example.com).
+type CorsSpec struct {
+	AllowedOrigins   []string `yaml:"allowed-origins"`
+	AllowedMethods   []string `yaml:"allowed-methods,omitempty"`
+	AllowedHeaders   []string `yaml:"allowed-headers,omitempty"`
+	ExposedHeaders   []string `yaml:"exposed-headers,omitempty"`
+	AllowCredentials bool     `yaml:"allow-credentials,omitempty"`
+	// MaxAge is how long, in seconds, browsers may cache a preflight result.
+	MaxAge int `yaml:"max-age,omitempty"`
+}
+
+// defaultCorsPolicy is the policy of a service without a cors block: every
+// origin, the usual REST methods and any header, without credentials. It keeps
+// development frictionless; production services should declare their origins.
+func defaultCorsPolicy() CorsSpec {
+	return CorsSpec{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+	}
+}
+
+// CorsPolicy is the effective policy the cors_gen.go template renders: the
+// declared block with unset methods and headers taken from the default.
+func (s *Settings) CorsPolicy() CorsSpec {
+	policy := defaultCorsPolicy()
+	if s.Cors == nil {
+		return policy
+	}
+	declared := *s.Cors
+	if len(declared.AllowedMethods) == 0 {
+		declared.AllowedMethods = policy.AllowedMethods
+	}
+	if len(declared.AllowedHeaders) == 0 {
+		declared.AllowedHeaders = policy.AllowedHeaders
+	}
+	return declared
+}
+
+// corsOverridePrefix is the name, minus the key, of the environment variables
+// codefly injects for the service's own `cors` configuration. Dependencies'
+// configurations are injected too, so the overrides must match this module and
+// service exactly rather than any __CORS__ suffix.
+func corsOverridePrefix(module, service string) string {
+	name := strings.Join([]string{"CODEFLY", "SERVICE_CONFIGURATION", module, service, "CORS", ""}, "__")
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// httpToken matches an RFC 9110 token, the grammar of method and header names.
+var httpToken = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// Validate rejects a cors block browsers would refuse or that would silently
+// widen access: a credentialed wildcard origin makes rs/cors reflect any
+// caller's Origin, granting every site authenticated access.
+func (c *CorsSpec) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if len(c.AllowedOrigins) == 0 {
+		return fmt.Errorf("cors requires allowed-origins when set")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if len(c.AllowedOrigins) > 1 {
+				return fmt.Errorf("cors origin \"*\" must be the only allowed origin")
+			}
+			if c.AllowCredentials {
+				return fmt.Errorf("cors allow-credentials cannot be combined with the \"*\" origin")
+			}
+			continue
+		}
+		if err := validateCorsOrigin(origin); err != nil {
+			return err
+		}
+	}
+	for _, method := range c.AllowedMethods {
+		if !httpToken.MatchString(method) || strings.ToUpper(method) != method {
+			return fmt.Errorf("cors method %q must be an upper-case HTTP method", method)
+		}
+	}
+	for _, header := range append(append([]string(nil), c.AllowedHeaders...), c.ExposedHeaders...) {
+		if !httpToken.MatchString(header) {
+			return fmt.Errorf("cors header %q is not a valid HTTP header name", header)
+		}
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("cors max-age must not be negative (got %d)", c.MaxAge)
+	}
+	return nil
+}
+
+func validateCorsOrigin(origin string) error {
+	parsed, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("cors origin %q must be scheme://host[:port]", origin)
+	}
+	if parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return fmt.Errorf("cors origin %q must not carry a path, query or credentials", origin)
+	}
+	if strings.Contains(parsed.Host, "*") {
+		return fmt.Errorf("cors origin %q may only use a leading \"*.\" subdomain wildcard", origin)
+	}
+	return nil
+}
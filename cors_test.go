@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCorsPolicyDefaultsToPermissiveWithoutCredentials(t *testing.T) {
+	var settings Settings
+	if got, want := settings.CorsPolicy(), defaultCorsPolicy(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("CorsPolicy() = %#v, want %#v", got, want)
+	}
+
+	settings.Cors = &CorsSpec{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}
+	got := settings.CorsPolicy()
+	if !reflect.DeepEqual(got.AllowedOrigins, []string{"https://app.example.com"}) || !got.AllowCredentials {
+		t.Fatalf("CorsPolicy() dropped the declared policy: %#v", got)
+	}
+	if !reflect.DeepEqual(got.AllowedMethods, defaultCorsPolicy().AllowedMethods) {
+		t.Fatalf("CorsPolicy() methods = %v, want the defaults", got.AllowedMethods)
+	}
+}
+
+func TestCorsSpecValidate(t *testing.T) {
+	tests := map[string]struct {
+		spec CorsSpec
+		want string
+	}{
+		"explicit origins":     {CorsSpec{AllowedOrigins: []string{"https://app.example.com", "http://localhost:3000"}, AllowCredentials: true, MaxAge: 600}, ""},
+		"subdomain wildcard":   {CorsSpec{AllowedOrigins: []string{"https://*.example.com"}}, ""},
+		"wildcard":             {CorsSpec{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Request-Id"}}, ""},
+		"no origins":           {CorsSpec{}, "requires allowed-origins"},
+		"credentialed *":       {CorsSpec{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "cannot be combined"},
+		"* among origins":      {CorsSpec{AllowedOrigins: []string{"*", "https://app.example.com"}}, "only allowed origin"},
+		"missing scheme":       {CorsSpec{AllowedOrigins: []string{"app.example.com"}}, "scheme://host"},
+		"ftp scheme":           {CorsSpec{AllowedOrigins: []string{"ftp://app.example.com"}}, "scheme://host"},
+		"path":                 {CorsSpec{AllowedOrigins: []string{"https://app.example.com/ui"}}, "must not carry"},
+		"inner wildcard":       {CorsSpec{AllowedOrigins: []string{"https://app.*.example.com"}}, "leading"},
+		"lower-case method":    {CorsSpec{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"get"}}, "upper-case"},
+		"invalid header":       {CorsSpec{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"X Bad"}}, "not a valid HTTP header"},
+		"invalid exposed":      {CorsSpec{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X:Bad"}}, "not a valid HTTP header"},
+		"negative max-age":     {CorsSpec{AllowedOrigins: []string{"*"}, MaxAge: -1}, "max-age"},
+		"header wildcard okay": {CorsSpec{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}}, ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.spec.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCorsSpecValidateAllowsNil(t *testing.T) {
+	var spec *CorsSpec
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("nil cors block: %v", err)
+	}
+}
+
+func TestCorsOverridePrefixNamesTheServiceConfiguration(t *testing.T) {
+	if got, want := corsOverridePrefix("billing-app", "api-gateway"), "CODEFLY__SERVICE_CONFIGURATION__BILLING_APP__API_GATEWAY__CORS__"; got != want {
+		t.Fatalf("corsOverridePrefix() = %q, want %q", got, want)
+	}
+}
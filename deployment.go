@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+// DeploymentSpec sizes and schedules the service's pods: the Deployment's
+// replicas and container resources, a HorizontalPodAutoscaler, a
+// PodDisruptionBudget and topology spread constraints. Environments overrides
+// them per codefly environment.
+//
+// The base manifests render the Deployment of the profile itself. The
+// environment's overlay renders the autoscaler and disruption budget it runs
+// with, and patches the Deployment where the environment overrides it.
+type DeploymentSpec struct {
+	DeploymentProfile `yaml:",inline"`
+	Environments      map[string]*DeploymentProfile `yaml:"environments,omitempty"`
+}
+
+// DeploymentProfile is one set of workload settings. In an environment, a set
+// field replaces the base one, resources quantity by quantity, and an empty
+// autoscaling or disruption-budget block ({}) turns it off.
+type DeploymentProfile struct {
+	// Replicas is the Deployment's replica count when it is not autoscaled.
+	// Zero keeps the count codefly deploys with.
+	Replicas         int                   `yaml:"replicas,omitempty"`
+	Resources        *ResourcesSpec        `yaml:"resources,omitempty"`
+	Autoscaling      *AutoscalingSpec      `yaml:"autoscaling,omitempty"`
+	DisruptionBudget *DisruptionBudgetSpec `yaml:"disruption-budget,omitempty"`
+	TopologySpread   []TopologySpreadSpec  `yaml:"topology-spread,omitempty"`
+}
+
+// ResourcesSpec is the container's requests and limits, as Kubernetes
+// quantities such as "250m" or "256Mi".
+type ResourcesSpec struct {
+	Requests ResourceQuantities `yaml:"requests,omitempty"`
+	Limits   ResourceQuantities `yaml:"limits,omitempty"`
+}
+
+type ResourceQuantities struct {
+	CPU    string `yaml:"cpu,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+}
+
+// AutoscalingSpec scales the Deployment between MinReplicas and MaxReplicas
+// to hold the average CPU or memory utilization, as a percentage of the
+// requests, and the per-pod average of custom metrics.
+type AutoscalingSpec struct {
+	MinReplicas int             `yaml:"min-replicas,omitempty"`
+	MaxReplicas int             `yaml:"max-replicas,omitempty"`
+	CPU         int             `yaml:"cpu,omitempty"`
+	Memory      int             `yaml:"memory,omitempty"`
+	Metrics     []PodMetricSpec `yaml:"metrics,omitempty"`
+}
+
+// PodMetricSpec targets a custom metric served by the cluster's metrics
+// adapter, such as grpc_requests_per_second, averaged over the pods.
+type PodMetricSpec struct {
+	Name         string `yaml:"name"`
+	AverageValue string `yaml:"average-value"`
+}
+
+// DisruptionBudgetSpec bounds voluntary disruptions, such as node drains:
+// set one of MinAvailable and MaxUnavailable, a count or a percentage.
+type DisruptionBudgetSpec struct {
+	MinAvailable   string `yaml:"min-available,omitempty"`
+	MaxUnavailable string `yaml:"max-unavailable,omitempty"`
+}
+
+// TopologySpreadSpec spreads the pods across the values of a node label,
+// such as topology.kubernetes.io/zone.
+type TopologySpreadSpec struct {
+	TopologyKey string `yaml:"topology-key"`
+	// MaxSkew defaults to 1.
+	MaxSkew int `yaml:"max-skew,omitempty"`
+	// WhenUnsatisfiable is ScheduleAnyway (the default) or DoNotSchedule.
+	WhenUnsatisfiable string `yaml:"when-unsatisfiable,omitempty"`
+}
+
+// The container resources when none are declared.
+var defaultResources = ResourcesSpec{
+	Requests: ResourceQuantities{CPU: "100m", Memory: "128Mi"},
+	Limits:   ResourceQuantities{CPU: "1", Memory: "512Mi"},
+}
+
+// deploymentPolicy is a profile with the defaults applied, as the templates
+// render it.
+type deploymentPolicy struct {
+	Replicas         int
+	Resources        ResourcesSpec
+	Autoscaling      *AutoscalingSpec
+	DisruptionBudget *DisruptionBudgetSpec
+	TopologySpread   []TopologySpreadSpec
+}
+
+// DeploymentPolicy is the workload of an environment: the base profile with
+// the environment's overrides. An empty environment is the base profile.
+func (s *Settings) DeploymentPolicy(environment string) deploymentPolicy {
+	policy := deploymentPolicy{Resources: defaultResources}
+	if s.Deployment == nil {
+		return policy
+	}
+	policy = policy.with(&s.Deployment.DeploymentProfile)
+	if environment != "" {
+		policy = policy.with(s.Deployment.Environments[environment])
+	}
+	return policy
+}
+
+func (w deploymentPolicy) with(profile *DeploymentProfile) deploymentPolicy {
+	if profile == nil {
+		return w
+	}
+	if profile.Replicas != 0 {
+		w.Replicas = profile.Replicas
+	}
+	if r := profile.Resources; r != nil {
+		w.Resources.Requests = w.Resources.Requests.with(r.Requests)
+		w.Resources.Limits = w.Resources.Limits.with(r.Limits)
+	}
+	if profile.Autoscaling != nil {
+		w.Autoscaling = profile.Autoscaling
+		if profile.Autoscaling.off() {
+			w.Autoscaling = nil
+		}
+	}
+	if profile.DisruptionBudget != nil {
+		w.DisruptionBudget = profile.DisruptionBudget
+		if *profile.DisruptionBudget == (DisruptionBudgetSpec{}) {
+			w.DisruptionBudget = nil
+		}
+	}
+	if profile.TopologySpread != nil {
+		w.TopologySpread = make([]TopologySpreadSpec, len(profile.TopologySpread))
+		for i, spread := range profile.TopologySpread {
+			if spread.MaxSkew == 0 {
+				spread.MaxSkew = 1
+			}
+			if spread.WhenUnsatisfiable == "" {
+				spread.WhenUnsatisfiable = "ScheduleAnyway"
+			}
+			w.TopologySpread[i] = spread
+		}
+	}
+	return w
+}
+
+func (q ResourceQuantities) with(override ResourceQuantities) ResourceQuantities {
+	if override.CPU != "" {
+		q.CPU = override.CPU
+	}
+	if override.Memory != "" {
+		q.Memory = override.Memory
+	}
+	return q
+}
+
+// withDefaultResources fills the resources of a zero policy.
+func (w deploymentPolicy) withDefaultResources() deploymentPolicy {
+	if w.Resources == (ResourcesSpec{}) {
+		w.Resources = defaultResources
+	}
+	return w
+}
+
+// off reports an empty autoscaling block, which turns autoscaling off.
+func (a *AutoscalingSpec) off() bool {
+	return a.MinReplicas == 0 && a.MaxReplicas == 0 && a.CPU == 0 && a.Memory == 0 && len(a.Metrics) == 0
+}
+
+// Validate rejects malformed profiles, then checks the workload of every
+// environment as a whole.
+func (w *DeploymentSpec) Validate() error {
+	if w == nil {
+		return nil
+	}
+	if err := w.DeploymentProfile.validate("deployment"); err != nil {
+		return err
+	}
+	for environment, profile := range w.Environments {
+		if profile == nil {
+			continue
+		}
+		if err := profile.validate(fmt.Sprintf("deployment environments %s", environment)); err != nil {
+			return err
+		}
+	}
+	settings := &Settings{Deployment: w}
+	if err := settings.DeploymentPolicy("").validate("deployment"); err != nil {
+		return err
+	}
+	for environment := range w.Environments {
+		if err := settings.DeploymentPolicy(environment).validate(fmt.Sprintf("deployment environments %s", environment)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceQuantity is a Kubernetes quantity without an exponent.
+var resourceQuantity = regexp.MustCompile(`^([0-9]+(\.[0-9]*)?|\.[0-9]+)(m|k|M|G|T|P|E|Ki|Mi|Gi|Ti|Pi|Ei)?$`)
+
+// countOrPercent is a replica count or a percentage of the replicas.
+var countOrPercent = regexp.MustCompile(`^[0-9]+%?$`)
+
+// metricName is a custom metric as a metrics adapter serves it.
+var metricName = regexp.MustCompile(`^[A-Za-z_:][A-Za-z0-9_:.\-/]*$`)
+
+// topologyKey is a node label key, with an optional DNS prefix.
+var topologyKey = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+func (p *DeploymentProfile) validate(name string) error {
+	if p.Replicas < 0 {
+		return fmt.Errorf("%s replicas must not be negative (got %d)", name, p.Replicas)
+	}
+	if r := p.Resources; r != nil {
+		for _, quantity := range []struct {
+			key   string
+			value string
+		}{
+			{"requests cpu", r.Requests.CPU},
+			{"requests memory", r.Requests.Memory},
+			{"limits cpu", r.Limits.CPU},
+			{"limits memory", r.Limits.Memory},
+		} {
+			if quantity.value != "" && !resourceQuantity.MatchString(quantity.value) {
+				return fmt.Errorf("%s resources %s %q is not a Kubernetes quantity", name, quantity.key, quantity.value)
+			}
+		}
+	}
+	if a := p.Autoscaling; a != nil {
+		if a.MinReplicas < 0 || a.MaxReplicas < 0 || a.CPU < 0 || a.Memory < 0 {
+			return fmt.Errorf("%s autoscaling replicas and targets must not be negative", name)
+		}
+		for _, metric := range a.Metrics {
+			if !metricName.MatchString(metric.Name) {
+				return fmt.Errorf("%s autoscaling metric name %q is not a metric name", name, metric.Name)
+			}
+			if !resourceQuantity.MatchString(metric.AverageValue) {
+				return fmt.Errorf("%s autoscaling metric %s average-value %q is not a Kubernetes quantity", name, metric.Name, metric.AverageValue)
+			}
+		}
+	}
+	if b := p.DisruptionBudget; b != nil {
+		if b.MinAvailable != "" && b.MaxUnavailable != "" {
+			return fmt.Errorf("%s disruption-budget sets both min-available and max-unavailable: choose one", name)
+		}
+		for _, value := range []string{b.MinAvailable, b.MaxUnavailable} {
+			if value != "" && !countOrPercent.MatchString(value) {
+				return fmt.Errorf("%s disruption-budget %q must be a count or a percentage", name, value)
+			}
+		}
+	}
+	for _, spread := range p.TopologySpread {
+		if len(spread.TopologyKey) > 316 || !topologyKey.MatchString(spread.TopologyKey) {
+			return fmt.Errorf("%s topology-spread key %q is not a label key", name, spread.TopologyKey)
+		}
+		if spread.MaxSkew < 0 {
+			return fmt.Errorf("%s topology-spread %s max-skew must not be negative (got %d)", name, spread.TopologyKey, spread.MaxSkew)
+		}
+		switch spread.WhenUnsatisfiable {
+		case "", "ScheduleAnyway", "DoNotSchedule":
+		default:
+			return fmt.Errorf("%s topology-spread %s when-unsatisfiable %q must be ScheduleAnyway or DoNotSchedule", name, spread.TopologyKey, spread.WhenUnsatisfiable)
+		}
+	}
+	return nil
+}
+
+// validate rejects a workload the cluster would refuse or could never
+// satisfy: requests above limits, an autoscaler without bounds or targets, and
+// a disruption budget that blocks every eviction.
+func (w deploymentPolicy) validate(name string) error {
+	for _, resource := range []struct {
+		key            string
+		request, limit string
+	}{
+		{"cpu", w.Resources.Requests.CPU, w.Resources.Limits.CPU},
+		{"memory", w.Resources.Requests.Memory, w.Resources.Limits.Memory},
+	} {
+		if resource.request == "" || resource.limit == "" {
+			continue
+		}
+		request, err := parseQuantity(resource.request)
+		if err != nil {
+			return fmt.Errorf("%s resources requests %s: %w", name, resource.key, err)
+		}
+		limit, err := parseQuantity(resource.limit)
+		if err != nil {
+			return fmt.Errorf("%s resources limits %s: %w", name, resource.key, err)
+		}
+		if request > limit {
+			return fmt.Errorf("%s resources requests %s %s exceeds its limit %s", name, resource.key, resource.request, resource.limit)
+		}
+	}
+	replicas := w.Replicas
+	if a := w.Autoscaling; a != nil {
+		if a.MinReplicas < 1 || a.MaxReplicas < a.MinReplicas {
+			return fmt.Errorf("%s autoscaling needs 1 <= min-replicas <= max-replicas (got %d and %d)", name, a.MinReplicas, a.MaxReplicas)
+		}
+		if a.CPU == 0 && a.Memory == 0 && len(a.Metrics) == 0 {
+			return fmt.Errorf("%s autoscaling needs a cpu, memory or custom metric target", name)
+		}
+		replicas = a.MinReplicas
+	}
+	if b := w.DisruptionBudget; b != nil {
+		if b.MinAvailable == "100%" || b.MaxUnavailable == "0" || b.MaxUnavailable == "0%" {
+			return fmt.Errorf("%s disruption-budget allows no disruption: node drains would never finish", name)
+		}
+		if minimum, err := strconv.Atoi(b.MinAvailable); err == nil && replicas != 0 && minimum >= replicas {
+			return fmt.Errorf("%s disruption-budget min-available %d leaves no pod of %d to evict", name, minimum, replicas)
+		}
+	}
+	return nil
+}
+
+// quantitySuffixes scale a quantity's number.
+var quantitySuffixes = map[string]float64{
+	"": 1, "m": 1e-3,
+	"k": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18,
+	"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40, "Pi": 1 << 50, "Ei": 1 << 60,
+}
+
+// parseQuantity reads a quantity resourceQuantity accepts, closely enough to
+// compare two of them.
+func parseQuantity(quantity string) (float64, error) {
+	match := resourceQuantity.FindStringSubmatch(quantity)
+	if match == nil {
+		return 0, fmt.Errorf("%q is not a Kubernetes quantity", quantity)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("quantity %q: %w", quantity, err)
+	}
+	return value * quantitySuffixes[match[3]], nil
+}
+
+// patchesDeployment reports whether an environment's workload differs from
+// the base profile in the Deployment itself: its replicas, whether they are
+// autoscaled, its resources or its topology spread.
+func patchesDeployment(base, environment deploymentPolicy) bool {
+	return base.Replicas != environment.Replicas ||
+		(base.Autoscaling == nil) != (environment.Autoscaling == nil) ||
+		base.Resources != environment.Resources ||
+		!reflect.DeepEqual(base.TopologySpread, environment.TopologySpread)
+}
@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -61,7 +62,7 @@ func TestDeploymentManifestsAreReferenced(t *testing.T) {
 }
 
 // assertManifestsReferenced fails if any non-empty rendered manifest in dir is
-// absent from that directory's kustomization.yaml resources list. Manifests
+// absent from that directory's kustomization.yaml resources and patches. Manifests
 // that render empty under the current parameters (e.g. the ServiceAccount when
 // no spec is given) are conditionally absent from resources too, so they are
 // skipped — content and reference are gated by the same template condition.
@@ -73,14 +74,20 @@ func assertManifestsReferenced(t *testing.T, dir string) {
 	}
 	var parsed struct {
 		Resources []string `yaml:"resources"`
+		Patches   []struct {
+			Path string `yaml:"path"`
+		} `yaml:"patches"`
 	}
 	if err := yaml.Unmarshal(kustomization, &parsed); err != nil {
 		t.Fatalf("parse kustomization in %s: %v", dir, err)
 	}
-	referenced := make(map[string]bool, len(parsed.Resources))
+	referenced := make(map[string]bool, len(parsed.Resources)+len(parsed.Patches))
 	for _, resource := range parsed.Resources {
 		referenced[resource] = true
 	}
+	for _, patch := range parsed.Patches {
+		referenced[patch.Path] = true
+	}
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		t.Fatalf("read %s: %v", dir, err)
@@ -98,7 +105,7 @@ func assertManifestsReferenced(t *testing.T, dir string) {
 			continue
 		}
 		if !referenced[name] {
-			t.Errorf("rendered manifest %q in %s is not in kustomization resources — kustomize drops it, so it never reaches the cluster", name, dir)
+			t.Errorf("rendered manifest %q in %s is not in kustomization resources or patches — kustomize drops it, so it never reaches the cluster", name, dir)
 		}
 	}
 }
@@ -228,26 +235,72 @@ func TestSettingsValidateRuntimeAssets(t *testing.T) {
 }
 
 func TestDeploymentProbesRequireOnlyTheDeclaredListener(t *testing.T) {
-	template, err := fs.ReadFile(deploymentFS, "templates/deployment/kustomize/base/deployment.yaml.tmpl")
-	if err != nil {
-		t.Fatalf("read deployment template: %v", err)
+	// grpc is the only listener every service serves; http (grpc-gateway) and
+	// connect bind only when those endpoints are enabled. Probing http would
+	// restart-loop any grpc-only service, so by default every probe checks the
+	// gRPC health server.
+	for name, params := range map[string]DeploymentParameters{
+		"grpc only": {},
+		"all":       {RestEndpoint: true, ConnectEndpoint: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			deployment := renderDeployment(t, params)
+			if count := strings.Count(deployment, "grpc:\n              port: 9090\n"); count != 3 {
+				t.Fatalf("gRPC health probes = %d, want startup, readiness, and liveness:\n%s", count, deployment)
+			}
+			for _, unwanted := range []string{"/healthz", "tcpSocket:", "port: http"} {
+				if strings.Contains(deployment, unwanted) {
+					t.Fatalf("default probes must not render %q:\n%s", unwanted, deployment)
+				}
+			}
+		})
 	}
-	source := string(template)
-	if strings.Contains(source, "/healthz") {
-		t.Fatal("generic deployment must not require a product-specific health route")
+}
+
+func TestDeploymentProbesRenderTheConfiguredPolicy(t *testing.T) {
+	settings := Settings{Probes: &ProbesSpec{
+		Service:  "shop.v1.Orders",
+		Liveness: &ProbeSpec{InitialDelaySeconds: 15, FailureThreshold: 6},
+	}}
+	deployment := renderDeployment(t, DeploymentParameters{
+		Ports:  DeploymentPorts{GRPC: 7000},
+		Probes: settings.ProbePolicy(),
+	})
+	if count := strings.Count(deployment, "grpc:\n              port: 7000\n              service: shop.v1.Orders\n"); count != 3 {
+		t.Fatalf("probes checking shop.v1.Orders on 7000 = %d, want 3:\n%s", count, deployment)
 	}
-	if count := strings.Count(source, "tcpSocket:"); count != 3 {
-		t.Fatalf("transport probes = %d, want startup, readiness, and liveness", count)
+	if want := "initialDelaySeconds: 15\n            periodSeconds: 30\n            timeoutSeconds: 5\n            failureThreshold: 6\n"; !strings.Contains(deployment, want) {
+		t.Fatalf("liveness probe missing its timing %q:\n%s", want, deployment)
 	}
-	// grpc is the only listener every service serves; http (grpc-gateway) and
-	// connect bind only when those endpoints are enabled. Probing http would
-	// restart-loop any grpc-only service, so every probe must target grpc.
-	if count := strings.Count(source, "port: grpc"); count != 3 {
-		t.Fatalf("probes targeting the grpc listener = %d, want all three (startup, readiness, liveness)", count)
+
+	settings = Settings{RestEndpoint: true, TLS: &TLSSpec{Secret: "api-tls"}, Probes: &ProbesSpec{Type: probeHTTP}}
+	deployment = renderDeployment(t, DeploymentParameters{
+		RestEndpoint: true,
+		TLS:          &DeploymentTLS{Secret: "api-tls", MountPath: tlsSecretMount, ClientAuth: tlsClientAuthNone},
+		Probes:       settings.ProbePolicy(),
+	})
+	if count := strings.Count(deployment, "httpGet:\n              path: /healthz\n              port: http\n              scheme: HTTPS\n"); count != 3 {
+		t.Fatalf("HTTPS /healthz probes = %d, want 3:\n%s", count, deployment)
+	}
+
+	settings = Settings{TLS: &TLSSpec{Secret: "api-tls"}}
+	deployment = renderDeployment(t, DeploymentParameters{
+		TLS:    &DeploymentTLS{Secret: "api-tls", MountPath: tlsSecretMount, ClientAuth: tlsClientAuthNone},
+		Probes: settings.ProbePolicy(),
+	})
+	if count := strings.Count(deployment, "tcpSocket:\n              port: grpc\n"); count != 3 {
+		t.Fatalf("tcp probes with TLS = %d, want 3:\n%s", count, deployment)
 	}
-	if strings.Contains(source, "port: http") {
-		t.Fatal("probes must not target the http listener: grpc-only services never bind it")
+}
+
+func renderDeployment(t *testing.T, params DeploymentParameters) string {
+	t.Helper()
+	dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, params)
+	deployment, err := os.ReadFile(filepath.Join(dir, "base", "deployment.yaml"))
+	if err != nil {
+		t.Fatalf("read deployment: %v", err)
 	}
+	return string(deployment)
 }
 
 // TestDeploymentPortsMatchDeclaredEndpoints pins the container/Service port set
@@ -297,3 +350,312 @@ func TestDeploymentPortsMatchDeclaredEndpoints(t *testing.T) {
 		})
 	}
 }
+
+func TestDeploymentTLSMountsTheSecret(t *testing.T) {
+	for name, test := range map[string]struct {
+		clientAuth string
+		wantCA     bool
+	}{
+		"server tls": {tlsClientAuthNone, false},
+		"mtls":       {tlsClientAuthRequire, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			params := DeploymentParameters{TLS: &DeploymentTLS{Secret: "api-tls", MountPath: tlsSecretMount, ClientAuth: test.clientAuth}}
+			dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, params)
+			deployment, err := os.ReadFile(filepath.Join(dir, "base", "deployment.yaml"))
+			if err != nil {
+				t.Fatalf("read deployment: %v", err)
+			}
+			source := string(deployment)
+			for _, want := range []string{
+				"secretName: api-tls",
+				"mountPath: /etc/codefly/tls",
+				"value: /etc/codefly/tls/tls.crt",
+				"value: /etc/codefly/tls/tls.key",
+				"value: " + test.clientAuth,
+			} {
+				if !strings.Contains(source, want) {
+					t.Errorf("deployment missing %q:\n%s", want, source)
+				}
+			}
+			if got := strings.Contains(source, "value: /etc/codefly/tls/ca.crt"); got != test.wantCA {
+				t.Errorf("ca.crt read=%v, want %v:\n%s", got, test.wantCA, source)
+			}
+		})
+	}
+
+	dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, DeploymentParameters{})
+	deployment, err := os.ReadFile(filepath.Join(dir, "base", "deployment.yaml"))
+	if err != nil {
+		t.Fatalf("read deployment: %v", err)
+	}
+	if strings.Contains(string(deployment), "CODEFLY_TLS_") {
+		t.Errorf("plaintext deployment must not configure tls:\n%s", deployment)
+	}
+}
+
+// TestDeploymentRedactsInternalErrors keeps internal error messages from the
+// callers of a production deployment while other environments show them.
+func TestDeploymentRedactsInternalErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		params DeploymentParameters
+		want   string
+	}{
+		"production":     {DeploymentParameters{RedactErrors: true}, `CODEFLY_ERRORS_REDACT: "true"`},
+		"non-production": {DeploymentParameters{}, `CODEFLY_ERRORS_REDACT: "false"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, test.params)
+			configMap, err := os.ReadFile(filepath.Join(dir, "overlays", "test", "configmap.yaml"))
+			if err != nil {
+				t.Fatalf("read overlay configmap: %v", err)
+			}
+			if !strings.Contains(string(configMap), test.want) {
+				t.Errorf("overlay configmap missing %q:\n%s", test.want, configMap)
+			}
+			deployment, err := os.ReadFile(filepath.Join(dir, "base", "deployment.yaml"))
+			if err != nil {
+				t.Fatalf("read deployment: %v", err)
+			}
+			if strings.Contains(string(deployment), "CODEFLY_ERRORS_REDACT") {
+				t.Errorf("base deployment sets redaction for every environment:\n%s", deployment)
+			}
+		})
+	}
+}
+
+func TestDeploymentGracePeriodCoversShutdown(t *testing.T) {
+	for name, test := range map[string]struct {
+		seconds int
+		want    string
+	}{
+		"kubelet default": {0, "terminationGracePeriodSeconds: 30\n"},
+		"long timeout":    {95, "terminationGracePeriodSeconds: 95\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, DeploymentParameters{TerminationGracePeriodSeconds: test.seconds})
+			deployment, err := os.ReadFile(filepath.Join(dir, "base", "deployment.yaml"))
+			if err != nil {
+				t.Fatalf("read deployment: %v", err)
+			}
+			if !strings.Contains(string(deployment), test.want) {
+				t.Errorf("deployment missing %q:\n%s", test.want, deployment)
+			}
+		})
+	}
+}
+
+func TestDeploymentAdvertisesTheConfiguredPorts(t *testing.T) {
+	params := DeploymentParameters{
+		RestEndpoint:    true,
+		ConnectEndpoint: true,
+		Ports:           DeploymentPorts{GRPC: 7000, REST: 7001, Connect: 7002},
+	}
+	dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, params)
+	deployment, err := os.ReadFile(filepath.Join(dir, "base", "deployment.yaml"))
+	if err != nil {
+		t.Fatalf("read deployment: %v", err)
+	}
+	service, err := os.ReadFile(filepath.Join(dir, "base", "service.yaml"))
+	if err != nil {
+		t.Fatalf("read service: %v", err)
+	}
+	for _, want := range []string{"containerPort: 7000", "containerPort: 7001", "containerPort: 7002"} {
+		if !strings.Contains(string(deployment), want) {
+			t.Errorf("deployment missing %q:\n%s", want, deployment)
+		}
+	}
+	for _, want := range []string{"port: 7000\n      targetPort: grpc", "port: 7001\n      targetPort: http", "port: 7002\n      targetPort: connect"} {
+		if !strings.Contains(string(service), want) {
+			t.Errorf("service missing %q:\n%s", want, service)
+		}
+	}
+	if rendered := string(deployment) + string(service); strings.Contains(rendered, "9090") || strings.Contains(rendered, "8080") {
+		t.Errorf("manifests still reference a standard port:\n%s", rendered)
+	}
+}
+
+func TestDeploymentPolicyAppliesEnvironmentOverrides(t *testing.T) {
+	settings := Settings{Deployment: &DeploymentSpec{
+		DeploymentProfile: DeploymentProfile{
+			Replicas:       2,
+			Resources:      &ResourcesSpec{Requests: ResourceQuantities{CPU: "250m"}},
+			TopologySpread: []TopologySpreadSpec{{TopologyKey: "topology.kubernetes.io/zone"}},
+		},
+		Environments: map[string]*DeploymentProfile{
+			"production": {
+				Resources:        &ResourcesSpec{Limits: ResourceQuantities{Memory: "1Gi"}},
+				Autoscaling:      &AutoscalingSpec{MinReplicas: 3, MaxReplicas: 10, CPU: 70},
+				DisruptionBudget: &DisruptionBudgetSpec{MinAvailable: "2"},
+			},
+			"staging": {Replicas: 1, TopologySpread: []TopologySpreadSpec{}},
+		},
+	}}
+
+	base := settings.DeploymentPolicy("")
+	want := deploymentPolicy{
+		Replicas:       2,
+		Resources:      ResourcesSpec{Requests: ResourceQuantities{CPU: "250m", Memory: "128Mi"}, Limits: defaultResources.Limits},
+		TopologySpread: []TopologySpreadSpec{{TopologyKey: "topology.kubernetes.io/zone", MaxSkew: 1, WhenUnsatisfiable: "ScheduleAnyway"}},
+	}
+	if !reflect.DeepEqual(base, want) {
+		t.Fatalf("DeploymentPolicy(\"\") = %+v, want %+v", base, want)
+	}
+	if got := settings.DeploymentPolicy("development"); !reflect.DeepEqual(got, base) {
+		t.Fatalf("an environment without overrides = %+v, want the base profile", got)
+	}
+
+	production := settings.DeploymentPolicy("production")
+	if production.Resources.Requests.CPU != "250m" || production.Resources.Limits.Memory != "1Gi" || production.Resources.Limits.CPU != "1" {
+		t.Fatalf("production resources = %+v, want the base merged quantity by quantity", production.Resources)
+	}
+	if production.Autoscaling == nil || production.DisruptionBudget == nil || len(production.TopologySpread) != 1 {
+		t.Fatalf("production = %+v, want autoscaling, a disruption budget and the base spread", production)
+	}
+	if !patchesDeployment(base, production) {
+		t.Fatal("autoscaled production must patch the base Deployment")
+	}
+
+	staging := settings.DeploymentPolicy("staging")
+	if staging.Replicas != 1 || len(staging.TopologySpread) != 0 {
+		t.Fatalf("staging = %+v, want one replica and no spread", staging)
+	}
+
+	settings.Deployment.Environments["production"].Autoscaling = &AutoscalingSpec{}
+	if got := settings.DeploymentPolicy("production").Autoscaling; got != nil {
+		t.Fatalf("an empty autoscaling block = %+v, want autoscaling off", got)
+	}
+}
+
+func TestSettingsValidateDeployment(t *testing.T) {
+	profile := func(p DeploymentProfile) *DeploymentSpec { return &DeploymentSpec{DeploymentProfile: p} }
+	tests := map[string]struct {
+		spec *DeploymentSpec
+		want string
+	}{
+		"unset": {nil, ""},
+		"sized": {profile(DeploymentProfile{Replicas: 3, Resources: &ResourcesSpec{
+			Requests: ResourceQuantities{CPU: "0.5", Memory: "256Mi"},
+			Limits:   ResourceQuantities{CPU: "2", Memory: "1Gi"},
+		}}), ""},
+		"autoscaled": {profile(DeploymentProfile{
+			Autoscaling:      &AutoscalingSpec{MinReplicas: 2, MaxReplicas: 6, Metrics: []PodMetricSpec{{Name: "grpc_requests_per_second", AverageValue: "100"}}},
+			DisruptionBudget: &DisruptionBudgetSpec{MaxUnavailable: "25%"},
+			TopologySpread:   []TopologySpreadSpec{{TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: "DoNotSchedule"}},
+		}), ""},
+		"negative replicas":    {profile(DeploymentProfile{Replicas: -1}), "replicas must not be negative"},
+		"bad quantity":         {profile(DeploymentProfile{Resources: &ResourcesSpec{Limits: ResourceQuantities{Memory: "1GB"}}}), "limits memory \"1GB\" is not a Kubernetes quantity"},
+		"request above limit":  {profile(DeploymentProfile{Resources: &ResourcesSpec{Requests: ResourceQuantities{Memory: "1Gi"}}}), "requests memory 1Gi exceeds its limit 512Mi"},
+		"Ki above limit":       {profile(DeploymentProfile{Resources: &ResourcesSpec{Requests: ResourceQuantities{Memory: "600000Ki"}}}), "requests memory 600000Ki exceeds its limit 512Mi"},
+		"Ki at limit":          {profile(DeploymentProfile{Resources: &ResourcesSpec{Requests: ResourceQuantities{Memory: "524288Ki"}}}), ""},
+		"unbounded autoscaler": {profile(DeploymentProfile{Autoscaling: &AutoscalingSpec{MinReplicas: 3, MaxReplicas: 2, CPU: 80}}), "min-replicas <= max-replicas"},
+		"untargeted":           {profile(DeploymentProfile{Autoscaling: &AutoscalingSpec{MinReplicas: 1, MaxReplicas: 2}}), "needs a cpu, memory or custom metric target"},
+		"bad metric":           {profile(DeploymentProfile{Autoscaling: &AutoscalingSpec{MinReplicas: 1, MaxReplicas: 2, Metrics: []PodMetricSpec{{Name: "rps", AverageValue: "lots"}}}}), "average-value"},
+		"both budgets":         {profile(DeploymentProfile{DisruptionBudget: &DisruptionBudgetSpec{MinAvailable: "1", MaxUnavailable: "1"}}), "choose one"},
+		"blocking budget":      {profile(DeploymentProfile{DisruptionBudget: &DisruptionBudgetSpec{MaxUnavailable: "0"}}), "allows no disruption"},
+		"budget of all pods":   {profile(DeploymentProfile{Replicas: 2, DisruptionBudget: &DisruptionBudgetSpec{MinAvailable: "2"}}), "leaves no pod of 2 to evict"},
+		"bad topology key":     {profile(DeploymentProfile{TopologySpread: []TopologySpreadSpec{{TopologyKey: "zone name"}}}), "is not a label key"},
+		"bad unsatisfiable":    {profile(DeploymentProfile{TopologySpread: []TopologySpreadSpec{{TopologyKey: "zone", WhenUnsatisfiable: "Never"}}}), "when-unsatisfiable"},
+		"environment override": {&DeploymentSpec{
+			DeploymentProfile: DeploymentProfile{Replicas: 3, DisruptionBudget: &DisruptionBudgetSpec{MinAvailable: "2"}},
+			Environments:      map[string]*DeploymentProfile{"staging": {Replicas: 1}},
+		}, "deployment environments staging disruption-budget min-available 2 leaves no pod of 1 to evict"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := (&Settings{Deployment: test.spec}).Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := map[string]float64{
+		"250m": 0.25, "1.5": 1.5, ".5": 0.5, "2k": 2e3, "3M": 3e6,
+		"512Ki": 512 << 10, "256Mi": 256 << 20, "1Gi": 1 << 30,
+	}
+	for quantity, want := range tests {
+		got, err := parseQuantity(quantity)
+		if err != nil || got != want {
+			t.Errorf("parseQuantity(%q) = %v, %v, want %v", quantity, got, err, want)
+		}
+	}
+	if _, err := parseQuantity("512KB"); err == nil {
+		t.Error("parseQuantity(\"512KB\") accepted a quantity Kubernetes rejects")
+	}
+}
+
+func TestDeploymentRendersTheWorkload(t *testing.T) {
+	settings := Settings{Deployment: &DeploymentSpec{
+		DeploymentProfile: DeploymentProfile{
+			Replicas:       2,
+			TopologySpread: []TopologySpreadSpec{{TopologyKey: "topology.kubernetes.io/zone"}},
+		},
+		Environments: map[string]*DeploymentProfile{"test": {
+			Resources:        &ResourcesSpec{Requests: ResourceQuantities{CPU: "500m"}, Limits: ResourceQuantities{CPU: "2"}},
+			Autoscaling:      &AutoscalingSpec{MinReplicas: 2, MaxReplicas: 8, CPU: 70, Metrics: []PodMetricSpec{{Name: "grpc_requests_per_second", AverageValue: "100"}}},
+			DisruptionBudget: &DisruptionBudgetSpec{MaxUnavailable: "25%"},
+		}},
+	}}
+	dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, DeploymentParameters{
+		Workload:            settings.DeploymentPolicy(""),
+		EnvironmentWorkload: settings.DeploymentPolicy("test"),
+	})
+	assertManifestsReferenced(t, filepath.Join(dir, "overlays", "test"))
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		return string(content)
+	}
+
+	deployment := read(filepath.Join("base", "deployment.yaml"))
+	for _, want := range []string{
+		"replicas: 2\n",
+		"topologyKey: topology.kubernetes.io/zone\n          whenUnsatisfiable: ScheduleAnyway\n",
+		"requests:\n              cpu: \"100m\"\n              memory: \"128Mi\"\n",
+	} {
+		if !strings.Contains(deployment, want) {
+			t.Errorf("base deployment missing %q:\n%s", want, deployment)
+		}
+	}
+
+	patch := read(filepath.Join("overlays", "test", "deployment-patch.yaml"))
+	for _, want := range []string{"replicas: null\n", "cpu: \"500m\"\n", "cpu: \"2\"\n", "- $patch: replace\n"} {
+		if !strings.Contains(patch, want) {
+			t.Errorf("deployment patch missing %q:\n%s", want, patch)
+		}
+	}
+	hpa := read(filepath.Join("overlays", "test", "hpa.yaml"))
+	for _, want := range []string{"minReplicas: 2\n", "maxReplicas: 8\n", "averageUtilization: 70\n", "name: grpc_requests_per_second\n", "averageValue: \"100\"\n"} {
+		if !strings.Contains(hpa, want) {
+			t.Errorf("autoscaler missing %q:\n%s", want, hpa)
+		}
+	}
+	if pdb := read(filepath.Join("overlays", "test", "pdb.yaml")); !strings.Contains(pdb, "maxUnavailable: 25%\n") {
+		t.Errorf("disruption budget missing maxUnavailable:\n%s", pdb)
+	}
+}
+
+func TestDeploymentWithoutOverridesRendersNoPatch(t *testing.T) {
+	dir := agenttesting.AssertKustomizeTemplates(t, deploymentFS, DeploymentParameters{})
+	kustomization, err := os.ReadFile(filepath.Join(dir, "overlays", "test", "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("read overlay kustomization: %v", err)
+	}
+	for _, unwanted := range []string{"patches:", "hpa.yaml", "pdb.yaml"} {
+		if strings.Contains(string(kustomization), unwanted) {
+			t.Errorf("overlay without overrides references %q:\n%s", unwanted, kustomization)
+		}
+	}
+}
@@ -85,6 +85,7 @@ func TestDockerfileTemplatePackagesContainingModuleFixturesForWorkspaceBuilds(t
 func TestDockerfileTemplateCopiesRuntimeAssetsWhereSourceRelativePathsResolve(t *testing.T) {
 	t.Parallel()
 
+	settings := Settings{ConnectEndpoint: true, Ports: &PortsSpec{GRPC: 7000}}
 	source, err := fs.ReadFile(builderFS, "templates/builder/Dockerfile.tmpl")
 	require.NoError(t, err)
 	rendered, err := templates.ApplyTemplate(string(source), dockerTemplating{
@@ -182,3 +183,22 @@ func TestDockerfileTemplateKeepsNonCGOBuildStatic(t *testing.T) {
 	require.Contains(t, rendered, `ENV CGO_ENABLED=0`)
 	require.Contains(t, rendered, `extldflags "-static"`)
 }
+
+func TestDockerfileTemplateExposesTheConfiguredPorts(t *testing.T) {
+	t.Parallel()
+
+	settings := Settings{ConnectEndpoint: true, Ports: &PortsSpec{GRPC: 7000}}
+	source, err := fs.ReadFile(builderFS, "templates/builder/Dockerfile.tmpl")
+	require.NoError(t, err)
+	rendered, err := templates.ApplyTemplate(string(source), dockerTemplating{
+		DockerTemplating: golanghelpers.DockerTemplating{
+			GoVersion: GoVersion, AlpineVersion: AlpineVersion,
+			ModuleRoot: "code", BuildTarget: ".",
+		},
+		Ports: settings.ContainerPorts().List(),
+	})
+	require.NoError(t, err)
+
+	require.Contains(t, rendered, "\nEXPOSE 7000 8081\n")
+	require.NotContains(t, rendered, "8080")
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/protocompile/options"
+	"github.com/bufbuild/protocompile/parser"
+	"github.com/bufbuild/protocompile/reporter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// Registered so RPC signatures that use well-known types resolve when the
+	// schema is compiled from the local proto tree.
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// grpcCallDeadline bounds a gRPC command that sets no --deadline.
+const grpcCallDeadline = 30 * time.Second
+
+// grpcCallOptions are the flags shared by the gRPC client commands.
+type grpcCallOptions struct {
+	headers  metadata.MD
+	deadline time.Duration
+}
+
+// parseGrpcCallArgs separates `-H "key: value"` (repeatable) and
+// `--deadline=<duration>` from the positional arguments.
+func parseGrpcCallArgs(args []string) (grpcCallOptions, []string, error) {
+	options := grpcCallOptions{headers: metadata.MD{}, deadline: grpcCallDeadline}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-H" || arg == "--header":
+			if i+1 == len(args) {
+				return options, nil, fmt.Errorf("%s needs a \"key: value\" header", arg)
+			}
+			i++
+			if err := addGrpcHeader(options.headers, args[i]); err != nil {
+				return options, nil, err
+			}
+		case strings.HasPrefix(arg, "-H="), strings.HasPrefix(arg, "--header="):
+			_, header, _ := strings.Cut(arg, "=")
+			if err := addGrpcHeader(options.headers, header); err != nil {
+				return options, nil, err
+			}
+		case strings.HasPrefix(arg, "--deadline="):
+			deadline, err := time.ParseDuration(strings.TrimPrefix(arg, "--deadline="))
+			if err != nil || deadline <= 0 {
+				return options, nil, fmt.Errorf("--deadline takes a positive duration such as 5s, got %q", arg)
+			}
+			options.deadline = deadline
+		case strings.HasPrefix(arg, "-") && arg != "-" && !strings.HasPrefix(arg, "-{"):
+			return options, nil, fmt.Errorf("unknown flag %q (use -H \"key: value\" or --deadline=<duration>)", arg)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	return options, positional, nil
+}
+
+func addGrpcHeader(md metadata.MD, header string) error {
+	key, value, ok := strings.Cut(header, ":")
+	key = strings.ToLower(strings.TrimSpace(key))
+	if !ok || key == "" {
+		return fmt.Errorf("header %q must be \"key: value\"", header)
+	}
+	md.Append(key, strings.TrimSpace(value))
+	return nil
+}
+
+// context applies the headers and the deadline to a call.
+func (o grpcCallOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, o.deadline)
+	return metadata.NewOutgoingContext(ctx, o.headers), cancel
+}
+
+// grpcSchema is what the client commands know about the running service:
+// its services and the descriptors to describe and call them.
+type grpcSchema struct {
+	services []string
+	files    *protoregistry.Files
+}
+
+// loadGrpcSchema asks the server through reflection and, when the server does
+// not serve it, compiles the local proto tree instead.
+func loadGrpcSchema(ctx context.Context, conn grpc.ClientConnInterface, protoRoot string) (*grpcSchema, error) {
+	schema, err := reflectGrpcSchema(ctx, conn)
+	if status.Code(err) != codes.Unimplemented {
+		return schema, err
+	}
+	return localGrpcSchema(protoRoot)
+}
+
+func reflectGrpcSchema(ctx context.Context, conn grpc.ClientConnInterface) (*grpcSchema, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := grpc_reflection_v1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ask := func(request *grpc_reflection_v1.ServerReflectionRequest) (*grpc_reflection_v1.ServerReflectionResponse, error) {
+		if err := stream.Send(request); err != nil {
+			// The server's status is reported by Recv.
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+		}
+		response, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if failure := response.GetErrorResponse(); failure != nil {
+			return nil, status.Error(codes.Code(failure.GetErrorCode()), failure.GetErrorMessage())
+		}
+		return response, nil
+	}
+
+	listed, err := ask(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	schema := &grpcSchema{}
+	files := map[string]*descriptorpb.FileDescriptorProto{}
+	collect := func(response *grpc_reflection_v1.ServerReflectionResponse) error {
+		for _, raw := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, file); err != nil {
+				return fmt.Errorf("invalid descriptor from reflection: %w", err)
+			}
+			files[file.GetName()] = file
+		}
+		return nil
+	}
+	for _, service := range listed.GetListServicesResponse().GetService() {
+		schema.services = append(schema.services, service.GetName())
+		response, err := ask(&grpc_reflection_v1.ServerReflectionRequest{
+			MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service.GetName()},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s through reflection: %w", service.GetName(), err)
+		}
+		if err := collect(response); err != nil {
+			return nil, err
+		}
+	}
+	// The server sends each file once per stream; fetch any dependency it
+	// considered already known.
+	for missing := missingDependencies(files); len(missing) > 0; missing = missingDependencies(files) {
+		for _, name := range missing {
+			response, err := ask(&grpc_reflection_v1.ServerReflectionRequest{
+				MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("cannot fetch %s through reflection: %w", name, err)
+			}
+			if err := collect(response); err != nil {
+				return nil, err
+			}
+			if files[name] == nil {
+				return nil, fmt.Errorf("reflection did not return %s", name)
+			}
+		}
+	}
+	_ = stream.CloseSend()
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range files {
+		set.File = append(set.File, file)
+	}
+	schema.files, err = protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptors from reflection: %w", err)
+	}
+	sort.Strings(schema.services)
+	return schema, nil
+}
+
+func missingDependencies(files map[string]*descriptorpb.FileDescriptorProto) []string {
+	var missing []string
+	for _, file := range files {
+		for _, dependency := range file.GetDependency() {
+			if files[dependency] == nil && !slices.Contains(missing, dependency) {
+				missing = append(missing, dependency)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// localGrpcSchema compiles the .proto files below protoRoot, named by their
+// import path relative to it. Well-known imports come from the registered Go
+// types; other imports Buf resolves from remote modules (googleapis,
+// protovalidate) are left as placeholders, which only matters when an RPC
+// takes one of their messages.
+func localGrpcSchema(protoRoot string) (*grpcSchema, error) {
+	files, err := compileProtoTree(protoRoot)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := linkProtoFiles(files)
+	if err != nil {
+		return nil, fmt.Errorf("cannot link %s: %w", protoRoot, err)
+	}
+	schema := &grpcSchema{files: registry}
+	for _, file := range files {
+		for _, service := range file.GetService() {
+			if file.GetPackage() != "" {
+				schema.services = append(schema.services, file.GetPackage()+"."+service.GetName())
+			} else {
+				schema.services = append(schema.services, service.GetName())
+			}
+		}
+	}
+	sort.Strings(schema.services)
+	return schema, nil
+}
+
+// compileProtoTree parses the .proto files below protoRoot into unlinked
+// descriptors keyed by their import path relative to it.
+func compileProtoTree(protoRoot string) (map[string]*descriptorpb.FileDescriptorProto, error) {
+	sources := map[string][]byte{}
+	err := filepath.WalkDir(protoRoot, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		name, err := filepath.Rel(protoRoot, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sources[filepath.ToSlash(name)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile %s: %w", protoRoot, err)
+	}
+	files, err := compileProtoSources(sources)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile %s: %w", protoRoot, err)
+	}
+	return files, nil
+}
+
+// compileProtoSources parses proto sources keyed by import path. Custom
+// options such as google.api.http stay uninterpreted and type references as
+// written; linkProtoFiles resolves the latter.
+func compileProtoSources(sources map[string][]byte) (map[string]*descriptorpb.FileDescriptorProto, error) {
+	files := make(map[string]*descriptorpb.FileDescriptorProto, len(sources))
+	for name, content := range sources {
+		handler := reporter.NewHandler(nil)
+		node, err := parser.Parse(name, bytes.NewReader(content), handler)
+		if err != nil {
+			return nil, err
+		}
+		result, err := parser.ResultFromAST(node, true, handler)
+		if err != nil {
+			return nil, err
+		}
+		// Linking needs the standard options such as allow_alias.
+		if _, err := options.InterpretUnlinkedOptions(result); err != nil {
+			return nil, err
+		}
+		files[name] = result.FileDescriptorProto()
+	}
+	return files, nil
+}
+
+// linkProtoFiles resolves descriptors against each other and the registered
+// well-known types. Imports neither provides become placeholders.
+func linkProtoFiles(files map[string]*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	files = maps.Clone(files)
+	for added := true; added; {
+		added = false
+		for _, name := range missingDependencies(files) {
+			if known, err := protoregistry.GlobalFiles.FindFileByPath(name); err == nil {
+				files[name] = protodesc.ToFileDescriptorProto(known)
+				added = true
+			}
+		}
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range files {
+		set.File = append(set.File, file)
+	}
+	return protodesc.FileOptions{AllowUnresolvable: true}.NewFiles(set)
+}
+
+// describe renders a service, method, message or enum in proto syntax; with
+// no symbol, every service.
+func (schema *grpcSchema) describe(symbol string) (string, error) {
+	if symbol == "" {
+		var out strings.Builder
+		for _, service := range schema.services {
+			description, err := schema.describe(service)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(description)
+		}
+		return out.String(), nil
+	}
+	descriptor, err := schema.files.FindDescriptorByName(protoreflect.FullName(strings.TrimPrefix(symbol, ".")))
+	if err != nil {
+		return "", fmt.Errorf("symbol %s not found", symbol)
+	}
+	var out strings.Builder
+	switch descriptor := descriptor.(type) {
+	case protoreflect.ServiceDescriptor:
+		fmt.Fprintf(&out, "%s is a service:\nservice %s {\n", descriptor.FullName(), descriptor.Name())
+		methods := descriptor.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			fmt.Fprintf(&out, "  %s\n", describeMethod(methods.Get(i)))
+		}
+		out.WriteString("}\n")
+	case protoreflect.MethodDescriptor:
+		fmt.Fprintf(&out, "%s is a method:\n%s\n", descriptor.FullName(), describeMethod(descriptor))
+	case protoreflect.MessageDescriptor:
+		fmt.Fprintf(&out, "%s is a message:\nmessage %s {\n", descriptor.FullName(), descriptor.Name())
+		fields := descriptor.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fmt.Fprintf(&out, "  %s\n", describeField(fields.Get(i)))
+		}
+		out.WriteString("}\n")
+	case protoreflect.EnumDescriptor:
+		fmt.Fprintf(&out, "%s is an enum:\nenum %s {\n", descriptor.FullName(), descriptor.Name())
+		values := descriptor.Values()
+		for i := 0; i < values.Len(); i++ {
+			fmt.Fprintf(&out, "  %s = %d;\n", values.Get(i).Name(), values.Get(i).Number())
+		}
+		out.WriteString("}\n")
+	default:
+		return "", fmt.Errorf("%s is not a service, method, message or enum", symbol)
+	}
+	return out.String(), nil
+}
+
+func describeMethod(method protoreflect.MethodDescriptor) string {
+	stream := func(streaming bool) string {
+		if streaming {
+			return "stream "
+		}
+		return ""
+	}
+	return fmt.Sprintf("rpc %s ( %s.%s ) returns ( %s.%s );", method.Name(),
+		stream(method.IsStreamingClient()), method.Input().FullName(),
+		stream(method.IsStreamingServer()), method.Output().FullName())
+}
+
+func describeField(field protoreflect.FieldDescriptor) string {
+	kind := func(field protoreflect.FieldDescriptor) string {
+		switch field.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			return "." + string(field.Message().FullName())
+		case protoreflect.EnumKind:
+			return "." + string(field.Enum().FullName())
+		default:
+			return field.Kind().String()
+		}
+	}
+	typ := kind(field)
+	switch {
+	case field.IsMap():
+		typ = fmt.Sprintf("map<%s, %s>", kind(field.MapKey()), kind(field.MapValue()))
+	case field.IsList():
+		typ = "repeated " + typ
+	case field.HasOptionalKeyword():
+		typ = "optional " + typ
+	}
+	return fmt.Sprintf("%s %s = %d;", typ, field.Name(), field.Number())
+}
+
+// invoke calls method ("pkg.Service.Method" or "pkg.Service/Method") with the
+// JSON requests in payload, one object for unary and server-streaming calls,
+// a sequence or an array of them for client and bidi streams. Requests are
+// sent while responses are read, so a bidi server can answer each message as
+// it arrives. Each response is written to out as indented JSON; a failed call
+// also reports its status.
+func (schema *grpcSchema) invoke(ctx context.Context, conn grpc.ClientConnInterface, method, payload string, out io.Writer) error {
+	name := strings.TrimPrefix(method, "/")
+	if index := strings.LastIndex(name, "/"); index >= 0 {
+		name = name[:index] + "." + name[index+1:]
+	}
+	descriptor, err := schema.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return fmt.Errorf("method %s not found", method)
+	}
+	rpc, ok := descriptor.(protoreflect.MethodDescriptor)
+	if !ok {
+		return fmt.Errorf("%s is not a method", method)
+	}
+	if rpc.Input().IsPlaceholder() || rpc.Output().IsPlaceholder() {
+		return fmt.Errorf("method %s uses messages from imports that are not available locally; enable reflection on the server", method)
+	}
+	types := dynamicpb.NewTypes(schema.files)
+
+	requests, err := decodeGrpcRequests(payload, rpc.Input(), types)
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		requests = append(requests, dynamicpb.NewMessage(rpc.Input()))
+	}
+	if len(requests) > 1 && !rpc.IsStreamingClient() {
+		return fmt.Errorf("method %s takes a single request, got %d", method, len(requests))
+	}
+
+	fullMethod := fmt.Sprintf("/%s/%s", rpc.Parent().FullName(), rpc.Name())
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(rpc.Name()),
+		ClientStreams: rpc.IsStreamingClient(),
+		ServerStreams: rpc.IsStreamingServer(),
+	}, fullMethod)
+	if err != nil {
+		return grpcCallError(err)
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- sendGrpcRequests(stream, requests) }()
+	marshal := protojson.MarshalOptions{Multiline: true, Indent: "  ", Resolver: types}
+	for {
+		response := dynamicpb.NewMessage(rpc.Output())
+		err := stream.RecvMsg(response)
+		if errors.Is(err, io.EOF) {
+			return <-sent
+		}
+		if err != nil {
+			return grpcCallError(err)
+		}
+		encoded, err := marshal.Marshal(response)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "%s\n", encoded); err != nil {
+			return err
+		}
+		if !rpc.IsStreamingServer() {
+			return <-sent
+		}
+	}
+}
+
+// decodeGrpcRequests reads the requests of a call: a JSON array, or JSON
+// objects one after the other such as newline-delimited JSON.
+func decodeGrpcRequests(payload string, input protoreflect.MessageDescriptor, types *dynamicpb.Types) ([]proto.Message, error) {
+	var raws []json.RawMessage
+	if strings.HasPrefix(strings.TrimSpace(payload), "[") {
+		if err := json.Unmarshal([]byte(payload), &raws); err != nil {
+			return nil, fmt.Errorf("invalid JSON request array: %w", err)
+		}
+	} else {
+		decoder := json.NewDecoder(strings.NewReader(payload))
+		for {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("invalid JSON request: %w", err)
+			}
+			raws = append(raws, raw)
+		}
+	}
+	requests := make([]proto.Message, 0, len(raws))
+	for i, raw := range raws {
+		request := dynamicpb.NewMessage(input)
+		if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal(raw, request); err != nil {
+			return nil, fmt.Errorf("request %d does not match %s: %w", i+1, input.FullName(), err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// sendGrpcRequests sends every request and half-closes the stream.
+func sendGrpcRequests(stream grpc.ClientStream, requests []proto.Message) error {
+	for _, request := range requests {
+		if err := stream.SendMsg(request); err != nil {
+			// io.EOF means the server ended the call; RecvMsg has its status.
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return grpcCallError(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return grpcCallError(err)
+	}
+	return nil
+}
+
+// readGrpcPayload resolves the payload argument of grpcurl: "@file" reads the
+// requests from a file, relative to root unless absolute, so long client
+// streams can be kept as newline-delimited JSON.
+func readGrpcPayload(root, arg string) (string, error) {
+	file, ok := strings.CutPrefix(arg, "@")
+	if !ok {
+		return arg, nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(root, file)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read request payload: %w", err)
+	}
+	return string(content), nil
+}
+
+func grpcCallError(err error) error {
+	st := status.Convert(err)
+	return fmt.Errorf("rpc failed: code = %s desc = %s", st.Code(), st.Message())
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+)
+
+// healthProto mirrors grpc/health/v1/health.proto, standing in for a
+// service's own proto tree.
+const healthProto = `syntax = "proto3";
+package grpc.health.v1;
+
+import "google/api/annotations.proto";
+import "google/protobuf/empty.proto";
+
+message HealthCheckRequest {
+    string service = 1;
+}
+
+message HealthCheckResponse {
+    enum ServingStatus {
+        UNKNOWN = 0;
+        SERVING = 1;
+        NOT_SERVING = 2;
+        SERVICE_UNKNOWN = 3;
+    }
+    ServingStatus status = 1;
+}
+
+service Health {
+    rpc Check(HealthCheckRequest) returns (HealthCheckResponse) {
+        option (google.api.http) = { get: "/healthz" };
+    }
+    rpc Watch(HealthCheckRequest) returns (stream HealthCheckResponse);
+    rpc Ping(google.protobuf.Empty) returns (google.protobuf.Empty);
+}
+`
+
+func startGrpcClientServer(t *testing.T, withReflection bool) (*health.Server, *grpc.ClientConn) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	if withReflection {
+		reflection.Register(server)
+	}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthServer, conn
+}
+
+func TestGrpcSchemaThroughReflection(t *testing.T) {
+	healthServer, conn := startGrpcClientServer(t, true)
+	healthServer.SetServingStatus("api.WebService", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	ctx := context.Background()
+
+	schema, err := loadGrpcSchema(ctx, conn, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"grpc.health.v1.Health", "grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"}
+	if strings.Join(schema.services, ",") != strings.Join(want, ",") {
+		t.Fatalf("services = %v, want %v", schema.services, want)
+	}
+
+	description, err := schema.describe("grpc.health.v1.Health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"grpc.health.v1.Health is a service:",
+		"rpc Check ( .grpc.health.v1.HealthCheckRequest ) returns ( .grpc.health.v1.HealthCheckResponse );",
+		"rpc Watch ( .grpc.health.v1.HealthCheckRequest ) returns ( stream .grpc.health.v1.HealthCheckResponse );",
+	} {
+		if !strings.Contains(description, line) {
+			t.Errorf("description misses %q:\n%s", line, description)
+		}
+	}
+	if description, err := schema.describe("grpc.health.v1.HealthCheckResponse"); err != nil || !strings.Contains(description, ".grpc.health.v1.HealthCheckResponse.ServingStatus status = 1;") {
+		t.Errorf("message description = %q, %v", description, err)
+	}
+	if _, err := schema.describe("grpc.health.v1.Missing"); err == nil {
+		t.Error("describing an unknown symbol succeeded")
+	}
+
+	var out bytes.Buffer
+	if err := schema.invoke(ctx, conn, "grpc.health.v1.Health/Check", `{"service": "api.WebService"}`, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"NOT_SERVING"`) {
+		t.Fatalf("Check response = %s", out.String())
+	}
+
+	out.Reset()
+	err = schema.invoke(ctx, conn, "grpc.health.v1.Health.Check", `{"service": "api.Missing"}`, &out)
+	if err == nil || !strings.Contains(err.Error(), "code = NotFound") {
+		t.Fatalf("Check of an unknown service error = %v", err)
+	}
+	if err := schema.invoke(ctx, conn, "grpc.health.v1.Health.Check", `{"service": 1}`, &out); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("invalid request error = %v", err)
+	}
+	if err := schema.invoke(ctx, conn, "grpc.health.v1.Health.Check", `{} {}`, &out); err == nil || !strings.Contains(err.Error(), "single request") {
+		t.Fatalf("two unary requests error = %v", err)
+	}
+}
+
+func TestGrpcSchemaInvokePrintsEveryStreamedResponse(t *testing.T) {
+	healthServer, conn := startGrpcClientServer(t, true)
+	healthServer.SetServingStatus("api.WebService", grpc_health_v1.HealthCheckResponse_SERVING)
+	schema, err := loadGrpcSchema(context.Background(), conn, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		healthServer.SetServingStatus("api.WebService", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}()
+	var out bytes.Buffer
+	err = schema.invoke(ctx, conn, "grpc.health.v1.Health.Watch", `{"service": "api.WebService"}`, &out)
+	if err == nil || !strings.Contains(err.Error(), "DeadlineExceeded") {
+		t.Fatalf("Watch ended with %v, want the deadline", err)
+	}
+	serving, notServing := strings.Index(out.String(), `"SERVING"`), strings.Index(out.String(), `"NOT_SERVING"`)
+	if serving < 0 || notServing < serving {
+		t.Fatalf("Watch responses = %s", out.String())
+	}
+}
+
+func TestGrpcSchemaFallsBackToTheLocalProtoTree(t *testing.T) {
+	healthServer, conn := startGrpcClientServer(t, false)
+	healthServer.SetServingStatus("api.WebService", grpc_health_v1.HealthCheckResponse_SERVING)
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "grpc", "health", "v1", "health.proto"), healthProto)
+
+	schema, err := loadGrpcSchema(context.Background(), conn, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(schema.services, ",") != "grpc.health.v1.Health" {
+		t.Fatalf("services = %v", schema.services)
+	}
+	description, err := schema.describe("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(description, "rpc Ping ( .google.protobuf.Empty ) returns ( .google.protobuf.Empty );") {
+		t.Fatalf("description does not resolve well-known types:\n%s", description)
+	}
+
+	var out bytes.Buffer
+	if err := schema.invoke(context.Background(), conn, "grpc.health.v1.Health.Check", `{"service": "api.WebService"}`, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"SERVING"`) {
+		t.Fatalf("Check response = %s", out.String())
+	}
+}
+
+func TestParseGrpcCallArgs(t *testing.T) {
+	options, positional, err := parseGrpcCallArgs([]string{"-H", "Authorization: Bearer token", "pkg.Service.Method", "--deadline=2s", "-H=x-tenant:acme", `{"a":1}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(positional, " ") != `pkg.Service.Method {"a":1}` {
+		t.Fatalf("positional = %v", positional)
+	}
+	if options.deadline != 2*time.Second {
+		t.Fatalf("deadline = %v", options.deadline)
+	}
+	if got := options.headers.Get("authorization"); len(got) != 1 || got[0] != "Bearer token" {
+		t.Fatalf("authorization = %v", got)
+	}
+	ctx, cancel := options.context(context.Background())
+	defer cancel()
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if got := md.Get("x-tenant"); len(got) != 1 || got[0] != "acme" {
+		t.Fatalf("x-tenant = %v", got)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		t.Fatal("call context has no deadline")
+	}
+
+	for _, args := range [][]string{{"-H"}, {"-H", "no-colon"}, {"--deadline=soon"}, {"--plaintext"}} {
+		if _, _, err := parseGrpcCallArgs(args); err == nil {
+			t.Errorf("parseGrpcCallArgs(%v) accepted", args)
+		}
+	}
+}
+
+// chatProto declares a bidi stream whose messages share HealthCheckRequest's
+// wire format, so the test server can echo them with the generated type.
+const chatProto = `syntax = "proto3";
+package chat.v1;
+
+message Line {
+    string text = 1;
+}
+
+service Chat {
+    rpc Talk(stream Line) returns (stream Line);
+}
+`
+
+func TestGrpcSchemaInvokeStreamsRequestsFromAFile(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server echoes each line, upper-cased, as it arrives.
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		for {
+			line := &grpc_health_v1.HealthCheckRequest{}
+			if err := stream.RecvMsg(line); err != nil {
+				return nil
+			}
+			line.Service = strings.ToUpper(line.Service)
+			if err := stream.SendMsg(line); err != nil {
+				return err
+			}
+		}
+	}))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "chat", "v1", "chat.proto"), chatProto)
+	writeTestFile(t, filepath.Join(root, "requests.ndjson"), "{\"text\": \"one\"}\n{\"text\": \"two\"}\n")
+	schema, err := localGrpcSchema(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{"@requests.ndjson", `[{"text": "one"}, {"text": "two"}]`} {
+		payload, err := readGrpcPayload(root, arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := schema.invoke(context.Background(), conn, "chat.v1.Chat.Talk", payload, &out); err != nil {
+			t.Fatalf("invoke with %s: %v", arg, err)
+		}
+		one, two := strings.Index(out.String(), `"ONE"`), strings.Index(out.String(), `"TWO"`)
+		if one < 0 || two < one {
+			t.Fatalf("Talk responses for %s = %s", arg, out.String())
+		}
+	}
+	if _, err := readGrpcPayload(root, "@missing.ndjson"); err == nil {
+		t.Fatal("reading a missing payload file succeeded")
+	}
+	if err := schema.invoke(context.Background(), conn, "chat.v1.Chat.Talk", `[{"text": 1}]`, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "request 1 does not match") {
+		t.Fatalf("invalid streamed request error = %v", err)
+	}
+}
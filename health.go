@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthResult is one probe of the health command: the gRPC Health/Check of
+// the whole server or of one declared service, or an HTTP listener.
+type healthResult struct {
+	Endpoint string        `json:"endpoint"`
+	Target   string        `json:"target"`
+	Service  string        `json:"service,omitempty"`
+	Status   string        `json:"status"`
+	Latency  time.Duration `json:"latency_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+const (
+	healthServing    = "SERVING"
+	healthNotServing = "NOT_SERVING"
+	healthUnknown    = "UNKNOWN"
+)
+
+// healthWatchDefault bounds `health --watch` when no duration is given: the
+// command answers once, so transitions are collected for a while.
+const healthWatchDefault = 30 * time.Second
+
+type healthOptions struct {
+	json  bool
+	watch time.Duration
+}
+
+func parseHealthArgs(args []string) (healthOptions, error) {
+	var options healthOptions
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			options.json = true
+		case arg == "--watch":
+			options.watch = healthWatchDefault
+		case strings.HasPrefix(arg, "--watch="):
+			watch, err := time.ParseDuration(strings.TrimPrefix(arg, "--watch="))
+			if err != nil || watch <= 0 {
+				return options, fmt.Errorf("--watch takes a positive duration such as 1m, got %q", arg)
+			}
+			options.watch = watch
+		default:
+			return options, fmt.Errorf("unknown health argument %q (use --json, --watch or --watch=<duration>)", arg)
+		}
+	}
+	return options, nil
+}
+
+// checkGRPCHealth calls Health/Check for the whole server ("") and then for
+// each service.
+func checkGRPCHealth(ctx context.Context, client grpc_health_v1.HealthClient, target string, services []string) []healthResult {
+	results := make([]healthResult, 0, len(services)+1)
+	for _, service := range append([]string{""}, services...) {
+		result := healthResult{Endpoint: "grpc", Target: target, Service: service}
+		started := time.Now()
+		response, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+		result.Latency = time.Since(started)
+		if err != nil {
+			result.Status = healthUnknown
+			result.Error = err.Error()
+		} else {
+			result.Status = response.GetStatus().String()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkHTTPHealth probes an HTTP listener. The REST gateway answers /healthz
+// from the gRPC health service; the Connect listener has no health route, so
+// any HTTP answer shows it is up.
+func checkHTTPHealth(ctx context.Context, client *http.Client, endpoint, target string, requireOK bool) healthResult {
+	result := healthResult{Endpoint: endpoint, Target: target}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		result.Status = healthUnknown
+		result.Error = err.Error()
+		return result
+	}
+	started := time.Now()
+	response, err := client.Do(request)
+	result.Latency = time.Since(started)
+	if err != nil {
+		result.Status = healthUnknown
+		result.Error = err.Error()
+		return result
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+	switch {
+	case !requireOK && response.StatusCode < http.StatusInternalServerError, response.StatusCode == http.StatusOK:
+		result.Status = healthServing
+	case response.StatusCode == http.StatusServiceUnavailable:
+		result.Status = healthNotServing
+	default:
+		result.Status = healthUnknown
+		result.Error = response.Status
+	}
+	return result
+}
+
+// healthTransition is one status a Health/Watch stream delivered.
+type healthTransition struct {
+	At      time.Time `json:"at"`
+	Service string    `json:"service,omitempty"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// watchGRPCHealth follows Health/Watch for the whole server and each service
+// until ctx ends, returning every transition in arrival order. The first
+// message of each stream is the status at subscription time.
+func watchGRPCHealth(ctx context.Context, client grpc_health_v1.HealthClient, services []string) []healthTransition {
+	var (
+		mu          sync.Mutex
+		transitions []healthTransition
+		wg          sync.WaitGroup
+	)
+	record := func(transition healthTransition) {
+		mu.Lock()
+		defer mu.Unlock()
+		transitions = append(transitions, transition)
+	}
+	for _, service := range append([]string{""}, services...) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+			if err != nil {
+				record(healthTransition{At: time.Now(), Service: service, Status: healthUnknown, Error: err.Error()})
+				return
+			}
+			for {
+				response, err := stream.Recv()
+				if err != nil {
+					if ctx.Err() == nil {
+						record(healthTransition{At: time.Now(), Service: service, Status: healthUnknown, Error: err.Error()})
+					}
+					return
+				}
+				record(healthTransition{At: time.Now(), Service: service, Status: response.GetStatus().String()})
+			}
+		}()
+	}
+	wg.Wait()
+	return transitions
+}
+
+func healthy(results []healthResult) bool {
+	for _, result := range results {
+		if result.Status != healthServing {
+			return false
+		}
+	}
+	return true
+}
+
+func formatHealth(results []healthResult, asJSON bool) (string, error) {
+	if asJSON {
+		out, err := json.MarshalIndent(results, "", "  ")
+		return string(out) + "\n", err
+	}
+	var out strings.Builder
+	writer := tabwriter.NewWriter(&out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ENDPOINT\tTARGET\tSERVICE\tSTATUS\tLATENCY\tERROR")
+	for _, result := range results {
+		service := result.Service
+		if service == "" && result.Endpoint == "grpc" {
+			service = "(server)"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", result.Endpoint, result.Target, service, result.Status,
+			result.Latency.Round(time.Microsecond), result.Error)
+	}
+	err := writer.Flush()
+	return out.String(), err
+}
+
+func formatHealthTransitions(transitions []healthTransition, asJSON bool) (string, error) {
+	if asJSON {
+		out, err := json.MarshalIndent(transitions, "", "  ")
+		return string(out) + "\n", err
+	}
+	var out strings.Builder
+	for _, transition := range transitions {
+		service := transition.Service
+		if service == "" {
+			service = "(server)"
+		}
+		line := fmt.Sprintf("%s %s %s", transition.At.Format(time.RFC3339Nano), service, transition.Status)
+		if transition.Error != "" {
+			line += " " + transition.Error
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String(), nil
+}
+
+// endpointURL turns a network instance address (host:port, with or without a
+// scheme) into an http or https URL.
+func endpointURL(address string, secure bool, path string) string {
+	host := address
+	if parsed, err := url.Parse(address); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	return scheme + "://" + host + path
+}
+
+// healthHTTPClient reaches the HTTP listeners, over TLS when the service
+// serves it.
+func healthHTTPClient(config *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport, Timeout: 5 * time.Second}
+}
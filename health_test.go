@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func startHealthServer(t *testing.T) (*health.Server, grpc_health_v1.HealthClient) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthServer, grpc_health_v1.NewHealthClient(conn)
+}
+
+func TestCheckGRPCHealthReportsTheServerAndEachService(t *testing.T) {
+	healthServer, client := startHealthServer(t)
+	healthServer.SetServingStatus("api.WebService", grpc_health_v1.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("api.AdminService", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+
+	results := checkGRPCHealth(context.Background(), client, "localhost:9090", []string{"api.WebService", "api.AdminService", "api.Missing"})
+	want := []struct{ service, status string }{
+		{"", healthServing},
+		{"api.WebService", healthServing},
+		{"api.AdminService", healthNotServing},
+		{"api.Missing", healthUnknown},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, result := range results {
+		if result.Endpoint != "grpc" || result.Target != "localhost:9090" || result.Service != want[i].service || result.Status != want[i].status {
+			t.Errorf("result %d = %+v, want %s %s", i, result, want[i].service, want[i].status)
+		}
+	}
+	if results[3].Error == "" {
+		t.Error("an unregistered service carries no error")
+	}
+	if healthy(results) {
+		t.Error("healthy() = true with a NOT_SERVING service")
+	}
+	if !healthy(results[:2]) {
+		t.Error("healthy() = false with every probe SERVING")
+	}
+}
+
+func TestWatchGRPCHealthCollectsTransitions(t *testing.T) {
+	healthServer, client := startHealthServer(t)
+	healthServer.SetServingStatus("api.WebService", grpc_health_v1.HealthCheckResponse_SERVING)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		healthServer.SetServingStatus("api.WebService", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}()
+	var statuses []string
+	for _, transition := range watchGRPCHealth(ctx, client, []string{"api.WebService"}) {
+		if transition.Service == "api.WebService" {
+			statuses = append(statuses, transition.Status)
+		}
+	}
+	if strings.Join(statuses, ",") != "SERVING,NOT_SERVING" {
+		t.Fatalf("api.WebService transitions = %v, want SERVING then NOT_SERVING", statuses)
+	}
+}
+
+func TestCheckHTTPHealth(t *testing.T) {
+	serving := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/healthz":
+			http.NotFound(w, r)
+		case serving:
+			_, _ = w.Write([]byte(`{"status":"SERVING"}`))
+		default:
+			http.Error(w, `{"status":"NOT_SERVING"}`, http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	client := healthHTTPClient(nil)
+	ctx := context.Background()
+
+	if got := checkHTTPHealth(ctx, client, "rest", server.URL+"/healthz", true); got.Status != healthServing {
+		t.Fatalf("serving /healthz = %+v", got)
+	}
+	serving = false
+	if got := checkHTTPHealth(ctx, client, "rest", server.URL+"/healthz", true); got.Status != healthNotServing {
+		t.Fatalf("unavailable /healthz = %+v", got)
+	}
+	// The Connect listener has no health route: answering at all is enough.
+	if got := checkHTTPHealth(ctx, client, "connect", server.URL+"/", false); got.Status != healthServing {
+		t.Fatalf("connect listener = %+v", got)
+	}
+	if got := checkHTTPHealth(ctx, client, "rest", server.URL+"/", true); got.Status != healthUnknown || got.Error == "" {
+		t.Fatalf("missing /healthz = %+v", got)
+	}
+	server.Close()
+	if got := checkHTTPHealth(ctx, client, "rest", server.URL+"/healthz", true); got.Status != healthUnknown || got.Error == "" {
+		t.Fatalf("closed listener = %+v", got)
+	}
+}
+
+func TestParseHealthArgs(t *testing.T) {
+	options, err := parseHealthArgs([]string{"--json", "--watch"})
+	if err != nil || !options.json || options.watch != healthWatchDefault {
+		t.Fatalf("parseHealthArgs() = %+v, %v", options, err)
+	}
+	if options, err := parseHealthArgs([]string{"--watch=2m"}); err != nil || options.watch != 2*time.Minute {
+		t.Fatalf("parseHealthArgs(--watch=2m) = %+v, %v", options, err)
+	}
+	for _, args := range [][]string{{"--watch=soon"}, {"--watch=-1s"}, {"--verbose"}} {
+		if _, err := parseHealthArgs(args); err == nil {
+			t.Errorf("parseHealthArgs(%v) accepted", args)
+		}
+	}
+}
+
+func TestEndpointURL(t *testing.T) {
+	for _, test := range []struct {
+		address string
+		secure  bool
+		want    string
+	}{
+		{"localhost:8080", false, "http://localhost:8080/healthz"},
+		{"127.0.0.1:8080", true, "https://127.0.0.1:8080/healthz"},
+		{"http://localhost:8080", true, "https://localhost:8080/healthz"},
+	} {
+		if got := endpointURL(test.address, test.secure, "/healthz"); got != test.want {
+			t.Errorf("endpointURL(%q, %v) = %q, want %q", test.address, test.secure, got, test.want)
+		}
+	}
+}
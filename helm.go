@@ -0,0 +1,441 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Deployment formats: Deploy applies the kustomize manifests, or writes a
+// Helm chart for the platform to install.
+const (
+	deploymentFormatKustomize = "kustomize"
+	deploymentFormatHelm      = "helm"
+)
+
+// HelmSpec places the chart Deploy writes with deployment-format helm.
+//
+// The chart is self-contained and, like the kustomize overlay, written for the
+// environment being deployed: Chart.yaml, values.yaml carrying the image and
+// namespace of the deployment, the service account, endpoints, probes, the
+// environment's workload and error redaction, the ConfigMap the pods read
+// their configuration from and references to the keys of their Secret, and
+// templates equivalent to the kustomize base and overlay. The chart never
+// holds secret values: the Secret must exist in the namespace.
+type HelmSpec struct {
+	// Output is the chart directory, relative to the service root. Defaults
+	// to helm.
+	Output string `yaml:"output,omitempty"`
+	// ChartVersion is the chart's SemVer version. Defaults to 0.1.0.
+	ChartVersion string `yaml:"chart-version,omitempty"`
+}
+
+const (
+	defaultHelmOutput       = "helm"
+	defaultHelmChartVersion = "0.1.0"
+)
+
+// helmPolicy is the helm block with the defaults applied.
+type helmPolicy struct {
+	Output       string
+	ChartVersion string
+}
+
+// HelmPolicy is the declared helm block with the defaults applied.
+func (s *Settings) HelmPolicy() helmPolicy {
+	policy := helmPolicy{Output: defaultHelmOutput, ChartVersion: defaultHelmChartVersion}
+	if s.Helm == nil {
+		return policy
+	}
+	if s.Helm.Output != "" {
+		policy.Output = s.Helm.Output
+	}
+	if s.Helm.ChartVersion != "" {
+		policy.ChartVersion = s.Helm.ChartVersion
+	}
+	return policy
+}
+
+// Validate rejects an output outside the service and a version Helm refuses.
+func (h *HelmSpec) Validate() error {
+	if h == nil {
+		return nil
+	}
+	if h.Output != "" && (!filepath.IsLocal(h.Output) || h.Output == "." || strings.ContainsAny(h.Output, "\x00\\")) {
+		return fmt.Errorf("helm output %q must stay below the service root", h.Output)
+	}
+	if h.ChartVersion != "" && !semver.IsValid("v"+h.ChartVersion) {
+		return fmt.Errorf("helm chart-version %q is not a SemVer version", h.ChartVersion)
+	}
+	return nil
+}
+
+// dns1123Label matches a chart name.
+var dns1123Label = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// validateDeploymentFormat rejects an unknown format and, for helm, a helm
+// block the chart cannot be written with.
+func (s *Settings) validateDeploymentFormat() error {
+	switch s.DeploymentFormat {
+	case "", deploymentFormatKustomize:
+		return nil
+	case deploymentFormatHelm:
+		return s.Helm.Validate()
+	default:
+		return fmt.Errorf("deployment-format %q must be kustomize or helm", s.DeploymentFormat)
+	}
+}
+
+// helmChartFile is Chart.yaml.
+type helmChartFile struct {
+	APIVersion  string `yaml:"apiVersion"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	Version     string `yaml:"version"`
+	AppVersion  string `yaml:"appVersion"`
+}
+
+// helmValues is values.yaml. Every key a template reads through .Values is
+// always written, so the lint can resolve it.
+type helmValues struct {
+	// Namespace defaults to the release's.
+	Namespace                     string             `yaml:"namespace"`
+	Image                         helmImage          `yaml:"image"`
+	ServiceAccount                helmServiceAccount `yaml:"serviceAccount"`
+	Endpoints                     helmEndpoints      `yaml:"endpoints"`
+	Config                        helmConfig         `yaml:"config"`
+	Secrets                       helmSecrets        `yaml:"secrets"`
+	TLS                           helmTLS            `yaml:"tls"`
+	Probes                        helmProbes         `yaml:"probes"`
+	TerminationGracePeriodSeconds int                `yaml:"terminationGracePeriodSeconds"`
+	Errors                        helmErrors         `yaml:"errors"`
+	helmWorkload                  `yaml:",inline"`
+}
+
+type helmImage struct {
+	Repository string `yaml:"repository"`
+	// Tag defaults to the chart's appVersion.
+	Tag string `yaml:"tag"`
+}
+
+type helmServiceAccount struct {
+	Name        string            `yaml:"name"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+}
+
+type helmEndpoints struct {
+	GRPC    helmEndpoint `yaml:"grpc"`
+	REST    helmEndpoint `yaml:"rest"`
+	Connect helmEndpoint `yaml:"connect"`
+}
+
+type helmEndpoint struct {
+	Enabled bool   `yaml:"enabled"`
+	Port    uint16 `yaml:"port"`
+}
+
+// helmConfig is the ConfigMap the pods read their configuration from, named
+// as the kustomize overlay names it.
+type helmConfig struct {
+	ConfigMap string            `yaml:"configMap"`
+	Data      map[string]string `yaml:"data"`
+}
+
+// helmSecrets points the pods' secret variables at the Secret holding them.
+type helmSecrets struct {
+	// References maps an environment variable to a key of an existing
+	// secret.
+	References map[string]helmSecretReference `yaml:"references"`
+}
+
+type helmSecretReference struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type helmTLS struct {
+	Enabled    bool   `yaml:"enabled"`
+	Secret     string `yaml:"secret"`
+	MountPath  string `yaml:"mountPath"`
+	ClientAuth string `yaml:"clientAuth"`
+}
+
+type helmProbes struct {
+	Type      string    `yaml:"type"`
+	Startup   helmProbe `yaml:"startup"`
+	Readiness helmProbe `yaml:"readiness"`
+	Liveness  helmProbe `yaml:"liveness"`
+}
+
+type helmProbe struct {
+	Service             string `yaml:"service,omitempty"`
+	InitialDelaySeconds int    `yaml:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int    `yaml:"periodSeconds"`
+	TimeoutSeconds      int    `yaml:"timeoutSeconds"`
+	FailureThreshold    int    `yaml:"failureThreshold"`
+}
+
+// helmWorkload is the environment's workload, as its overlay renders it.
+type helmWorkload struct {
+	Replicas         int                  `yaml:"replicas"`
+	Resources        ResourcesSpec        `yaml:"resources"`
+	Autoscaling      helmAutoscaling      `yaml:"autoscaling"`
+	DisruptionBudget helmDisruptionBudget `yaml:"disruptionBudget"`
+	TopologySpread   []helmTopologySpread `yaml:"topologySpread"`
+}
+
+// helmAutoscaling and helmDisruptionBudget write every key, zero or null
+// included: Helm merges a values file given at install into values.yaml key
+// by key, so an unset key would keep the chart's.
+type helmAutoscaling struct {
+	Enabled     bool            `yaml:"enabled"`
+	MinReplicas int             `yaml:"minReplicas"`
+	MaxReplicas int             `yaml:"maxReplicas"`
+	CPU         int             `yaml:"cpu"`
+	Memory      int             `yaml:"memory"`
+	Metrics     []helmPodMetric `yaml:"metrics"`
+}
+
+type helmPodMetric struct {
+	Name         string `yaml:"name"`
+	AverageValue string `yaml:"averageValue"`
+}
+
+// helmDisruptionBudget holds counts as numbers and percentages as strings,
+// as the PodDisruptionBudget takes them.
+type helmDisruptionBudget struct {
+	Enabled        bool `yaml:"enabled"`
+	MinAvailable   any  `yaml:"minAvailable"`
+	MaxUnavailable any  `yaml:"maxUnavailable"`
+}
+
+// helmErrors sets CODEFLY_ERRORS_REDACT.
+type helmErrors struct {
+	Redact bool `yaml:"redact"`
+}
+
+type helmTopologySpread struct {
+	MaxSkew           int    `yaml:"maxSkew"`
+	TopologyKey       string `yaml:"topologyKey"`
+	WhenUnsatisfiable string `yaml:"whenUnsatisfiable"`
+}
+
+// helmDeployment is what a deploy request adds to the chart, as
+// DeployKustomize hands it to the kustomize templates: where the service runs,
+// the image it runs and the environment its pods read. Secrets names the
+// secret variables only; the chart references them in the Secret.
+type helmDeployment struct {
+	Namespace string
+	Image     helmImage
+	ConfigMap map[string]string
+	Secrets   []string
+}
+
+// helmChart is everything writeHelmChart writes but the templates.
+type helmChart struct {
+	Chart  helmChartFile
+	Values helmValues
+}
+
+// newHelmChart maps the deployment parameters and request onto the chart of
+// the named service: the values the kustomize base and the deploying
+// environment's overlay render with.
+func newHelmChart(name, version string, params DeploymentParameters, deployment helmDeployment) helmChart {
+	probes := params.probes()
+	probe := func(timing probeTiming) helmProbe {
+		return helmProbe{
+			Service:             timing.Service,
+			InitialDelaySeconds: timing.InitialDelaySeconds,
+			PeriodSeconds:       timing.PeriodSeconds,
+			TimeoutSeconds:      timing.TimeoutSeconds,
+			FailureThreshold:    timing.FailureThreshold,
+		}
+	}
+	values := helmValues{
+		Namespace: deployment.Namespace,
+		Image:     deployment.Image,
+		Endpoints: helmEndpoints{
+			GRPC:    helmEndpoint{Enabled: true, Port: params.GRPCPort()},
+			REST:    helmEndpoint{Enabled: params.RestEndpoint, Port: params.RESTPort()},
+			Connect: helmEndpoint{Enabled: params.ConnectEndpoint, Port: params.ConnectPort()},
+		},
+		Config:  helmConfig{ConfigMap: "cm-" + name, Data: map[string]string{}},
+		Secrets: helmSecrets{References: map[string]helmSecretReference{}},
+		Probes: helmProbes{
+			Type:      probes.Type,
+			Startup:   probe(probes.Startup),
+			Readiness: probe(probes.Readiness),
+			Liveness:  probe(probes.Liveness),
+		},
+		TerminationGracePeriodSeconds: params.TerminationGracePeriodSeconds,
+		Errors:                        helmErrors{Redact: params.RedactErrors},
+		helmWorkload:                  newHelmWorkload(params.EnvironmentProfile()),
+	}
+	if values.Image.Repository == "" {
+		values.Image.Repository = name
+	}
+	maps.Copy(values.Config.Data, deployment.ConfigMap)
+	for _, key := range deployment.Secrets {
+		values.Secrets.References[key] = helmSecretReference{Name: "secret-" + name, Key: key}
+	}
+	if values.TerminationGracePeriodSeconds == 0 {
+		values.TerminationGracePeriodSeconds = 30
+	}
+	if sa := params.ServiceAccount; sa != nil {
+		values.ServiceAccount = helmServiceAccount{Name: sa.Name, Annotations: sa.Annotations, Labels: sa.Labels}
+	}
+	if tls := params.TLS; tls != nil {
+		values.TLS = helmTLS{Enabled: true, Secret: tls.Secret, MountPath: tls.MountPath, ClientAuth: tls.ClientAuth}
+	}
+
+	return helmChart{
+		Chart: helmChartFile{
+			APIVersion:  "v2",
+			Name:        name,
+			Description: fmt.Sprintf("The %s gRPC service.", name),
+			Type:        "application",
+			Version:     version,
+			AppVersion:  version,
+		},
+		Values: values,
+	}
+}
+
+func newHelmWorkload(policy deploymentPolicy) helmWorkload {
+	workload := helmWorkload{
+		Replicas:       policy.Replicas,
+		Resources:      policy.Resources,
+		Autoscaling:    helmAutoscaling{Metrics: []helmPodMetric{}},
+		TopologySpread: []helmTopologySpread{},
+	}
+	if workload.Replicas == 0 {
+		workload.Replicas = 1
+	}
+	if a := policy.Autoscaling; a != nil {
+		workload.Autoscaling = helmAutoscaling{Enabled: true, MinReplicas: a.MinReplicas, MaxReplicas: a.MaxReplicas, CPU: a.CPU, Memory: a.Memory, Metrics: []helmPodMetric{}}
+		for _, metric := range a.Metrics {
+			workload.Autoscaling.Metrics = append(workload.Autoscaling.Metrics, helmPodMetric{Name: metric.Name, AverageValue: metric.AverageValue})
+		}
+	}
+	if b := policy.DisruptionBudget; b != nil {
+		workload.DisruptionBudget = helmDisruptionBudget{Enabled: true, MinAvailable: countOrPercentValue(b.MinAvailable), MaxUnavailable: countOrPercentValue(b.MaxUnavailable)}
+	}
+	for _, spread := range policy.TopologySpread {
+		workload.TopologySpread = append(workload.TopologySpread, helmTopologySpread{MaxSkew: spread.MaxSkew, TopologyKey: spread.TopologyKey, WhenUnsatisfiable: spread.WhenUnsatisfiable})
+	}
+	return workload
+}
+
+// countOrPercentValue is a count as a number, a percentage as a string and
+// nothing as nil.
+func countOrPercentValue(value string) any {
+	if value == "" {
+		return nil
+	}
+	if count, err := strconv.Atoi(value); err == nil {
+		return count
+	}
+	return value
+}
+
+// helmTemplatesRoot is where helmFS keeps the chart's templates directory.
+const helmTemplatesRoot = "templates/helm/templates"
+
+// writeHelmChart writes the chart to dir. It stages the chart beside dir and
+// lints it first, so a chart that fails the lint never replaces the last good
+// one. dir must be absent, empty or an earlier chart: Deploy replaces it
+// whole.
+func writeHelmChart(dir string, chart helmChart) (err error) {
+	if err := checkHelmOutput(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return fmt.Errorf("create helm output parent: %w", err)
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dir), ".helm-*")
+	if err != nil {
+		return fmt.Errorf("stage helm chart: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(staging)
+		}
+	}()
+
+	files := map[string]any{
+		"Chart.yaml":  chart.Chart,
+		"values.yaml": chart.Values,
+	}
+	for name, content := range files {
+		data, err := yaml.Marshal(content)
+		if err != nil {
+			return fmt.Errorf("render helm %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(staging, name), data, 0o644); err != nil {
+			return fmt.Errorf("write helm %s: %w", name, err)
+		}
+	}
+	if err := copyHelmTemplates(filepath.Join(staging, "templates")); err != nil {
+		return err
+	}
+	if err := lintHelmChart(staging); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("remove previous helm chart: %w", err)
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		return fmt.Errorf("move helm chart into place: %w", err)
+	}
+	return os.Chmod(dir, 0o755)
+}
+
+// checkHelmOutput refuses to replace a directory that holds anything but a
+// chart.
+func checkHelmOutput(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read helm output: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Chart.yaml")); err != nil {
+		return fmt.Errorf("helm output %s is not empty and holds no Chart.yaml: refusing to replace it", dir)
+	}
+	return nil
+}
+
+func copyHelmTemplates(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create helm templates: %w", err)
+	}
+	entries, err := fs.ReadDir(helmFS, helmTemplatesRoot)
+	if err != nil {
+		return fmt.Errorf("read embedded helm templates: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		data, err := fs.ReadFile(helmFS, path.Join(helmTemplatesRoot, name))
+		if err != nil {
+			return fmt.Errorf("read embedded helm template %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return fmt.Errorf("write helm template %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// lintHelmChart checks the structure of the chart in dir without helm or a
+// cluster: Chart.yaml names a v2 chart with a SemVer version, the values
+// files parse and only override keys values.yaml declares, and every
+// template parses, reads only declared values and renders, with values.yaml
+// and with each environment's values, manifests that name their apiVersion,
+// kind and metadata.name. It knows the template functions the chart uses, so
+// a template calling any other fails the lint.
+func lintHelmChart(dir string) error {
+	var errs []error
+	chart, err := lintHelmChartFile(dir)
+	if err != nil {
+		return err
+	}
+	values, err := readHelmValues(filepath.Join(dir, "values.yaml"))
+	if err != nil {
+		return err
+	}
+	variants := map[string]map[string]any{"values.yaml": values}
+	overrides, err := filepath.Glob(filepath.Join(dir, "values-*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, file := range overrides {
+		override, err := readHelmValues(file)
+		if err != nil {
+			return err
+		}
+		for _, key := range undeclaredValues(override, values, "") {
+			errs = append(errs, fmt.Errorf("%s overrides %s, which values.yaml does not declare", filepath.Base(file), key))
+		}
+		variants[filepath.Base(file)] = mergeHelmValues(values, override)
+	}
+
+	templates, manifests, err := parseHelmTemplates(filepath.Join(dir, "templates"))
+	if err != nil {
+		return err
+	}
+	for _, name := range manifests {
+		source := templates.Lookup(name).Tree.Root.String()
+		for _, match := range helmValuesReference.FindAllStringSubmatch(source, -1) {
+			if !helmValueDeclared(values, strings.Split(strings.TrimPrefix(match[1], "."), ".")) {
+				errs = append(errs, fmt.Errorf("templates/%s reads .Values%s, which values.yaml does not declare", name, match[1]))
+			}
+		}
+	}
+	variantNames := make([]string, 0, len(variants))
+	for variant := range variants {
+		variantNames = append(variantNames, variant)
+	}
+	sort.Strings(variantNames)
+	for _, variant := range variantNames {
+		data := map[string]any{
+			"Values":  variants[variant],
+			"Chart":   map[string]any{"Name": chart.Name, "Version": chart.Version, "AppVersion": chart.AppVersion},
+			"Release": map[string]any{"Name": chart.Name, "Namespace": "default", "Service": "Helm"},
+		}
+		for _, name := range manifests {
+			var out bytes.Buffer
+			if err := templates.ExecuteTemplate(&out, name, data); err != nil {
+				errs = append(errs, fmt.Errorf("templates/%s does not render with %s: %w", name, variant, err))
+				continue
+			}
+			if err := lintHelmManifests(out.Bytes()); err != nil {
+				errs = append(errs, fmt.Errorf("templates/%s with %s: %w", name, variant, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func lintHelmChartFile(dir string) (helmChartFile, error) {
+	var chart helmChartFile
+	data, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return chart, fmt.Errorf("chart has no Chart.yaml: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return chart, fmt.Errorf("parse Chart.yaml: %w", err)
+	}
+	switch {
+	case chart.APIVersion != "v2":
+		return chart, fmt.Errorf("Chart.yaml apiVersion %q must be v2", chart.APIVersion)
+	case len(chart.Name) > 53 || !dns1123Label.MatchString(chart.Name):
+		return chart, fmt.Errorf("Chart.yaml name %q must be a DNS-1123 label of at most 53 characters", chart.Name)
+	case !semver.IsValid("v" + chart.Version):
+		return chart, fmt.Errorf("Chart.yaml version %q is not a SemVer version", chart.Version)
+	case chart.Type != "" && chart.Type != "application" && chart.Type != "library":
+		return chart, fmt.Errorf("Chart.yaml type %q must be application or library", chart.Type)
+	}
+	return chart, nil
+}
+
+func readHelmValues(file string) (map[string]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", filepath.Base(file), err)
+	}
+	values := map[string]any{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(file), err)
+	}
+	return values, nil
+}
+
+// helmValuesReference is a .Values path a template reads.
+var helmValuesReference = regexp.MustCompile(`\.Values((?:\.[A-Za-z_][A-Za-z0-9_]*)+)`)
+
+func helmValueDeclared(values map[string]any, path []string) bool {
+	value, ok := values[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	nested, ok := value.(map[string]any)
+	return ok && helmValueDeclared(nested, path[1:])
+}
+
+// undeclaredValues lists the keys of override that values does not declare.
+// Below a map values declares empty, such as secrets.references, any key is
+// allowed.
+func undeclaredValues(override, values map[string]any, prefix string) []string {
+	var undeclared []string
+	for key, value := range override {
+		base, ok := values[key]
+		if !ok {
+			undeclared = append(undeclared, prefix+key)
+			continue
+		}
+		nested, isMap := value.(map[string]any)
+		declared, declaredMap := base.(map[string]any)
+		if isMap && declaredMap && len(declared) > 0 {
+			undeclared = append(undeclared, undeclaredValues(nested, declared, prefix+key+".")...)
+		}
+	}
+	sort.Strings(undeclared)
+	return undeclared
+}
+
+// mergeHelmValues merges override into values as helm does: maps key by
+// key, anything else replaced, and a null override removing the key.
+func mergeHelmValues(values, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(values))
+	for key, value := range values {
+		merged[key] = value
+	}
+	for key, value := range override {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		nested, isMap := value.(map[string]any)
+		base, baseMap := merged[key].(map[string]any)
+		if isMap && baseMap {
+			merged[key] = mergeHelmValues(base, nested)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// parseHelmTemplates parses the chart's templates into one set, as helm does,
+// and lists the manifests among them: the files not starting with an
+// underscore, which only hold definitions.
+func parseHelmTemplates(dir string) (*template.Template, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chart has no templates: %w", err)
+	}
+	set := template.New("chart")
+	set.Funcs(helmLintFuncs(set))
+	var manifests []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			return nil, nil, fmt.Errorf("templates/%s: subdirectories are not linted", name)
+		}
+		switch filepath.Ext(name) {
+		case ".yaml", ".yml", ".tpl":
+		case ".txt":
+			continue
+		default:
+			return nil, nil, fmt.Errorf("templates/%s is neither a manifest nor a .tpl helper", name)
+		}
+		source, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := set.New(name).Parse(string(source)); err != nil {
+			return nil, nil, fmt.Errorf("parse templates/%s: %w", name, err)
+		}
+		if !strings.HasPrefix(name, "_") && filepath.Ext(name) != ".tpl" {
+			manifests = append(manifests, name)
+		}
+	}
+	if len(manifests) == 0 {
+		return nil, nil, fmt.Errorf("chart templates hold no manifest")
+	}
+	return set, manifests, nil
+}
+
+// lintHelmManifests checks each YAML document a template rendered.
+func lintHelmManifests(rendered []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(rendered))
+	for {
+		var manifest struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+		}
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("rendered invalid YAML: %w", err)
+		}
+		if len(document.Content) == 0 || document.Content[0].Kind == yaml.ScalarNode && document.Content[0].Tag == "!!null" {
+			continue
+		}
+		if err := document.Decode(&manifest); err != nil {
+			return fmt.Errorf("rendered a document that is not a manifest: %w", err)
+		}
+		if manifest.APIVersion == "" || manifest.Kind == "" || manifest.Metadata.Name == "" {
+			return fmt.Errorf("rendered a manifest without apiVersion, kind or metadata.name")
+		}
+	}
+}
+
+// helmLintFuncs are the template functions of helm the chart uses, enough
+// alike to render it.
+func helmLintFuncs(set *template.Template) template.FuncMap {
+	indent := func(spaces int, text string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+	}
+	return template.FuncMap{
+		"include": func(name string, data any) (string, error) {
+			var out bytes.Buffer
+			err := set.ExecuteTemplate(&out, name, data)
+			return out.String(), err
+		},
+		"toYaml": func(value any) (string, error) {
+			var out bytes.Buffer
+			encoder := yaml.NewEncoder(&out)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(value); err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(out.String(), "\n"), encoder.Close()
+		},
+		"indent": indent,
+		"nindent": func(spaces int, text string) string {
+			return "\n" + indent(spaces, text)
+		},
+		"quote": func(value any) string {
+			return strconv.Quote(fmt.Sprint(value))
+		},
+		"default": func(fallback any, given ...any) any {
+			if len(given) == 0 || given[0] == nil || given[0] == "" || given[0] == false || given[0] == 0 {
+				return fallback
+			}
+			return given[0]
+		},
+		"required": func(message string, value any) (any, error) {
+			if value == nil || value == "" {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		"dict": func(pairs ...any) (map[string]any, error) {
+			if len(pairs)%2 != 0 {
+				return nil, errors.New("dict takes key and value pairs")
+			}
+			dict := make(map[string]any, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				dict[fmt.Sprint(pairs[i])] = pairs[i+1]
+			}
+			return dict, nil
+		},
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// helmTestDeployment is a deploy request's share of the chart.
+var helmTestDeployment = helmDeployment{
+	Namespace: "shop",
+	Image:     helmImage{Repository: "registry.example.com/orders", Tag: "1.2.0"},
+	ConfigMap: map[string]string{"CODEFLY__SERVICE_CONFIGURATION__SHOP__ORDERS__DATABASE__HOST": "postgres"},
+	Secrets:   []string{"CODEFLY__SERVICE_SECRET_CONFIGURATION__SHOP__ORDERS__DATABASE__PASSWORD"},
+}
+
+func helmTestChart(t *testing.T) helmChart {
+	t.Helper()
+	return helmTestChartFor(t, "production", helmTestDeployment)
+}
+
+// helmTestChartFor is the chart of a deploy of helmTestDeployment to
+// environment.
+func helmTestChartFor(t *testing.T, environment string, deployment helmDeployment) helmChart {
+	t.Helper()
+	settings := &Settings{
+		RestEndpoint: true,
+		TLS:          &TLSSpec{Secret: "orders-tls"},
+		Deployment: &DeploymentSpec{
+			DeploymentProfile: DeploymentProfile{
+				Replicas:         3,
+				DisruptionBudget: &DisruptionBudgetSpec{MinAvailable: "2"},
+				TopologySpread:   []TopologySpreadSpec{{TopologyKey: "topology.kubernetes.io/zone"}},
+			},
+			Environments: map[string]*DeploymentProfile{
+				"production": {
+					Resources:        &ResourcesSpec{Requests: ResourceQuantities{CPU: "500m"}, Limits: ResourceQuantities{CPU: "2"}},
+					Autoscaling:      &AutoscalingSpec{MinReplicas: 3, MaxReplicas: 10, CPU: 70, Metrics: []PodMetricSpec{{Name: "grpc_requests_per_second", AverageValue: "100"}}},
+					DisruptionBudget: &DisruptionBudgetSpec{MaxUnavailable: "25%"},
+				},
+				"staging": {Replicas: 1, DisruptionBudget: &DisruptionBudgetSpec{}},
+			},
+		},
+	}
+	params := DeploymentParameters{
+		ServiceAccount: &ServiceAccountSpec{Name: "orders", Annotations: map[string]string{"iam.gke.io/gcp-service-account": "orders@project.iam.gserviceaccount.com"}},
+		RestEndpoint:   true,
+		TLS:            &DeploymentTLS{Secret: "orders-tls", MountPath: "/etc/tls", ClientAuth: tlsClientAuthNone},
+		RedactErrors:   settings.RedactErrors(environment),
+
+		TerminationGracePeriodSeconds: 40,
+		Ports:                         DeploymentPorts{GRPC: 9090},
+		Probes:                        settings.ProbePolicy(),
+		Workload:                      settings.DeploymentPolicy(""),
+		EnvironmentWorkload:           settings.DeploymentPolicy(environment),
+	}
+	return newHelmChart("orders", "1.2.0", params, deployment)
+}
+
+// readHelmTestValues reads the values.yaml of the chart written to dir.
+func readHelmTestValues(t *testing.T, dir string) map[string]any {
+	t.Helper()
+	var values map[string]any
+	data, err := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestHelmChartIsWrittenAndLints(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "helm")
+	if err := writeHelmChart(dir, helmTestChart(t)); err != nil {
+		t.Fatalf("writeHelmChart() error = %v", err)
+	}
+	for _, file := range []string{
+		"Chart.yaml", "values.yaml",
+		"templates/_helpers.tpl", "templates/deployment.yaml", "templates/service.yaml",
+		"templates/serviceaccount.yaml", "templates/hpa.yaml", "templates/pdb.yaml",
+		"templates/configmap.yaml",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("chart has no %s: %v", file, err)
+		}
+	}
+
+	values := readHelmTestValues(t, dir)
+	endpoints := values["endpoints"].(map[string]any)
+	if got := endpoints["grpc"].(map[string]any)["port"]; got != 9090 {
+		t.Errorf("values endpoints.grpc.port = %v, want 9090", got)
+	}
+	if got := values["probes"].(map[string]any)["type"]; got != probeTCP {
+		t.Errorf("values probes.type = %v, want tcp under TLS", got)
+	}
+	if got := values["autoscaling"].(map[string]any)["enabled"]; got != true {
+		t.Errorf("values autoscaling.enabled = %v, want production's autoscaler", got)
+	}
+	if got := values["resources"].(map[string]any)["requests"].(map[string]any)["cpu"]; got != "500m" {
+		t.Errorf("values resources.requests.cpu = %v, want production's 500m", got)
+	}
+	if got := values["errors"].(map[string]any)["redact"]; got != true {
+		t.Errorf("values errors.redact = %v, want true in production", got)
+	}
+
+	// A second deploy, here to another environment, replaces the chart it
+	// wrote.
+	if err := writeHelmChart(dir, helmTestChartFor(t, "staging", helmTestDeployment)); err != nil {
+		t.Fatalf("rewriting the chart: writeHelmChart() error = %v", err)
+	}
+	staging := readHelmTestValues(t, dir)
+	if got := staging["replicas"]; got != 1 {
+		t.Errorf("staging values replicas = %v, want 1", got)
+	}
+	if budget := staging["disruptionBudget"].(map[string]any); budget["enabled"] != false {
+		t.Errorf("staging values disruptionBudget = %v, want the base budget turned off", budget)
+	}
+	if got := staging["errors"].(map[string]any)["redact"]; got != false {
+		t.Errorf("staging values errors.redact = %v, want false", got)
+	}
+}
+
+// renderHelmChart renders the chart written to dir with values.yaml, as the
+// lint does, and returns the manifests by template name.
+func renderHelmChart(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	values, err := readHelmValues(filepath.Join(dir, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, manifests, err := parseHelmTemplates(filepath.Join(dir, "templates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{
+		"Values":  values,
+		"Chart":   map[string]any{"Name": "orders", "Version": "1.2.0", "AppVersion": "1.2.0"},
+		"Release": map[string]any{"Name": "orders", "Namespace": "default", "Service": "Helm"},
+	}
+	rendered := map[string]string{}
+	for _, name := range manifests {
+		var out strings.Builder
+		if err := templates.ExecuteTemplate(&out, name, data); err != nil {
+			t.Fatalf("render %s: %v", name, err)
+		}
+		rendered[name] = out.String()
+	}
+	return rendered
+}
+
+func TestHelmChartCarriesTheDeployment(t *testing.T) {
+	secretKey := helmTestDeployment.Secrets[0]
+	tests := map[string]struct {
+		deployment helmDeployment
+		want       map[string][]string
+		unwanted   map[string][]string
+	}{
+		"deployment": {
+			deployment: helmTestDeployment,
+			want: map[string][]string{
+				"deployment.yaml": {
+					"namespace: shop\n",
+					`image: "registry.example.com/orders:1.2.0"`,
+					"- configMapRef:\n                name: cm-orders\n",
+					"- name: " + secretKey + "\n              valueFrom:\n                secretKeyRef:\n                  name: secret-orders\n                  key: " + secretKey + "\n",
+				},
+				"configmap.yaml": {"name: cm-orders\n", "namespace: shop\n", `CODEFLY__SERVICE_CONFIGURATION__SHOP__ORDERS__DATABASE__HOST: "postgres"`},
+				"service.yaml":   {"namespace: shop\n"},
+			},
+			unwanted: map[string][]string{"deployment.yaml": {"secretRef:"}},
+		},
+		"release namespace": {
+			deployment: helmDeployment{},
+			want: map[string][]string{
+				"deployment.yaml": {"namespace: default\n", `image: "orders:1.2.0"`},
+				"configmap.yaml":  {"namespace: default\n"},
+			},
+			unwanted: map[string][]string{"deployment.yaml": {"secretKeyRef"}},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "helm")
+			if err := writeHelmChart(dir, helmTestChartFor(t, "production", test.deployment)); err != nil {
+				t.Fatalf("writeHelmChart() error = %v", err)
+			}
+			rendered := renderHelmChart(t, dir)
+			for file, wants := range test.want {
+				for _, want := range wants {
+					if !strings.Contains(rendered[file], want) {
+						t.Errorf("%s missing %q:\n%s", file, want, rendered[file])
+					}
+				}
+			}
+			for file, unwanted := range test.unwanted {
+				for _, value := range unwanted {
+					if strings.Contains(rendered[file], value) {
+						t.Errorf("%s contains %q:\n%s", file, value, rendered[file])
+					}
+				}
+			}
+			for file, manifest := range rendered {
+				if strings.Contains(manifest, "kind: Secret") {
+					t.Errorf("%s writes a Secret:\n%s", file, manifest)
+				}
+			}
+		})
+	}
+}
+
+func TestHelmChartRefusesAForeignOutput(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := writeHelmChart(dir, helmTestChart(t))
+	if err == nil || !strings.Contains(err.Error(), "holds no Chart.yaml") {
+		t.Fatalf("writeHelmChart() error = %v, want a refusal", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.go")); err != nil {
+		t.Fatalf("the refused output lost its files: %v", err)
+	}
+}
+
+func TestHelmLintRejectsBrokenCharts(t *testing.T) {
+	tests := map[string]struct {
+		file, content string
+		want          string
+	}{
+		"chart version": {"Chart.yaml", "apiVersion: v2\nname: orders\ntype: application\nversion: one\n", "is not a SemVer version"},
+		"chart api":     {"Chart.yaml", "apiVersion: v1\nname: orders\nversion: 1.0.0\n", "must be v2"},
+		"override key":  {"values-staging.yaml", "replica: 2\n", "overrides replica, which values.yaml does not declare"},
+		"undeclared value": {"templates/configmap.yaml",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Values.configMapName }}\n",
+			"reads .Values.configMapName"},
+		"unknown function": {"templates/configmap.yaml",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ lookup \"v1\" \"ConfigMap\" \"\" \"x\" }}\n",
+			"function \"lookup\" not defined"},
+		"not a manifest": {"templates/configmap.yaml", "data:\n  key: value\n", "without apiVersion, kind or metadata.name"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "helm")
+			if err := writeHelmChart(dir, helmTestChart(t)); err != nil {
+				t.Fatalf("writeHelmChart() error = %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, test.file), []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := lintHelmChart(dir)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("lintHelmChart() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestSettingsValidateDeploymentFormat(t *testing.T) {
+	tests := map[string]struct {
+		settings Settings
+		want     string
+	}{
+		"default":         {Settings{}, ""},
+		"kustomize":       {Settings{DeploymentFormat: deploymentFormatKustomize}, ""},
+		"helm":            {Settings{DeploymentFormat: deploymentFormatHelm, Helm: &HelmSpec{Output: "deploy/chart", ChartVersion: "2.0.0-rc.1"}}, ""},
+		"unknown":         {Settings{DeploymentFormat: "terraform"}, "must be kustomize or helm"},
+		"escaping output": {Settings{DeploymentFormat: deploymentFormatHelm, Helm: &HelmSpec{Output: "../chart"}}, "must stay below the service root"},
+		"absolute output": {Settings{DeploymentFormat: deploymentFormatHelm, Helm: &HelmSpec{Output: "/tmp/chart"}}, "must stay below the service root"},
+		"root output":     {Settings{DeploymentFormat: deploymentFormatHelm, Helm: &HelmSpec{Output: "."}}, "must stay below the service root"},
+		"bad version":     {Settings{DeploymentFormat: deploymentFormatHelm, Helm: &HelmSpec{ChartVersion: "v1"}}, "is not a SemVer version"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.settings.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -84,6 +84,65 @@ type Settings struct {
 	// ServiceAccount instead of the namespace default. Empty (the default)
 	// leaves pods on the default SA. See ServiceAccountSpec.
 	ServiceAccount *ServiceAccountSpec `yaml:"service-account,omitempty"`
+
+	// Cors restricts which browser origins may call the REST gateway and
+	// Connect listeners. Unset keeps the permissive development default. See
+	// CorsSpec.
+	Cors *CorsSpec `yaml:"cors,omitempty"`
+
+	// TLS serves every listener over TLS, and optionally mTLS. Unset keeps
+	// them plaintext (h2c for Connect). See TLSSpec.
+	TLS *TLSSpec `yaml:"tls,omitempty"`
+
+	// Errors names the production environments, whose deployments redact
+	// the messages of internal errors. Unset redacts in "production" only.
+	// See ErrorsSpec.
+	Errors *ErrorsSpec `yaml:"errors,omitempty"`
+
+	// AccessLog bounds and redacts the request log of the REST gateway and
+	// Connect listeners. Unset captures JSON bodies up to 4 KiB and logs
+	// every request. See AccessLogSpec.
+	AccessLog *AccessLogSpec `yaml:"access-log,omitempty"`
+
+	// Shutdown sets how long the server drains and then waits for requests
+	// in flight on SIGTERM. Unset drains for 5s and waits 20s. See
+	// ShutdownSpec.
+	Shutdown *ShutdownSpec `yaml:"shutdown,omitempty"`
+
+	// Ports sets the container ports of the listeners in the image and the
+	// manifests. Unset keeps 9090 (gRPC), 8080 (REST) and 8081 (Connect).
+	// See PortsSpec.
+	Ports *PortsSpec `yaml:"ports,omitempty"`
+
+	// Probes sets how the kubelet checks the pods' health. Unset probes the
+	// gRPC health server (the gRPC listener with TLS). See ProbesSpec.
+	Probes *ProbesSpec `yaml:"probes,omitempty"`
+
+	// Deployment sizes and schedules the pods: replicas, resources,
+	// autoscaling, disruption budget and topology spread, with overrides per
+	// environment. Unset deploys codefly's replicas with 100m/128Mi requests
+	// and 1 CPU/512Mi limits. See DeploymentSpec.
+	Deployment *DeploymentSpec `yaml:"deployment,omitempty"`
+
+	// DeploymentFormat is how Deploy ships the service: "kustomize" (the
+	// default) applies the kustomize manifests, "helm" writes a chart for the
+	// platform to install. See HelmSpec.
+	DeploymentFormat string `yaml:"deployment-format,omitempty"`
+
+	// Helm places the chart of deployment-format helm. Unset writes version
+	// 0.1.0 to helm/ under the service root. See HelmSpec.
+	Helm *HelmSpec `yaml:"helm,omitempty"`
+
+	// ProtoBreaking selects the baseline Sync checks proto changes against
+	// and whether breaking ones may be generated. Unset compares with the
+	// stored baseline or the last commit and fails on breaking changes. See
+	// ProtoBreakingSpec.
+	ProtoBreaking *ProtoBreakingSpec `yaml:"proto-breaking,omitempty"`
+
+	// ScaffoldConflicts decides what Sync does with a generated adapter file
+	// edited by hand: "keep" (the default) leaves it and reports a conflict,
+	// "orig" regenerates it and keeps the edited file beside it as .orig.
+	ScaffoldConflicts string `yaml:"scaffold-conflicts,omitempty"`
 }
 
 // ServiceAccountSpec configures the Kubernetes ServiceAccount a service's
@@ -143,9 +202,55 @@ func (s *Settings) Validate() error {
 	if err := s.ServiceAccount.Validate(); err != nil {
 		return err
 	}
+	if err := s.Cors.Validate(); err != nil {
+		return err
+	}
+	if err := s.TLS.Validate(); err != nil {
+		return err
+	}
+	if err := s.Errors.Validate(); err != nil {
+		return err
+	}
+	if err := s.AccessLog.Validate(); err != nil {
+		return err
+	}
+	if err := s.Shutdown.Validate(); err != nil {
+		return err
+	}
+	if err := s.Ports.Validate(); err != nil {
+		return err
+	}
+	if err := s.ContainerPorts().validate(); err != nil {
+		return err
+	}
+	if err := s.Probes.Validate(); err != nil {
+		return err
+	}
+	if err := s.validateProbes(); err != nil {
+		return err
+	}
+	if err := s.Deployment.Validate(); err != nil {
+		return err
+	}
+	if err := s.validateDeploymentFormat(); err != nil {
+		return err
+	}
+	if err := s.ProtoBreaking.Validate(); err != nil {
+		return err
+	}
+	if err := validateScaffoldConflicts(s.ScaffoldConflicts); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (s *Settings) scaffoldConflicts() string {
+	if s.ScaffoldConflicts == "" {
+		return scaffoldConflictKeep
+	}
+	return s.ScaffoldConflicts
+}
+
 func (s *Settings) protocolSourceDir() string {
 	if s.ProtocolSourceDir == "" {
 		return "proto"
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"gopkg.in/yaml.v3"
+)
+
+// pluginManifestPath is the user-owned plugin list, relative to the service
+// root. registry_gen.go is rendered beside it during Sync.
+var pluginManifestPath = filepath.Join("code", "plugins", "plugins.yaml")
+
+// pluginManifest is the shape of plugins.yaml.
+type pluginManifest struct {
+	Plugins []pluginSpec `yaml:"plugins"`
+}
+
+// pluginSpec declares one framework.Plugin. Import is the Go import path of a
+// package inside the service module; Constructor names an exported function of
+// that package returning the plugin (New when omitted). A constructor takes no
+// argument, or a map[string]string when Config is present.
+type pluginSpec struct {
+	Name        string            `yaml:"name"`
+	Import      string            `yaml:"import"`
+	Constructor string            `yaml:"constructor"`
+	Config      map[string]string `yaml:"config,omitempty"`
+}
+
+// registeredPlugin is the template view of a validated pluginSpec. Alias is the
+// import name registry_gen.go uses, unique within the generated file.
+type registeredPlugin struct {
+	Name        string
+	Alias       string
+	Import      string
+	Constructor string
+	Config      map[string]string
+}
+
+// pluginNamePattern keeps plugin names usable as registry keys and log fields.
+var pluginNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// loadPluginRegistry reads plugins.yaml below root and resolves each entry
+// against the Go module at moduleDir. A missing manifest is an empty registry:
+// services created before the plugin seam existed keep rendering `return nil`.
+func loadPluginRegistry(root, moduleDir string) ([]registeredPlugin, error) {
+	content, err := os.ReadFile(filepath.Join(root, pluginManifestPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read plugin manifest: %w", err)
+	}
+	var manifest pluginManifest
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("parse plugin manifest %s: %w", pluginManifestPath, err)
+	}
+	if len(manifest.Plugins) == 0 {
+		return nil, nil
+	}
+	modContent, err := os.ReadFile(filepath.Join(moduleDir, "go.mod"))
+	if err != nil {
+		return nil, fmt.Errorf("plugins require the service go.mod: %w", err)
+	}
+	modulePath := modfile.ModulePath(modContent)
+	if modulePath == "" {
+		return nil, fmt.Errorf("plugins require a module path in %s", filepath.Join(moduleDir, "go.mod"))
+	}
+
+	seen := map[string]struct{}{}
+	registered := make([]registeredPlugin, 0, len(manifest.Plugins))
+	for index, spec := range manifest.Plugins {
+		if !pluginNamePattern.MatchString(spec.Name) {
+			return nil, fmt.Errorf("plugin #%d: name %q must be lowercase letters, digits and dashes", index+1, spec.Name)
+		}
+		if _, ok := seen[spec.Name]; ok {
+			return nil, fmt.Errorf("plugin %q is declared twice", spec.Name)
+		}
+		seen[spec.Name] = struct{}{}
+		constructor := spec.Constructor
+		if constructor == "" {
+			constructor = "New"
+		}
+		if !goast.IsExported(constructor) {
+			return nil, fmt.Errorf("plugin %q: constructor %q must be an exported function", spec.Name, constructor)
+		}
+		packageDir, err := pluginPackageDir(moduleDir, modulePath, spec.Import)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", spec.Name, err)
+		}
+		if err := checkPluginConstructor(packageDir, constructor, len(spec.Config) > 0); err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", spec.Name, err)
+		}
+		registered = append(registered, registeredPlugin{
+			Name:        spec.Name,
+			Alias:       fmt.Sprintf("plugin%d", index),
+			Import:      spec.Import,
+			Constructor: constructor,
+			Config:      spec.Config,
+		})
+	}
+	return registered, nil
+}
+
+// pluginPackageDir maps a plugin import path to its directory inside the
+// module. Plugins are part of the deployable, so packages from other modules
+// are rejected: they would compile only if go.mod happened to require them.
+func pluginPackageDir(moduleDir, modulePath, importPath string) (string, error) {
+	if importPath == "" {
+		return "", fmt.Errorf("import path is required")
+	}
+	relative, ok := strings.CutPrefix(importPath, modulePath+"/")
+	if !ok || !filepath.IsLocal(filepath.FromSlash(relative)) {
+		return "", fmt.Errorf("import %q is not a package of module %q", importPath, modulePath)
+	}
+	dir := filepath.Join(moduleDir, filepath.FromSlash(relative))
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+		return "", fmt.Errorf("package %q does not exist in the module", importPath)
+	}
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// checkPluginConstructor verifies the package declares the constructor as a
+// top-level function with the arity registry_gen.go will call it with, so a
+// typo fails Sync with a named plugin instead of breaking the build later.
+func checkPluginConstructor(dir, constructor string, withConfig bool) error {
+	want := 0
+	if withConfig {
+		want = 1
+	}
+	found := false
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := goparser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, goparser.SkipObjectResolution)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", name, err)
+		}
+		if file.Name.Name == "main" {
+			return fmt.Errorf("package in %s is a main package and cannot be imported", dir)
+		}
+		for _, declaration := range file.Decls {
+			function, ok := declaration.(*goast.FuncDecl)
+			if !ok || function.Recv != nil || function.Name.Name != constructor {
+				continue
+			}
+			found = true
+			if got := function.Type.Params.NumFields(); got != want {
+				return fmt.Errorf("constructor %s takes %d parameter(s), want %d", constructor, got, want)
+			}
+			if function.Type.Results.NumFields() != 1 {
+				return fmt.Errorf("constructor %s must return exactly one value", constructor)
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("package in %s declares no function %s", dir, constructor)
+	}
+	return nil
+}
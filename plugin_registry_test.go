@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func stagePluginService(t *testing.T, manifest string) string {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "code", "go.mod"), "module example.com/svc\n\ngo 1.25\n")
+	writeTestFile(t, filepath.Join(root, "code", "pkg", "audit", "audit.go"), "package audit\n\nfunc New() any { return nil }\n")
+	writeTestFile(t, filepath.Join(root, "code", "pkg", "quota", "quota.go"), "package quota\n\nfunc Build(config map[string]string) any { return nil }\n")
+	if manifest != "" {
+		writeTestFile(t, filepath.Join(root, pluginManifestPath), manifest)
+	}
+	return root
+}
+
+func TestLoadPluginRegistryResolvesManifest(t *testing.T) {
+	root := stagePluginService(t, `plugins:
+  - name: audit
+    import: example.com/svc/pkg/audit
+  - name: quota
+    import: example.com/svc/pkg/quota
+    constructor: Build
+    config:
+      limit: "10"
+`)
+	got, err := loadPluginRegistry(root, filepath.Join(root, "code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []registeredPlugin{
+		{Name: "audit", Alias: "plugin0", Import: "example.com/svc/pkg/audit", Constructor: "New"},
+		{Name: "quota", Alias: "plugin1", Import: "example.com/svc/pkg/quota", Constructor: "Build", Config: map[string]string{"limit": "10"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("registry = %#v, want %#v", got, want)
+	}
+}
+
+func TestLoadPluginRegistryTreatsMissingOrEmptyManifestAsNoPlugins(t *testing.T) {
+	for name, manifest := range map[string]string{"missing": "", "empty": "plugins: []\n"} {
+		t.Run(name, func(t *testing.T) {
+			root := stagePluginService(t, manifest)
+			got, err := loadPluginRegistry(root, filepath.Join(root, "code"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 0 {
+				t.Fatalf("registry = %#v, want none", got)
+			}
+		})
+	}
+}
+
+func TestLoadPluginRegistryRejectsInvalidEntries(t *testing.T) {
+	tests := map[string]struct {
+		manifest string
+		want     string
+	}{
+		"missing name":      {"plugins:\n  - import: example.com/svc/pkg/audit\n", "name"},
+		"duplicate name":    {"plugins:\n  - {name: audit, import: example.com/svc/pkg/audit}\n  - {name: audit, import: example.com/svc/pkg/audit}\n", "declared twice"},
+		"foreign module":    {"plugins:\n  - {name: audit, import: github.com/other/audit}\n", "not a package of module"},
+		"escaping import":   {"plugins:\n  - {name: audit, import: example.com/svc/../audit}\n", "not a package of module"},
+		"missing package":   {"plugins:\n  - {name: audit, import: example.com/svc/pkg/missing}\n", "does not exist"},
+		"missing function":  {"plugins:\n  - {name: audit, import: example.com/svc/pkg/audit, constructor: Make}\n", "declares no function Make"},
+		"unexported":        {"plugins:\n  - {name: audit, import: example.com/svc/pkg/audit, constructor: new}\n", "exported"},
+		"config mismatch":   {"plugins:\n  - {name: audit, import: example.com/svc/pkg/audit, config: {a: b}}\n", "want 1"},
+		"config required":   {"plugins:\n  - {name: quota, import: example.com/svc/pkg/quota, constructor: Build}\n", "want 0"},
+		"malformed":         {"plugins: {name: audit}\n", "parse plugin manifest"},
+		"uppercase name":    {"plugins:\n  - {name: Audit, import: example.com/svc/pkg/audit}\n", "lowercase"},
+		"import path empty": {"plugins:\n  - {name: audit}\n", "import path is required"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := stagePluginService(t, test.manifest)
+			_, err := loadPluginRegistry(root, filepath.Join(root, "code"))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("loadPluginRegistry() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
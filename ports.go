@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	basev0 "github.com/codefly-dev/core/generated/go/codefly/base/v0"
+	"github.com/codefly-dev/core/resources"
+)
+
+// PortsSpec sets the container ports of the gRPC, REST and Connect listeners.
+// The Dockerfile exposes them, the Deployment and Service advertise them and
+// the probes target them; the environment's network mappings must bind the
+// listeners there. Zero keeps the listener's standard port.
+type PortsSpec struct {
+	GRPC    uint16 `yaml:"grpc,omitempty"`
+	REST    uint16 `yaml:"rest,omitempty"`
+	Connect uint16 `yaml:"connect,omitempty"`
+}
+
+// The standard container ports of the listeners.
+const (
+	defaultGRPCPort    uint16 = 9090
+	defaultRESTPort    uint16 = 8080
+	defaultConnectPort uint16 = 8081
+)
+
+// minContainerPort is the first port the container's non-root user may bind
+// with every capability dropped.
+const minContainerPort = 1024
+
+// DeploymentPorts are the container ports of the listeners the service
+// serves; a disabled listener's is zero.
+type DeploymentPorts struct {
+	GRPC    uint16
+	REST    uint16
+	Connect uint16
+}
+
+// ContainerPorts resolves the ports of the enabled listeners.
+func (s *Settings) ContainerPorts() DeploymentPorts {
+	var declared PortsSpec
+	if s.Ports != nil {
+		declared = *s.Ports
+	}
+	ports := DeploymentPorts{GRPC: portOrDefault(declared.GRPC, defaultGRPCPort)}
+	if s.RestEndpoint {
+		ports.REST = portOrDefault(declared.REST, defaultRESTPort)
+	}
+	if s.ConnectEndpoint {
+		ports.Connect = portOrDefault(declared.Connect, defaultConnectPort)
+	}
+	return ports
+}
+
+func portOrDefault(port, fallback uint16) uint16 {
+	if port == 0 {
+		return fallback
+	}
+	return port
+}
+
+// List is the ports in listener order, as the Dockerfile exposes them.
+func (p DeploymentPorts) List() []uint16 {
+	var list []uint16
+	for _, port := range []uint16{p.GRPC, p.REST, p.Connect} {
+		if port != 0 {
+			list = append(list, port)
+		}
+	}
+	return list
+}
+
+// Validate rejects ports a non-root container cannot bind.
+func (p *PortsSpec) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, listener := range []struct {
+		name string
+		port uint16
+	}{{"grpc", p.GRPC}, {"rest", p.REST}, {"connect", p.Connect}} {
+		if listener.port != 0 && listener.port < minContainerPort {
+			return fmt.Errorf("ports %s must be at least %d to bind as a non-root user (got %d)", listener.name, minContainerPort, listener.port)
+		}
+	}
+	return nil
+}
+
+// validate rejects two enabled listeners on one port.
+func (p DeploymentPorts) validate() error {
+	seen := map[uint16]string{}
+	for _, listener := range []struct {
+		name string
+		port uint16
+	}{{"grpc", p.GRPC}, {"rest", p.REST}, {"connect", p.Connect}} {
+		if listener.port == 0 {
+			continue
+		}
+		if other, ok := seen[listener.port]; ok {
+			return fmt.Errorf("ports %s and %s cannot share port %d", other, listener.name, listener.port)
+		}
+		seen[listener.port] = listener.name
+	}
+	return nil
+}
+
+// deploymentPort pairs a listener's endpoint with the port the manifests
+// advertise for it.
+type deploymentPort struct {
+	name     string
+	endpoint *basev0.Endpoint
+	port     uint16
+}
+
+// checkNetworkMappings fails when the environment binds an enabled listener
+// to another port than the one the manifests advertise: the Service would
+// route to a port nothing listens on. Without mappings there is nothing to
+// check.
+func checkNetworkMappings(ctx context.Context, mappings []*basev0.NetworkMapping, listeners []deploymentPort) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	for _, listener := range listeners {
+		if listener.port == 0 || listener.endpoint == nil {
+			continue
+		}
+		instance, err := resources.FindNetworkInstanceInNetworkMappings(ctx, mappings, listener.endpoint, resources.NewContainerNetworkAccess())
+		if err != nil {
+			return fmt.Errorf("no network mapping for the %s endpoint: %w", listener.name, err)
+		}
+		if int(instance.Port) != int(listener.port) {
+			return fmt.Errorf("the environment maps the %s endpoint to port %d but the manifests advertise %d: set ports.%s to match", listener.name, instance.Port, listener.port, listener.name)
+		}
+	}
+	return nil
+}
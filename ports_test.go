@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainerPortsCoverTheEnabledListeners(t *testing.T) {
+	tests := map[string]struct {
+		settings Settings
+		want     DeploymentPorts
+		list     []uint16
+	}{
+		"grpc only": {Settings{}, DeploymentPorts{GRPC: 9090}, []uint16{9090}},
+		"all defaults": {
+			Settings{RestEndpoint: true, ConnectEndpoint: true},
+			DeploymentPorts{GRPC: 9090, REST: 8080, Connect: 8081},
+			[]uint16{9090, 8080, 8081},
+		},
+		"custom": {
+			Settings{RestEndpoint: true, Ports: &PortsSpec{GRPC: 7000, REST: 7001}},
+			DeploymentPorts{GRPC: 7000, REST: 7001},
+			[]uint16{7000, 7001},
+		},
+		"disabled listener ignores its port": {
+			Settings{Ports: &PortsSpec{Connect: 7002}},
+			DeploymentPorts{GRPC: 9090},
+			[]uint16{9090},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := test.settings.ContainerPorts()
+			if got != test.want {
+				t.Fatalf("ContainerPorts() = %+v, want %+v", got, test.want)
+			}
+			if list := got.List(); !reflect.DeepEqual(list, test.list) {
+				t.Fatalf("List() = %v, want %v", list, test.list)
+			}
+		})
+	}
+}
+
+func TestSettingsValidatePorts(t *testing.T) {
+	tests := map[string]struct {
+		settings Settings
+		want     string
+	}{
+		"defaults":            {Settings{RestEndpoint: true, ConnectEndpoint: true}, ""},
+		"custom":              {Settings{RestEndpoint: true, Ports: &PortsSpec{GRPC: 7000, REST: 7001}}, ""},
+		"privileged":          {Settings{Ports: &PortsSpec{GRPC: 80}}, "ports grpc must be at least 1024"},
+		"shared":              {Settings{RestEndpoint: true, Ports: &PortsSpec{REST: 9090}}, "ports grpc and rest cannot share port 9090"},
+		"shared with default": {Settings{ConnectEndpoint: true, Ports: &PortsSpec{GRPC: 8081}}, "cannot share port 8081"},
+		"shared but disabled": {Settings{Ports: &PortsSpec{REST: 9090}}, ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.settings.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
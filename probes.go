@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ProbesSpec configures the Deployment's startup, readiness and liveness
+// probes.
+//
+// Type is how the kubelet probes the pod:
+//   - grpc (the default) calls grpc.health.v1.Health/Check on the gRPC
+//     listener, so a pod whose health server reports NOT_SERVING (draining on
+//     SIGTERM, say) leaves the Service's endpoints;
+//   - http GETs /healthz on the REST listener, which relays the same check,
+//     and needs the REST endpoint;
+//   - tcp only checks that the gRPC listener accepts connections. It is the
+//     default with TLS: the kubelet's gRPC probe cannot speak TLS.
+//
+// Service is the health service the gRPC probes check: empty is the whole
+// server, a fully-qualified proto service such as "shop.v1.Orders" that
+// service's own status. Each probe may override it and its timing.
+type ProbesSpec struct {
+	Type      string     `yaml:"type,omitempty"`
+	Service   string     `yaml:"service,omitempty"`
+	Startup   *ProbeSpec `yaml:"startup,omitempty"`
+	Readiness *ProbeSpec `yaml:"readiness,omitempty"`
+	Liveness  *ProbeSpec `yaml:"liveness,omitempty"`
+}
+
+// ProbeSpec tunes one probe. Zero keeps the probe's default.
+type ProbeSpec struct {
+	Service             string `yaml:"service,omitempty"`
+	InitialDelaySeconds int    `yaml:"initial-delay-seconds,omitempty"`
+	PeriodSeconds       int    `yaml:"period-seconds,omitempty"`
+	TimeoutSeconds      int    `yaml:"timeout-seconds,omitempty"`
+	FailureThreshold    int    `yaml:"failure-threshold,omitempty"`
+}
+
+// Probe types.
+const (
+	probeGRPC = "grpc"
+	probeHTTP = "http"
+	probeTCP  = "tcp"
+)
+
+// probePolicy is the effective probes the deployment renders.
+type probePolicy struct {
+	Type      string
+	Startup   probeTiming
+	Readiness probeTiming
+	Liveness  probeTiming
+}
+
+// probeTiming is one probe with its defaults applied. Service only applies
+// to gRPC probes.
+type probeTiming struct {
+	Service             string
+	InitialDelaySeconds int
+	PeriodSeconds       int
+	TimeoutSeconds      int
+	FailureThreshold    int
+}
+
+// defaultProbePolicy gives a slow start a minute, takes a pod out of the
+// Service within 15s of turning unhealthy and restarts it after 90s.
+func defaultProbePolicy() probePolicy {
+	return probePolicy{
+		Type:      probeGRPC,
+		Startup:   probeTiming{PeriodSeconds: 2, TimeoutSeconds: 1, FailureThreshold: 30},
+		Readiness: probeTiming{PeriodSeconds: 5, TimeoutSeconds: 3, FailureThreshold: 3},
+		Liveness:  probeTiming{PeriodSeconds: 30, TimeoutSeconds: 5, FailureThreshold: 3},
+	}
+}
+
+// ProbePolicy is the declared probes with the defaults applied.
+func (s *Settings) ProbePolicy() probePolicy {
+	policy := defaultProbePolicy()
+	if s.TLS != nil {
+		policy.Type = probeTCP
+	}
+	if s.Probes == nil {
+		return policy
+	}
+	if s.Probes.Type != "" {
+		policy.Type = s.Probes.Type
+	}
+	policy.Startup = policy.Startup.with(s.Probes.Service, s.Probes.Startup)
+	policy.Readiness = policy.Readiness.with(s.Probes.Service, s.Probes.Readiness)
+	policy.Liveness = policy.Liveness.with(s.Probes.Service, s.Probes.Liveness)
+	return policy
+}
+
+func (t probeTiming) with(service string, spec *ProbeSpec) probeTiming {
+	t.Service = service
+	if spec == nil {
+		return t
+	}
+	if spec.Service != "" {
+		t.Service = spec.Service
+	}
+	if spec.InitialDelaySeconds != 0 {
+		t.InitialDelaySeconds = spec.InitialDelaySeconds
+	}
+	if spec.PeriodSeconds != 0 {
+		t.PeriodSeconds = spec.PeriodSeconds
+	}
+	if spec.TimeoutSeconds != 0 {
+		t.TimeoutSeconds = spec.TimeoutSeconds
+	}
+	if spec.FailureThreshold != 0 {
+		t.FailureThreshold = spec.FailureThreshold
+	}
+	return t
+}
+
+// healthServiceName is a fully-qualified proto service name, as the
+// generated health server registers it.
+var healthServiceName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// Validate rejects an unknown type, malformed service names and timings the
+// kubelet refuses.
+func (p *ProbesSpec) Validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Type {
+	case "", probeGRPC, probeHTTP, probeTCP:
+	default:
+		return fmt.Errorf("probes type %q must be grpc, http or tcp", p.Type)
+	}
+	if p.Service != "" && !healthServiceName.MatchString(p.Service) {
+		return fmt.Errorf("probes service %q is not a fully-qualified proto service name", p.Service)
+	}
+	for _, probe := range []struct {
+		name string
+		spec *ProbeSpec
+	}{{"startup", p.Startup}, {"readiness", p.Readiness}, {"liveness", p.Liveness}} {
+		if err := probe.spec.validate(probe.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ProbeSpec) validate(name string) error {
+	if p == nil {
+		return nil
+	}
+	if p.Service != "" && !healthServiceName.MatchString(p.Service) {
+		return fmt.Errorf("probes %s service %q is not a fully-qualified proto service name", name, p.Service)
+	}
+	for _, field := range []struct {
+		key   string
+		value int
+	}{
+		{"initial-delay-seconds", p.InitialDelaySeconds},
+		{"period-seconds", p.PeriodSeconds},
+		{"timeout-seconds", p.TimeoutSeconds},
+		{"failure-threshold", p.FailureThreshold},
+	} {
+		if field.value < 0 {
+			return fmt.Errorf("probes %s %s must not be negative (got %d)", name, field.key, field.value)
+		}
+	}
+	return nil
+}
+
+// validateProbes rejects probes the service cannot answer: /healthz without
+// the REST listener, a gRPC probe the kubelet would send in plaintext to a
+// TLS listener, an HTTPS probe to a listener requiring client certificates,
+// and a health service name on probes that do not check one.
+func (s *Settings) validateProbes() error {
+	policy := s.ProbePolicy()
+	switch policy.Type {
+	case probeHTTP:
+		if !s.RestEndpoint {
+			return fmt.Errorf("probes type http needs the REST endpoint, which serves /healthz")
+		}
+		if s.TLS != nil && s.TLS.clientAuth() == tlsClientAuthRequire {
+			return fmt.Errorf("probes type http cannot pass tls client-auth require: the kubelet has no client certificate; use tcp")
+		}
+	case probeGRPC:
+		if s.TLS != nil {
+			return fmt.Errorf("probes type grpc cannot reach a TLS listener: the kubelet's gRPC probe is plaintext; use http or tcp")
+		}
+	}
+	if policy.Type != probeGRPC {
+		for _, timing := range []probeTiming{policy.Startup, policy.Readiness, policy.Liveness} {
+			if timing.Service != "" {
+				return fmt.Errorf("probes service %q only applies to grpc probes", timing.Service)
+			}
+		}
+	}
+	return nil
+}
+
+// deploymentProbe is one probe as the deployment template renders it.
+type deploymentProbe struct {
+	probeTiming
+	Type string
+	// Port is the gRPC container port: the kubelet's gRPC probe takes a
+	// number, not a named port.
+	Port uint16
+	// HTTPS probes /healthz over TLS, without verifying the certificate.
+	HTTPS bool
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProbePolicyChecksHealthByDefault(t *testing.T) {
+	var settings Settings
+	if got := settings.ProbePolicy(); got != defaultProbePolicy() || got.Type != probeGRPC {
+		t.Fatalf("ProbePolicy() = %+v, want the default grpc probes", got)
+	}
+
+	settings.TLS = &TLSSpec{Secret: "api-tls"}
+	if got := settings.ProbePolicy().Type; got != probeTCP {
+		t.Fatalf("ProbePolicy().Type = %q with TLS, want tcp", got)
+	}
+
+	settings = Settings{Probes: &ProbesSpec{
+		Service:   "shop.v1.Orders",
+		Readiness: &ProbeSpec{PeriodSeconds: 10, FailureThreshold: 6},
+		Liveness:  &ProbeSpec{Service: "shop.v1.Payments", InitialDelaySeconds: 15},
+	}}
+	policy := settings.ProbePolicy()
+	if want := (probeTiming{Service: "shop.v1.Orders", PeriodSeconds: 2, TimeoutSeconds: 1, FailureThreshold: 30}); policy.Startup != want {
+		t.Fatalf("Startup = %+v, want %+v", policy.Startup, want)
+	}
+	if want := (probeTiming{Service: "shop.v1.Orders", PeriodSeconds: 10, TimeoutSeconds: 3, FailureThreshold: 6}); policy.Readiness != want {
+		t.Fatalf("Readiness = %+v, want %+v", policy.Readiness, want)
+	}
+	if want := (probeTiming{Service: "shop.v1.Payments", InitialDelaySeconds: 15, PeriodSeconds: 30, TimeoutSeconds: 5, FailureThreshold: 3}); policy.Liveness != want {
+		t.Fatalf("Liveness = %+v, want %+v", policy.Liveness, want)
+	}
+}
+
+func TestSettingsValidateProbes(t *testing.T) {
+	tls := &TLSSpec{Secret: "api-tls"}
+	mtls := &TLSSpec{Secret: "api-tls", ClientAuth: tlsClientAuthRequire, Cert: "tls.crt", Key: "tls.key", CA: "ca.crt"}
+	tests := map[string]struct {
+		settings Settings
+		want     string
+	}{
+		"defaults":           {Settings{}, ""},
+		"tls defaults":       {Settings{TLS: tls}, ""},
+		"grpc service":       {Settings{Probes: &ProbesSpec{Service: "shop.v1.Orders"}}, ""},
+		"http":               {Settings{RestEndpoint: true, Probes: &ProbesSpec{Type: probeHTTP}}, ""},
+		"https":              {Settings{RestEndpoint: true, TLS: tls, Probes: &ProbesSpec{Type: probeHTTP}}, ""},
+		"unknown type":       {Settings{Probes: &ProbesSpec{Type: "exec"}}, "must be grpc, http or tcp"},
+		"http without rest":  {Settings{Probes: &ProbesSpec{Type: probeHTTP}}, "needs the REST endpoint"},
+		"http with mtls":     {Settings{RestEndpoint: true, TLS: mtls, Probes: &ProbesSpec{Type: probeHTTP}}, "no client certificate"},
+		"grpc with tls":      {Settings{TLS: tls, Probes: &ProbesSpec{Type: probeGRPC}}, "plaintext"},
+		"malformed service":  {Settings{Probes: &ProbesSpec{Service: "shop/Orders"}}, "not a fully-qualified proto service name"},
+		"service on tcp":     {Settings{Probes: &ProbesSpec{Type: probeTCP, Liveness: &ProbeSpec{Service: "shop.v1.Orders"}}}, "only applies to grpc probes"},
+		"negative threshold": {Settings{Probes: &ProbesSpec{Readiness: &ProbeSpec{FailureThreshold: -1}}}, "readiness failure-threshold must not be negative"},
+		"negative startup":   {Settings{Probes: &ProbesSpec{Startup: &ProbeSpec{PeriodSeconds: -2}}}, "startup period-seconds"},
+		"malformed liveness": {Settings{Probes: &ProbesSpec{Liveness: &ProbeSpec{Service: "1shop"}}}, "liveness service"},
+		"tcp":                {Settings{Probes: &ProbesSpec{Type: probeTCP}}, ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.settings.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,670 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ProtoBreakingSpec configures the check Sync runs before generating code:
+// the proto tree is compared with a baseline and any change that breaks
+// existing clients fails the sync.
+type ProtoBreakingSpec struct {
+	// Against is the baseline: "git" for the last commit, "git:<revision>",
+	// "baseline" for the descriptor set stored by `proto-breaking
+	// --update-baseline`, or a FileDescriptorSet file below the service root
+	// (`buf build --exclude-imports -o <file>`). Left empty, the stored
+	// baseline is used when there is one and the last commit otherwise.
+	Against string `yaml:"against,omitempty"`
+	// AllowBreaking lets Sync generate code anyway; the report is logged.
+	AllowBreaking bool `yaml:"allow-breaking,omitempty"`
+}
+
+// protoBaselineFile is where `proto-breaking --update-baseline` stores the
+// descriptors of the proto tree, relative to the service root.
+const protoBaselineFile = ".codefly/proto-baseline.binpb"
+
+const (
+	protoAgainstGit      = "git"
+	protoAgainstBaseline = "baseline"
+)
+
+// gitRevision is the subset of git revision syntax accepted after "git:".
+var gitRevision = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_./~^@{}-]*$`)
+
+func (s *ProtoBreakingSpec) Validate() error {
+	if s == nil {
+		return nil
+	}
+	return validateProtoAgainst(s.Against)
+}
+
+func validateProtoAgainst(against string) error {
+	switch {
+	case against == "", against == protoAgainstGit, against == protoAgainstBaseline:
+		return nil
+	case strings.HasPrefix(against, protoAgainstGit+":"):
+		if !gitRevision.MatchString(strings.TrimPrefix(against, protoAgainstGit+":")) {
+			return fmt.Errorf("proto-breaking against %q does not name a git revision", against)
+		}
+		return nil
+	case !filepath.IsLocal(against) || strings.ContainsAny(against, "\x00\\"):
+		return fmt.Errorf("proto-breaking against %q must be git, git:<revision>, baseline or a file below the service root", against)
+	}
+	return nil
+}
+
+func (s *ProtoBreakingSpec) against() string {
+	if s == nil {
+		return ""
+	}
+	return s.Against
+}
+
+func (s *ProtoBreakingSpec) allowBreaking() bool {
+	return s != nil && s.AllowBreaking
+}
+
+// protoBreakingChange is one change of the proto tree that breaks clients
+// built against the baseline. File is the baseline file declaring the
+// element.
+type protoBreakingChange struct {
+	File   string
+	Change string
+}
+
+type protoBreakingReport struct {
+	Against string
+	Changes []protoBreakingChange
+}
+
+func (r *protoBreakingReport) breaking() bool {
+	return r != nil && len(r.Changes) > 0
+}
+
+func (r *protoBreakingReport) String() string {
+	switch {
+	case r == nil:
+		return "No proto baseline to compare against\n"
+	case len(r.Changes) == 0:
+		return fmt.Sprintf("No breaking proto change against %s\n", r.Against)
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d breaking proto change(s) against %s:\n", len(r.Changes), r.Against)
+	for _, change := range r.Changes {
+		fmt.Fprintf(&out, "  %s: %s\n", change.File, change.Change)
+	}
+	return out.String()
+}
+
+type protoBreakingOptions struct {
+	against        string
+	updateBaseline bool
+}
+
+func parseProtoBreakingArgs(args []string) (protoBreakingOptions, error) {
+	var options protoBreakingOptions
+	for _, arg := range args {
+		switch {
+		case arg == "--update-baseline":
+			options.updateBaseline = true
+		case strings.HasPrefix(arg, "--against="):
+			options.against = strings.TrimPrefix(arg, "--against=")
+			if options.against == "" {
+				return options, fmt.Errorf("--against takes git, git:<revision>, baseline or a descriptor set file")
+			}
+			if err := validateProtoAgainst(options.against); err != nil {
+				return options, err
+			}
+		default:
+			return options, fmt.Errorf("unknown proto-breaking argument %q (use --against=<baseline> or --update-baseline)", arg)
+		}
+	}
+	if options.updateBaseline && options.against != "" {
+		return options, fmt.Errorf("--update-baseline stores the current tree and takes no --against")
+	}
+	return options, nil
+}
+
+// checkProtoBreaking compares the proto tree at protoDir, relative to root,
+// with the baseline against selects. It returns nil when the default baseline
+// does not exist: nothing is stored and root is not in a git checkout.
+func checkProtoBreaking(ctx context.Context, root, protoDir, against string) (*protoBreakingReport, error) {
+	baseline, name, err := loadProtoBaseline(ctx, root, protoDir, against)
+	if err != nil || baseline == nil {
+		return nil, err
+	}
+	current, err := compileProtoTree(filepath.Join(root, protoDir))
+	if err != nil {
+		return nil, err
+	}
+	changes, err := compareProtoFiles(baseline, current)
+	if err != nil {
+		return nil, err
+	}
+	return &protoBreakingReport{Against: name, Changes: changes}, nil
+}
+
+// writeProtoBaseline stores the descriptors of the proto tree as the baseline
+// later checks compare against.
+func writeProtoBaseline(root, protoDir string) (int, error) {
+	files, err := compileProtoTree(filepath.Join(root, protoDir))
+	if err != nil {
+		return 0, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		set.File = append(set.File, files[name])
+	}
+	content, err := proto.MarshalOptions{Deterministic: true}.Marshal(set)
+	if err != nil {
+		return 0, err
+	}
+	target := filepath.Join(root, protoBaselineFile)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return 0, err
+	}
+	return len(set.File), os.WriteFile(target, content, 0o644)
+}
+
+// errNoGitRevision reports that the revision to compare against cannot be
+// read, because git is missing, root is not a checkout or the revision does
+// not exist (a repository without commits).
+var errNoGitRevision = errors.New("no git revision")
+
+// loadProtoBaseline returns the baseline descriptors and a name for them.
+func loadProtoBaseline(ctx context.Context, root, protoDir, against string) (map[string]*descriptorpb.FileDescriptorProto, string, error) {
+	stored := filepath.Join(root, protoBaselineFile)
+	switch {
+	case against == "":
+		if _, err := os.Stat(stored); err == nil {
+			return readProtoDescriptorSet(stored, protoBaselineFile)
+		}
+		files, name, err := gitProtoBaseline(ctx, root, protoDir, "HEAD")
+		if errors.Is(err, errNoGitRevision) {
+			return nil, "", nil
+		}
+		return files, name, err
+	case against == protoAgainstBaseline:
+		if _, err := os.Stat(stored); os.IsNotExist(err) {
+			return nil, "", fmt.Errorf("no proto baseline at %s: run proto-breaking --update-baseline", protoBaselineFile)
+		}
+		return readProtoDescriptorSet(stored, protoBaselineFile)
+	case against == protoAgainstGit:
+		return gitProtoBaseline(ctx, root, protoDir, "HEAD")
+	case strings.HasPrefix(against, protoAgainstGit+":"):
+		return gitProtoBaseline(ctx, root, protoDir, strings.TrimPrefix(against, protoAgainstGit+":"))
+	default:
+		return readProtoDescriptorSet(filepath.Join(root, against), against)
+	}
+}
+
+// protoBaselineIdentity names the baseline against selects without compiling
+// it: the stored descriptor set's content or the commit a revision resolves
+// to. The sync fingerprint carries it, so moving the baseline runs the check
+// again even when the proto tree did not change. It is nil when there is no
+// baseline to read, and checkProtoBreaking reports whether that is an error.
+func protoBaselineIdentity(ctx context.Context, root, against string) []byte {
+	stored := filepath.Join(root, protoBaselineFile)
+	revision := "HEAD"
+	switch {
+	case against == "":
+		if content, err := os.ReadFile(stored); err == nil {
+			return content
+		}
+	case against == protoAgainstBaseline:
+		content, _ := os.ReadFile(stored)
+		return content
+	case against == protoAgainstGit:
+	case strings.HasPrefix(against, protoAgainstGit+":"):
+		revision = strings.TrimPrefix(against, protoAgainstGit+":")
+	default:
+		content, _ := os.ReadFile(filepath.Join(root, against))
+		return content
+	}
+	commit, err := runGit(ctx, root, "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return nil
+	}
+	return append([]byte("git "), bytes.TrimSpace(commit)...)
+}
+
+func readProtoDescriptorSet(path, name string) (map[string]*descriptorpb.FileDescriptorProto, string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot read proto baseline: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		return nil, "", fmt.Errorf("%s is not a FileDescriptorSet: %w", name, err)
+	}
+	files := make(map[string]*descriptorpb.FileDescriptorProto, len(set.GetFile()))
+	for _, file := range set.GetFile() {
+		files[file.GetName()] = file
+	}
+	return files, name, nil
+}
+
+// gitProtoBaseline compiles the proto tree as committed at revision.
+func gitProtoBaseline(ctx context.Context, root, protoDir, revision string) (map[string]*descriptorpb.FileDescriptorProto, string, error) {
+	commit, err := runGit(ctx, root, "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: cannot resolve %s in %s: %v", errNoGitRevision, revision, root, err)
+	}
+	name := fmt.Sprintf("git %s (%.12s)", revision, strings.TrimSpace(string(commit)))
+	// Paths are listed and read relative to root, the service directory,
+	// wherever it sits in the repository.
+	listing, err := runGit(ctx, root, "ls-tree", "-r", "-z", "--name-only", revision, "--", protoDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot list %s at %s: %w", protoDir, revision, err)
+	}
+	sources := map[string][]byte{}
+	for _, path := range strings.Split(string(listing), "\x00") {
+		if filepath.Ext(path) != ".proto" {
+			continue
+		}
+		relative, err := filepath.Rel(protoDir, filepath.FromSlash(path))
+		if err != nil {
+			return nil, "", err
+		}
+		content, err := runGit(ctx, root, "show", revision+":./"+path)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read %s at %s: %w", path, revision, err)
+		}
+		sources[filepath.ToSlash(relative)] = content
+	}
+	files, err := compileProtoSources(sources)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot compile %s at %s: %w", protoDir, revision, err)
+	}
+	return files, name, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	command := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	out, err := command.Output()
+	if err != nil && stderr.Len() > 0 {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, err
+}
+
+// compareProtoFiles lists what the current files break of the baseline: removed
+// messages, fields, enum values, services and RPCs, changed field numbers,
+// names and types, changed RPC signatures, and HTTP bindings that are gone.
+// Elements are matched by full name, so moving them between files is free.
+func compareProtoFiles(baseline, current map[string]*descriptorpb.FileDescriptorProto) ([]protoBreakingChange, error) {
+	before, err := linkProtoFiles(baseline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot link the proto baseline: %w", err)
+	}
+	after, err := linkProtoFiles(current)
+	if err != nil {
+		return nil, fmt.Errorf("cannot link the proto tree: %w", err)
+	}
+	external := externalProtoFiles(baseline, current)
+	comparison := &protoComparison{current: after}
+	for _, name := range slices.Sorted(maps.Keys(baseline)) {
+		if external[name] {
+			continue
+		}
+		file, err := before.FindFileByPath(name)
+		if err != nil {
+			return nil, err
+		}
+		comparison.file = name
+		comparison.messages(file.Messages())
+		comparison.enums(file.Enums())
+		services := file.Services()
+		for i := range services.Len() {
+			comparison.service(services.Get(i))
+		}
+	}
+	return comparison.changes, comparison.err
+}
+
+// externalProtoFiles are the baseline files the current tree still imports
+// without declaring, directly or not: dependencies such as googleapis that a
+// descriptor set built with its imports carries along.
+func externalProtoFiles(baseline, current map[string]*descriptorpb.FileDescriptorProto) map[string]bool {
+	external := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if current[name] != nil || external[name] {
+			return
+		}
+		external[name] = true
+		for _, dependency := range baseline[name].GetDependency() {
+			visit(dependency)
+		}
+	}
+	for _, file := range current {
+		for _, dependency := range file.GetDependency() {
+			visit(dependency)
+		}
+	}
+	return external
+}
+
+type protoComparison struct {
+	current *protoregistry.Files
+	file    string
+	changes []protoBreakingChange
+	err     error
+}
+
+func (c *protoComparison) report(format string, args ...any) {
+	c.changes = append(c.changes, protoBreakingChange{File: c.file, Change: fmt.Sprintf(format, args...)})
+}
+
+func (c *protoComparison) messages(messages protoreflect.MessageDescriptors) {
+	for i := range messages.Len() {
+		c.message(messages.Get(i))
+	}
+}
+
+func (c *protoComparison) enums(enums protoreflect.EnumDescriptors) {
+	for i := range enums.Len() {
+		c.enum(enums.Get(i))
+	}
+}
+
+func (c *protoComparison) message(old protoreflect.MessageDescriptor) {
+	if old.IsMapEntry() {
+		// Compared through the map field's type.
+		return
+	}
+	found, _ := c.current.FindDescriptorByName(old.FullName())
+	current, ok := found.(protoreflect.MessageDescriptor)
+	if !ok {
+		c.report("message %s was removed", old.FullName())
+		return
+	}
+	fields := old.Fields()
+	for i := range fields.Len() {
+		field := fields.Get(i)
+		now := current.Fields().ByNumber(field.Number())
+		if now == nil {
+			if moved := current.Fields().ByName(field.Name()); moved != nil {
+				c.report("field %s changed number from %d to %d", field.FullName(), field.Number(), moved.Number())
+			} else if !current.ReservedRanges().Has(field.Number()) {
+				c.report("field %s (%d) was removed", field.FullName(), field.Number())
+			}
+			continue
+		}
+		if now.Name() != field.Name() {
+			// Same bytes on the wire, but JSON clients of the REST gateway
+			// and Connect use the name.
+			c.report("field %s (%d) was renamed to %s", field.FullName(), field.Number(), now.Name())
+		}
+		if before, after := protoFieldType(field), protoFieldType(now); before != after {
+			c.report("field %s (%d) changed type from %s to %s", field.FullName(), field.Number(), before, after)
+		}
+	}
+	c.messages(old.Messages())
+	c.enums(old.Enums())
+}
+
+// protoFieldType names a field's type as declared. Message and enum types are
+// named without their kind: an import that did not resolve on one side cannot
+// tell them apart.
+func protoFieldType(field protoreflect.FieldDescriptor) string {
+	if field.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", protoFieldType(field.MapKey()), protoFieldType(field.MapValue()))
+	}
+	var name string
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		name = string(field.Message().FullName())
+	case protoreflect.EnumKind:
+		name = string(field.Enum().FullName())
+	default:
+		name = field.Kind().String()
+	}
+	if field.IsList() {
+		return "repeated " + name
+	}
+	return name
+}
+
+func (c *protoComparison) enum(old protoreflect.EnumDescriptor) {
+	found, _ := c.current.FindDescriptorByName(old.FullName())
+	current, ok := found.(protoreflect.EnumDescriptor)
+	if !ok {
+		c.report("enum %s was removed", old.FullName())
+		return
+	}
+	values := old.Values()
+	for i := range values.Len() {
+		value := values.Get(i)
+		now := current.Values().ByNumber(value.Number())
+		switch {
+		case now == nil && !current.ReservedRanges().Has(value.Number()):
+			c.report("enum value %s.%s (%d) was removed", old.FullName(), value.Name(), value.Number())
+		case now != nil && now.Name() != value.Name() && current.Values().ByName(value.Name()) == nil:
+			// Aliases keep the old name valid.
+			c.report("enum value %s.%s (%d) was renamed to %s", old.FullName(), value.Name(), value.Number(), now.Name())
+		}
+	}
+}
+
+func (c *protoComparison) service(old protoreflect.ServiceDescriptor) {
+	found, _ := c.current.FindDescriptorByName(old.FullName())
+	current, ok := found.(protoreflect.ServiceDescriptor)
+	if !ok {
+		c.report("service %s was removed", old.FullName())
+		return
+	}
+	methods := old.Methods()
+	for i := range methods.Len() {
+		method := methods.Get(i)
+		now := current.Methods().ByName(method.Name())
+		if now == nil {
+			if renamed := renamedProtoMethod(method, old, current); renamed != nil {
+				c.report("rpc %s was renamed to %s", method.FullName(), renamed.Name())
+			} else {
+				c.report("rpc %s was removed", method.FullName())
+			}
+			continue
+		}
+		if before, after := protoMethodSignature(method), protoMethodSignature(now); before != after {
+			c.report("rpc %s changed from %s to %s", method.FullName(), before, after)
+		}
+		before, err := protoHTTPBindings(method)
+		if err != nil {
+			c.err = errors.Join(c.err, err)
+			continue
+		}
+		after, err := protoHTTPBindings(now)
+		if err != nil {
+			c.err = errors.Join(c.err, err)
+			continue
+		}
+		for _, binding := range before {
+			if !slices.Contains(after, binding) {
+				c.report("rpc %s changed its HTTP bindings from %s to %s", method.FullName(), formatHTTPBindings(before), formatHTTPBindings(after))
+				break
+			}
+		}
+	}
+}
+
+// renamedProtoMethod finds the new RPC with the signature of a removed one.
+func renamedProtoMethod(method protoreflect.MethodDescriptor, old, current protoreflect.ServiceDescriptor) protoreflect.MethodDescriptor {
+	methods := current.Methods()
+	for i := range methods.Len() {
+		candidate := methods.Get(i)
+		if old.Methods().ByName(candidate.Name()) == nil && protoMethodSignature(candidate) == protoMethodSignature(method) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func protoMethodSignature(method protoreflect.MethodDescriptor) string {
+	input, output := string(method.Input().FullName()), string(method.Output().FullName())
+	if method.IsStreamingClient() {
+		input = "stream " + input
+	}
+	if method.IsStreamingServer() {
+		output = "stream " + output
+	}
+	return fmt.Sprintf("(%s) returns (%s)", input, output)
+}
+
+// httpRuleProto declares the part of google/api/http.proto the check reads.
+// The googleapis Go types are not linked into the agent.
+const httpRuleProto = `syntax = "proto3";
+package google.api;
+
+message HttpRule {
+    string selector = 1;
+    oneof pattern {
+        string get = 2;
+        string put = 3;
+        string post = 4;
+        string delete = 5;
+        string patch = 6;
+        CustomHttpPattern custom = 8;
+    }
+    string body = 7;
+    string response_body = 12;
+    repeated HttpRule additional_bindings = 11;
+}
+
+message CustomHttpPattern {
+    string kind = 1;
+    string path = 2;
+}
+`
+
+// httpRuleExtension is the field number of the google.api.http method option.
+const httpRuleExtension protowire.Number = 72295728
+
+var httpRuleDescriptor = sync.OnceValues(func() (protoreflect.MessageDescriptor, error) {
+	files, err := compileProtoSources(map[string][]byte{"google/api/http.proto": []byte(httpRuleProto)})
+	if err != nil {
+		return nil, err
+	}
+	file, err := protodesc.NewFile(files["google/api/http.proto"], new(protoregistry.Files))
+	if err != nil {
+		return nil, err
+	}
+	return file.Messages().ByName("HttpRule"), nil
+})
+
+// protoHTTPBindings lists a method's google.api.http bindings such as
+// "GET /v1/things/{id}" or "POST /v1/things body=*". The option is read
+// uninterpreted when the descriptors were compiled here, and from its wire
+// encoding when they come from a descriptor set.
+func protoHTTPBindings(method protoreflect.MethodDescriptor) ([]string, error) {
+	descriptor, err := httpRuleDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	options, _ := method.Options().(*descriptorpb.MethodOptions)
+	rule := dynamicpb.NewMessage(descriptor)
+	for _, option := range options.GetUninterpretedOption() {
+		name := option.GetName()
+		if len(name) == 0 || !name[0].GetIsExtension() || strings.TrimPrefix(name[0].GetNamePart(), ".") != "google.api.http" {
+			continue
+		}
+		switch len(name) {
+		case 1:
+			aggregate := dynamicpb.NewMessage(descriptor)
+			if err := (prototext.UnmarshalOptions{DiscardUnknown: true}).Unmarshal([]byte(option.GetAggregateValue()), aggregate); err != nil {
+				return nil, fmt.Errorf("rpc %s: invalid google.api.http option: %w", method.FullName(), err)
+			}
+			proto.Merge(rule, aggregate)
+		case 2:
+			if field := descriptor.Fields().ByName(protoreflect.Name(name[1].GetNamePart())); field != nil && field.Kind() == protoreflect.StringKind {
+				rule.Set(field, protoreflect.ValueOfString(string(option.GetStringValue())))
+			}
+		}
+	}
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	for len(encoded) > 0 {
+		number, kind, n := protowire.ConsumeTag(encoded)
+		if n < 0 {
+			return nil, fmt.Errorf("rpc %s: invalid options: %w", method.FullName(), protowire.ParseError(n))
+		}
+		encoded = encoded[n:]
+		if number == httpRuleExtension && kind == protowire.BytesType {
+			value, m := protowire.ConsumeBytes(encoded)
+			if m < 0 {
+				return nil, fmt.Errorf("rpc %s: invalid google.api.http option: %w", method.FullName(), protowire.ParseError(m))
+			}
+			if err := (proto.UnmarshalOptions{Merge: true, DiscardUnknown: true}).Unmarshal(value, rule); err != nil {
+				return nil, fmt.Errorf("rpc %s: invalid google.api.http option: %w", method.FullName(), err)
+			}
+			encoded = encoded[m:]
+			continue
+		}
+		m := protowire.ConsumeFieldValue(number, kind, encoded)
+		if m < 0 {
+			return nil, fmt.Errorf("rpc %s: invalid options: %w", method.FullName(), protowire.ParseError(m))
+		}
+		encoded = encoded[m:]
+	}
+	return httpRuleBindings(rule), nil
+}
+
+func httpRuleBindings(rule protoreflect.Message) []string {
+	descriptor := rule.Descriptor()
+	pattern := rule.WhichOneof(descriptor.Oneofs().ByName("pattern"))
+	if pattern == nil {
+		return nil
+	}
+	var binding string
+	if pattern.Name() == "custom" {
+		custom := rule.Get(pattern).Message()
+		fields := custom.Descriptor().Fields()
+		binding = strings.ToUpper(custom.Get(fields.ByName("kind")).String()) + " " + custom.Get(fields.ByName("path")).String()
+	} else {
+		binding = strings.ToUpper(string(pattern.Name())) + " " + rule.Get(pattern).String()
+	}
+	if body := rule.Get(descriptor.Fields().ByName("body")).String(); body != "" {
+		binding += " body=" + body
+	}
+	if body := rule.Get(descriptor.Fields().ByName("response_body")).String(); body != "" {
+		binding += " response_body=" + body
+	}
+	bindings := []string{binding}
+	additional := rule.Get(descriptor.Fields().ByName("additional_bindings")).List()
+	for i := range additional.Len() {
+		bindings = append(bindings, httpRuleBindings(additional.Get(i).Message())...)
+	}
+	sort.Strings(bindings)
+	return bindings
+}
+
+func formatHTTPBindings(bindings []string) string {
+	if len(bindings) == 0 {
+		return "none"
+	}
+	return strings.Join(bindings, ", ")
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const breakingBaselineProto = `syntax = "proto3";
+package api.v1;
+
+import "google/api/annotations.proto";
+
+message Item {
+    string id = 1;
+    string name = 2;
+    int32 count = 3;
+    repeated string tags = 4;
+    string owner = 5;
+    Status status = 6;
+}
+
+enum Status {
+    STATUS_UNSPECIFIED = 0;
+    STATUS_ACTIVE = 1;
+    STATUS_ARCHIVED = 2;
+}
+
+message Gone {}
+
+message GetRequest { string id = 1; }
+
+service ItemService {
+    rpc Get(GetRequest) returns (Item) {
+        option (google.api.http) = { get: "/v1/items/{id}" };
+    }
+    rpc List(GetRequest) returns (stream Item);
+    rpc Delete(GetRequest) returns (Item);
+    rpc Purge(GetRequest) returns (GetRequest);
+}
+`
+
+func compileTestProto(t *testing.T, sources map[string]string) map[string]*descriptorpb.FileDescriptorProto {
+	t.Helper()
+	raw := map[string][]byte{}
+	for name, source := range sources {
+		raw[name] = []byte(source)
+	}
+	files, err := compileProtoSources(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCompareProtoFilesReportsBreakingChanges(t *testing.T) {
+	baseline := compileTestProto(t, map[string]string{"api/v1/items.proto": breakingBaselineProto})
+	current := compileTestProto(t, map[string]string{"api/v1/items.proto": `syntax = "proto3";
+package api.v1;
+
+import "google/api/annotations.proto";
+
+message Item {
+    string id = 1;
+    string title = 2;
+    int64 count = 3;
+    string tags = 4;
+    string owner = 7;
+    Status status = 6;
+}
+
+enum Status {
+    STATUS_UNSPECIFIED = 0;
+    STATUS_ACTIVE = 1;
+}
+
+message GetRequest { string id = 1; }
+
+service ItemService {
+    rpc Get(GetRequest) returns (Item) {
+        option (google.api.http) = { post: "/v1/items/{id}" body: "*" };
+    }
+    rpc List(GetRequest) returns (Item);
+    rpc Remove(GetRequest) returns (Item);
+}
+`})
+	changes, err := compareProtoFiles(baseline, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, change := range changes {
+		if change.File != "api/v1/items.proto" {
+			t.Errorf("change %q located in %s", change.Change, change.File)
+		}
+		got = append(got, change.Change)
+	}
+	want := []string{
+		"field api.v1.Item.name (2) was renamed to title",
+		"field api.v1.Item.count (3) changed type from int32 to int64",
+		"field api.v1.Item.tags (4) changed type from repeated string to string",
+		"field api.v1.Item.owner changed number from 5 to 7",
+		"message api.v1.Gone was removed",
+		"enum value api.v1.Status.STATUS_ARCHIVED (2) was removed",
+		"rpc api.v1.ItemService.Get changed its HTTP bindings from GET /v1/items/{id} to POST /v1/items/{id} body=*",
+		"rpc api.v1.ItemService.List changed from (api.v1.GetRequest) returns (stream api.v1.Item) to (api.v1.GetRequest) returns (api.v1.Item)",
+		"rpc api.v1.ItemService.Delete was renamed to Remove",
+		"rpc api.v1.ItemService.Purge was removed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("compareProtoFiles() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCompareProtoFilesAcceptsCompatibleChanges(t *testing.T) {
+	baseline := compileTestProto(t, map[string]string{"api/v1/items.proto": breakingBaselineProto})
+	// Gone moves to its own file, a removed field and enum value are
+	// reserved, an RPC and an HTTP binding are added.
+	current := compileTestProto(t, map[string]string{
+		"api/v1/items.proto": `syntax = "proto3";
+package api.v1;
+
+import "google/api/annotations.proto";
+import "api/v1/gone.proto";
+
+message Item {
+    reserved 5;
+    string id = 1;
+    string name = 2;
+    int32 count = 3;
+    repeated string tags = 4;
+    Status status = 6;
+    string created_by = 8;
+}
+
+enum Status {
+    option allow_alias = true;
+    reserved 2;
+    STATUS_UNSPECIFIED = 0;
+    STATUS_ACTIVE = 1;
+    STATUS_ENABLED = 1;
+}
+
+message GetRequest { string id = 1; }
+
+service ItemService {
+    rpc Get(GetRequest) returns (Item) {
+        option (google.api.http) = {
+            get: "/v1/items/{id}"
+            additional_bindings { get: "/v1/things/{id}" }
+        };
+    }
+    rpc List(GetRequest) returns (stream Item);
+    rpc Delete(GetRequest) returns (Item) {
+        option (google.api.http).delete = "/v1/items/{id}";
+    }
+    rpc Purge(GetRequest) returns (GetRequest);
+    rpc Count(GetRequest) returns (Item);
+}
+`,
+		"api/v1/gone.proto": `syntax = "proto3";
+package api.v1;
+
+message Gone {}
+`,
+	})
+	changes, err := compareProtoFiles(baseline, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("compareProtoFiles() = %v, want no breaking change", changes)
+	}
+}
+
+func TestProtoHTTPBindingsReadDescriptorSets(t *testing.T) {
+	sources := map[string]string{"api.proto": `syntax = "proto3";
+package api;
+
+import "google/api/annotations.proto";
+
+message Empty {}
+
+service WebService {
+    rpc Version(Empty) returns (Empty) {
+        option (google.api.http) = { get: "/version" };
+    }
+}
+`}
+	baseline := compileTestProto(t, sources)
+	// A buf-built descriptor set carries the option as the encoded
+	// extension, which the agent has no Go type for.
+	options := &descriptorpb.MethodOptions{}
+	var rule []byte
+	rule = protowire.AppendTag(rule, 2, protowire.BytesType)
+	rule = protowire.AppendString(rule, "/version")
+	var extension []byte
+	extension = protowire.AppendTag(extension, httpRuleExtension, protowire.BytesType)
+	extension = protowire.AppendBytes(extension, rule)
+	options.ProtoReflect().SetUnknown(extension)
+	baseline["api.proto"].GetService()[0].GetMethod()[0].Options = options
+
+	current := compileTestProto(t, sources)
+	if changes, err := compareProtoFiles(baseline, current); err != nil || len(changes) != 0 {
+		t.Fatalf("compareProtoFiles() = %v, %v; want no change", changes, err)
+	}
+	current["api.proto"].GetService()[0].GetMethod()[0].Options = nil
+	changes, err := compareProtoFiles(baseline, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Change != "rpc api.WebService.Version changed its HTTP bindings from GET /version to none" {
+		t.Fatalf("compareProtoFiles() = %v, want the dropped GET /version", changes)
+	}
+}
+
+func TestCompareProtoFilesSkipsBaselineImports(t *testing.T) {
+	// A descriptor set built with its imports carries googleapis along.
+	baseline := compileTestProto(t, map[string]string{
+		"api.proto": `syntax = "proto3";
+package api;
+import "google/api/annotations.proto";
+message Empty {}
+`,
+		"google/api/annotations.proto": `syntax = "proto3";
+package google.api;
+import "google/api/http.proto";
+`,
+		"google/api/http.proto": httpRuleProto,
+	})
+	current := compileTestProto(t, map[string]string{"api.proto": `syntax = "proto3";
+package api;
+import "google/api/annotations.proto";
+message Empty {}
+`})
+	if changes, err := compareProtoFiles(baseline, current); err != nil || len(changes) != 0 {
+		t.Fatalf("compareProtoFiles() = %v, %v; want no change", changes, err)
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	command := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if out, err := command.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestCheckProtoBreakingAgainstGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repository := t.TempDir()
+	root := filepath.Join(repository, "services", "items")
+	proto := filepath.Join(root, "proto", "api", "v1", "items.proto")
+	writeTestFile(t, proto, breakingBaselineProto)
+
+	// Outside a checkout there is nothing to compare against.
+	report, err := checkProtoBreaking(t.Context(), root, "proto", "")
+	if err != nil || report != nil {
+		t.Fatalf("checkProtoBreaking() outside git = %v, %v; want no report", report, err)
+	}
+	git(t, repository, "init", "-q")
+	report, err = checkProtoBreaking(t.Context(), root, "proto", "")
+	if err != nil || report != nil {
+		t.Fatalf("checkProtoBreaking() without commits = %v, %v; want no report", report, err)
+	}
+	if _, err := checkProtoBreaking(t.Context(), root, "proto", "git"); err == nil {
+		t.Fatal("checkProtoBreaking(git) without commits succeeded")
+	}
+
+	git(t, repository, "add", "-A")
+	git(t, repository, "commit", "-q", "-m", "items")
+	writeTestFile(t, proto, strings.Replace(breakingBaselineProto, "message Gone {}\n", "", 1))
+	report, err = checkProtoBreaking(t.Context(), root, "proto", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []protoBreakingChange{{File: "api/v1/items.proto", Change: "message api.v1.Gone was removed"}}
+	if !reflect.DeepEqual(report.Changes, want) || !strings.HasPrefix(report.Against, "git HEAD (") {
+		t.Fatalf("checkProtoBreaking() = %+v, want Gone removed against HEAD", report)
+	}
+	if !strings.Contains(report.String(), "1 breaking proto change(s) against git HEAD") {
+		t.Fatalf("report = %q", report.String())
+	}
+}
+
+func TestCheckProtoBreakingAgainstStoredBaseline(t *testing.T) {
+	root := t.TempDir()
+	proto := filepath.Join(root, "proto", "api", "v1", "items.proto")
+	writeTestFile(t, proto, breakingBaselineProto)
+	if _, err := checkProtoBreaking(t.Context(), root, "proto", protoAgainstBaseline); err == nil {
+		t.Fatal("checkProtoBreaking(baseline) without a stored baseline succeeded")
+	}
+	count, err := writeProtoBaseline(root, "proto")
+	if err != nil || count != 1 {
+		t.Fatalf("writeProtoBaseline() = %d, %v", count, err)
+	}
+	report, err := checkProtoBreaking(t.Context(), root, "proto", "")
+	if err != nil || report.breaking() || report.Against != protoBaselineFile {
+		t.Fatalf("checkProtoBreaking() of the stored tree = %+v, %v", report, err)
+	}
+
+	writeTestFile(t, proto, strings.Replace(breakingBaselineProto, "    string owner = 5;\n", "", 1))
+	for _, against := range []string{"", protoAgainstBaseline, protoBaselineFile} {
+		report, err := checkProtoBreaking(t.Context(), root, "proto", against)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Changes) != 1 || report.Changes[0].Change != "field api.v1.Item.owner (5) was removed" {
+			t.Fatalf("checkProtoBreaking(%q) = %+v, want owner removed", against, report)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "bad.binpb"), []byte("not a descriptor set"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkProtoBreaking(t.Context(), root, "proto", "bad.binpb"); err == nil {
+		t.Fatal("checkProtoBreaking() accepted an invalid descriptor set")
+	}
+}
+
+func TestProtoBaselineIdentityFollowsTheBaseline(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "proto", "api", "v1", "items.proto"), breakingBaselineProto)
+	if got := protoBaselineIdentity(t.Context(), root, ""); got != nil {
+		t.Fatalf("protoBaselineIdentity() without a baseline = %q, want nil", got)
+	}
+
+	git(t, root, "init", "-q")
+	git(t, root, "add", "-A")
+	git(t, root, "commit", "-q", "-m", "items")
+	first := protoBaselineIdentity(t.Context(), root, "")
+	if !bytes.HasPrefix(first, []byte("git ")) {
+		t.Fatalf("protoBaselineIdentity() = %q, want the HEAD commit", first)
+	}
+	git(t, root, "commit", "-q", "--allow-empty", "-m", "moved")
+	moved := protoBaselineIdentity(t.Context(), root, "")
+	if bytes.Equal(moved, first) {
+		t.Fatal("protoBaselineIdentity() ignored a new HEAD")
+	}
+	if got := protoBaselineIdentity(t.Context(), root, "git:HEAD~1"); !bytes.Equal(got, first) {
+		t.Fatalf("protoBaselineIdentity(git:HEAD~1) = %q, want %q", got, first)
+	}
+
+	// A stored baseline takes over from git, and rewriting it is a change.
+	if _, err := writeProtoBaseline(root, "proto"); err != nil {
+		t.Fatal(err)
+	}
+	stored := protoBaselineIdentity(t.Context(), root, "")
+	if bytes.Equal(stored, moved) || !bytes.Equal(stored, protoBaselineIdentity(t.Context(), root, protoAgainstBaseline)) {
+		t.Fatalf("protoBaselineIdentity() = %q, want the stored baseline", stored)
+	}
+	writeTestFile(t, filepath.Join(root, "proto", "api", "v1", "items.proto"), strings.Replace(breakingBaselineProto, "message Gone {}\n", "", 1))
+	if _, err := writeProtoBaseline(root, "proto"); err != nil {
+		t.Fatal(err)
+	}
+	if got := protoBaselineIdentity(t.Context(), root, ""); bytes.Equal(got, stored) {
+		t.Fatal("protoBaselineIdentity() ignored an updated baseline")
+	}
+}
+
+func TestProtoBreakingSpecValidate(t *testing.T) {
+	for _, against := range []string{"", "git", "git:main", "git:v1.2.0", "git:HEAD~1", "baseline", "build/api.binpb"} {
+		if err := (&ProtoBreakingSpec{Against: against}).Validate(); err != nil {
+			t.Errorf("Validate(%q) = %v", against, err)
+		}
+	}
+	for _, against := range []string{"git:", "git:--output=x", "git:main branch", "../api.binpb", "/tmp/api.binpb"} {
+		if err := (&ProtoBreakingSpec{Against: against}).Validate(); err == nil {
+			t.Errorf("Validate(%q) succeeded", against)
+		}
+	}
+}
+
+func TestParseProtoBreakingArgs(t *testing.T) {
+	options, err := parseProtoBreakingArgs([]string{"--against=git:main"})
+	if err != nil || options.against != "git:main" || options.updateBaseline {
+		t.Fatalf("parseProtoBreakingArgs() = %+v, %v", options, err)
+	}
+	for _, args := range [][]string{
+		{"--against="},
+		{"--against=../x.binpb"},
+		{"--update-baseline", "--against=git"},
+		{"--json"},
+	} {
+		if _, err := parseProtoBreakingArgs(args); err == nil {
+			t.Errorf("parseProtoBreakingArgs(%q) succeeded", args)
+		}
+	}
+}
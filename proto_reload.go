@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codefly-dev/core/wool"
+)
+
+// protoDiagnostic is one error buf or protocompile reported against a proto
+// source, located the way editors jump to it.
+type protoDiagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (d protoDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// protoDiagnosticLine matches "path/to/file.proto:12:5: message", the form
+// both buf and protocompile print.
+var protoDiagnosticLine = regexp.MustCompile(`([^\s:"']+\.proto):(\d+):(\d+):\s*(.+)`)
+
+// protoDiagnostics extracts the located errors from a failed generation's
+// output, in order and without duplicates.
+func protoDiagnostics(output string) []protoDiagnostic {
+	var diagnostics []protoDiagnostic
+	seen := map[protoDiagnostic]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		match := protoDiagnosticLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		lineNumber, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		diagnostic := protoDiagnostic{
+			File:    filepath.ToSlash(match[1]),
+			Line:    lineNumber,
+			Column:  column,
+			Message: strings.TrimSpace(match[4]),
+		}
+		if !seen[diagnostic] {
+			seen[diagnostic] = true
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+// syncProtoChange runs the staged Sync pipeline after a proto edit during
+// hot reload and applies its output, so the rebuild serves the new API. It
+// returns how many files changed. Changes arriving together are serialized;
+// the later ones find the inputs unchanged and skip generation.
+func (s *Runtime) syncProtoChange(ctx context.Context) (int, error) {
+	s.protoSync.Lock()
+	defer s.protoSync.Unlock()
+	transaction, err := s.GoGrpc.stageSync(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = transaction.Close() }()
+	changed, err := transaction.ChangedFiles()
+	if err != nil {
+		return 0, err
+	}
+	if err := transaction.Apply(); err != nil {
+		return 0, err
+	}
+	s.GoGrpc.recordSync(transaction)
+	if report := s.GoGrpc.syncReport(transaction); report != "" {
+		s.Wool.Warn("proto sync needs attention", wool.Field("report", report))
+	}
+	return len(changed), nil
+}
+
+// reportProtoSyncFailure logs a failed hot-reload generation as one
+// structured entry: the edited file, the located errors when the output has
+// any, and the full error.
+func (s *Runtime) reportProtoSyncFailure(path string, err error) {
+	const message = "proto generation failed; the running service keeps the previous API until the proto is fixed"
+	diagnostics := protoDiagnostics(err.Error())
+	if len(diagnostics) == 0 {
+		s.Wool.Error(message, wool.Field("path", path), wool.ErrField(err))
+		return
+	}
+	located := make([]string, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		located = append(located, diagnostic.String())
+	}
+	s.Wool.Error(message, wool.Field("path", path), wool.Field("diagnostics", located), wool.ErrField(err))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProtoDiagnosticsLocatesBufErrors(t *testing.T) {
+	output := `buf generate failed: exit status 100
+proto/api.proto:12:3:syntax error: unexpected identifier
+proto/api.proto:12:3:syntax error: unexpected identifier
+Failure: compile proto/v1/types.proto:4:10: field "id" already defined
+unrelated line: 4:10`
+	want := []protoDiagnostic{
+		{File: "proto/api.proto", Line: 12, Column: 3, Message: "syntax error: unexpected identifier"},
+		{File: "proto/v1/types.proto", Line: 4, Column: 10, Message: `field "id" already defined`},
+	}
+	got := protoDiagnostics(output)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("protoDiagnostics() = %#v, want %#v", got, want)
+	}
+	if got[0].String() != "proto/api.proto:12:3: syntax error: unexpected identifier" {
+		t.Fatalf("String() = %q", got[0].String())
+	}
+	if diagnostics := protoDiagnostics("network unreachable"); diagnostics != nil {
+		t.Fatalf("protoDiagnostics() without locations = %v", diagnostics)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile/ast"
+	"github.com/bufbuild/protocompile/parser"
+	"github.com/bufbuild/protocompile/reporter"
+)
+
+// protoAPI is the template view of the services the proto input declares,
+// resolved to the Go identifiers protoc-gen-go and protoc-gen-go-grpc emit.
+type protoAPI struct {
+	// Primary reports whether a service is named after the codefly service
+	// (<Title>Service); Configuration.Service implements it.
+	Primary  bool
+	Services []protoService
+	// Imports are the Go packages, other than the service's own gen package,
+	// that declare request or response types.
+	Imports []protoImport
+}
+
+// HTTP reports whether any service has google.api.http bindings, that is
+// whether the REST gateway has generated handlers to register.
+func (a protoAPI) HTTP() bool {
+	for _, service := range a.Services {
+		if service.HTTP {
+			return true
+		}
+	}
+	return false
+}
+
+// protoService is one proto service. Name is the Go prefix of its generated
+// identifiers: <Name>Server, Register<Name>Server, <Name>_ServiceDesc.
+type protoService struct {
+	Name    string
+	Primary bool
+	// HTTP reports google.api.http bindings: grpc-gateway only emits
+	// Register<Name>HandlerFromEndpoint for services that have some.
+	HTTP    bool
+	Methods []protoMethod
+}
+
+// protoMethod is one RPC. Input and Output are qualified Go types such as
+// gen.VersionRequest or emptypb.Empty.
+type protoMethod struct {
+	Name            string
+	Input           string
+	Output          string
+	ClientStreaming bool
+	ServerStreaming bool
+}
+
+type protoImport struct {
+	Alias string
+	Path  string
+}
+
+// protoGoMessage locates the Go type generated for a protobuf message.
+type protoGoMessage struct {
+	importPath string
+	pkg        string
+	name       string
+}
+
+// wellKnownGoPackages maps the google.protobuf messages a service commonly
+// uses in RPC signatures to their protobuf-go packages.
+var wellKnownGoPackages = map[string]string{
+	"Any":         "anypb",
+	"Duration":    "durationpb",
+	"Empty":       "emptypb",
+	"FieldMask":   "fieldmaskpb",
+	"Struct":      "structpb",
+	"Value":       "structpb",
+	"ListValue":   "structpb",
+	"Timestamp":   "timestamppb",
+	"BoolValue":   "wrapperspb",
+	"BytesValue":  "wrapperspb",
+	"DoubleValue": "wrapperspb",
+	"FloatValue":  "wrapperspb",
+	"Int32Value":  "wrapperspb",
+	"Int64Value":  "wrapperspb",
+	"StringValue": "wrapperspb",
+	"UInt32Value": "wrapperspb",
+	"UInt64Value": "wrapperspb",
+}
+
+type parsedProtoFile struct {
+	pkg       string
+	goPackage string
+	node      *ast.FileNode
+}
+
+// declaredProtoService is a service found below the proto root with the
+// go_package of the file declaring it.
+type declaredProtoService struct {
+	Name      string
+	GoPackage string
+	// FullName is the package-qualified name the gRPC health and reflection
+	// services know it by.
+	FullName string
+}
+
+func declaredProtoServices(root string) ([]declaredProtoService, error) {
+	files, err := parseProtoFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	var services []declaredProtoService
+	for _, file := range files {
+		for _, declaration := range file.node.Decls {
+			if service, ok := declaration.(*ast.ServiceNode); ok {
+				fullName := service.Name.Val
+				if file.pkg != "" {
+					fullName = file.pkg + "." + fullName
+				}
+				services = append(services, declaredProtoService{Name: service.Name.Val, GoPackage: file.goPackage, FullName: fullName})
+			}
+		}
+	}
+	return services, nil
+}
+
+// defaultProtoAPI describes the factory api.proto: the primary service with
+// its Version RPC. Create renders with it before any proto is parsed.
+func defaultProtoAPI(primary string) protoAPI {
+	return protoAPI{
+		Primary: true,
+		Services: []protoService{{
+			Name:    primary,
+			Primary: true,
+			HTTP:    true,
+			Methods: []protoMethod{{Name: "Version", Input: "gen.VersionRequest", Output: "gen.VersionResponse"}},
+		}},
+	}
+}
+
+// loadProtoAPI describes every service declared below protoRoot, in file
+// order. With withMethods, each RPC's message types are resolved too; they
+// must be declared in those proto files or be well-known types, as anything
+// else cannot be named in generated Go without the full import graph.
+func loadProtoAPI(protoRoot, primary string, withMethods bool) (protoAPI, error) {
+	files, err := parseProtoFiles(protoRoot)
+	if err != nil {
+		return protoAPI{}, err
+	}
+	messages := map[string]protoGoMessage{}
+	for name, pkg := range wellKnownGoPackages {
+		messages["google.protobuf."+name] = protoGoMessage{importPath: "google.golang.org/protobuf/types/known/" + pkg, pkg: pkg, name: name}
+	}
+	for _, file := range files {
+		importPath, pkg := splitGoPackage(file.goPackage)
+		for _, declaration := range file.node.Decls {
+			if message, ok := declaration.(*ast.MessageNode); ok {
+				collectProtoMessages(messages, file.pkg, "", message, importPath, pkg)
+			}
+		}
+	}
+
+	var api protoAPI
+	imports := map[string]string{}
+	for _, file := range files {
+		genPath, _ := splitGoPackage(file.goPackage)
+		for _, declaration := range file.node.Decls {
+			node, ok := declaration.(*ast.ServiceNode)
+			if !ok {
+				continue
+			}
+			service := protoService{Name: goCamelCase(node.Name.Val), Primary: node.Name.Val == primary}
+			for _, element := range node.Decls {
+				rpc, ok := element.(*ast.RPCNode)
+				if !ok {
+					continue
+				}
+				if hasHTTPBinding(rpc) {
+					service.HTTP = true
+				}
+				if !withMethods {
+					continue
+				}
+				method, err := resolveProtoMethod(messages, imports, file.pkg, genPath, rpc)
+				if err != nil {
+					return protoAPI{}, fmt.Errorf("service %s: %w", node.Name.Val, err)
+				}
+				service.Methods = append(service.Methods, method)
+			}
+			api.Primary = api.Primary || service.Primary
+			api.Services = append(api.Services, service)
+		}
+	}
+	for alias, importPath := range imports {
+		api.Imports = append(api.Imports, protoImport{Alias: alias, Path: importPath})
+	}
+	sort.Slice(api.Imports, func(i, j int) bool { return api.Imports[i].Path < api.Imports[j].Path })
+	return api, nil
+}
+
+func resolveProtoMethod(messages map[string]protoGoMessage, imports map[string]string, pkg, genPath string, rpc *ast.RPCNode) (protoMethod, error) {
+	goType := func(reference string) (string, error) {
+		message, ok := resolveProtoMessage(messages, pkg, reference)
+		if !ok {
+			return "", fmt.Errorf("rpc %s: message %s is not declared in the service's proto files", rpc.Name.Val, reference)
+		}
+		if message.importPath == genPath {
+			return "gen." + message.name, nil
+		}
+		if previous, ok := imports[message.pkg]; ok && previous != message.importPath {
+			return "", fmt.Errorf("rpc %s: Go packages %s and %s are both named %s", rpc.Name.Val, previous, message.importPath, message.pkg)
+		}
+		imports[message.pkg] = message.importPath
+		return message.pkg + "." + message.name, nil
+	}
+	input, err := goType(string(rpc.Input.MessageType.AsIdentifier()))
+	if err != nil {
+		return protoMethod{}, err
+	}
+	output, err := goType(string(rpc.Output.MessageType.AsIdentifier()))
+	if err != nil {
+		return protoMethod{}, err
+	}
+	return protoMethod{
+		Name:            goCamelCase(rpc.Name.Val),
+		Input:           input,
+		Output:          output,
+		ClientStreaming: rpc.Input.Stream != nil,
+		ServerStreaming: rpc.Output.Stream != nil,
+	}, nil
+}
+
+func hasHTTPBinding(rpc *ast.RPCNode) bool {
+	for _, element := range rpc.Decls {
+		option, ok := element.(*ast.OptionNode)
+		if !ok || len(option.Name.Parts) == 0 || option.Name.Parts[0].Open == nil {
+			continue
+		}
+		if strings.TrimPrefix(string(option.Name.Parts[0].Name.AsIdentifier()), ".") == "google.api.http" {
+			return true
+		}
+	}
+	return false
+}
+
+func parseProtoFiles(root string) ([]parsedProtoFile, error) {
+	var files []parsedProtoFile
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		node, parseErr := parser.Parse(path, file, reporter.NewHandler(nil))
+		closeErr := file.Close()
+		if parseErr != nil {
+			return parseErr
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+		parsed := parsedProtoFile{node: node}
+		for _, declaration := range node.Decls {
+			switch declaration := declaration.(type) {
+			case *ast.PackageNode:
+				parsed.pkg = string(declaration.Name.AsIdentifier())
+			case *ast.OptionNode:
+				if len(declaration.Name.Parts) != 1 || declaration.Name.Parts[0].Open != nil || declaration.Name.Parts[0].Name.AsIdentifier() != "go_package" {
+					continue
+				}
+				if value, ok := declaration.Val.(ast.StringValueNode); ok {
+					parsed.goPackage = value.AsString()
+				}
+			}
+		}
+		files = append(files, parsed)
+		return nil
+	})
+	return files, err
+}
+
+// collectProtoMessages registers message and its nested messages under their
+// fully-qualified names. Nested Go names join the parents with "_", as
+// protoc-gen-go does.
+func collectProtoMessages(messages map[string]protoGoMessage, pkg, parent string, message *ast.MessageNode, importPath, goPkg string) {
+	relative := message.Name.Val
+	if parent != "" {
+		relative = parent + "." + relative
+	}
+	fullName := relative
+	if pkg != "" {
+		fullName = pkg + "." + relative
+	}
+	messages[fullName] = protoGoMessage{importPath: importPath, pkg: goPkg, name: goCamelCase(relative)}
+	for _, declaration := range message.Decls {
+		if nested, ok := declaration.(*ast.MessageNode); ok {
+			collectProtoMessages(messages, pkg, relative, nested, importPath, goPkg)
+		}
+	}
+}
+
+// resolveProtoMessage applies protobuf scoping: a relative reference is looked
+// up in the file's package, then in each enclosing package.
+func resolveProtoMessage(messages map[string]protoGoMessage, pkg, reference string) (protoGoMessage, bool) {
+	if absolute, ok := strings.CutPrefix(reference, "."); ok {
+		message, found := messages[absolute]
+		return message, found
+	}
+	scope := pkg
+	for {
+		candidate := reference
+		if scope != "" {
+			candidate = scope + "." + reference
+		}
+		if message, ok := messages[candidate]; ok {
+			return message, true
+		}
+		if scope == "" {
+			return protoGoMessage{}, false
+		}
+		if index := strings.LastIndex(scope, "."); index >= 0 {
+			scope = scope[:index]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// splitGoPackage splits a go_package option ("path;name" or "path") into the
+// import path and the package name.
+func splitGoPackage(option string) (string, string) {
+	importPath, name, ok := strings.Cut(option, ";")
+	if !ok {
+		name = strings.Map(func(r rune) rune {
+			if r == '-' || r == '.' {
+				return '_'
+			}
+			return r
+		}, path.Base(importPath))
+	}
+	return importPath, name
+}
+
+// goCamelCase is protoc-gen-go's conversion of a protobuf name to a Go
+// identifier (google.golang.org/protobuf/internal/strs.GoCamelCase).
+func goCamelCase(s string) string {
+	isLower := func(c byte) bool { return 'a' <= c && c <= 'z' }
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isLower(s[i+1]):
+			// Skip over '.' in ".{{lowercase}}".
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+			// Skip over '_' in "_{{lowercase}}".
+		case isDigit(c):
+			b = append(b, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
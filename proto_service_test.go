@@ -0,0 +1,152 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadProtoAPIResolvesEveryMethodShape(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "api.proto"), `syntax = "proto3";
+package acme.api.v1;
+
+option go_package = "svc/pkg/gen;gen";
+
+import "google/protobuf/empty.proto";
+import "acme/common/v1/page.proto";
+
+message VersionRequest {}
+message VersionResponse {}
+message Outer {
+    message inner_event {}
+}
+
+service WebService {
+    rpc Version(VersionRequest) returns (VersionResponse);
+    rpc watch_events(.acme.api.v1.VersionRequest) returns (stream Outer.inner_event);
+    rpc Upload(stream VersionRequest) returns (google.protobuf.Empty);
+    rpc Chat(stream common.v1.Page) returns (stream VersionResponse);
+}
+`)
+	writeTestFile(t, filepath.Join(root, "acme", "common", "v1", "page.proto"), `syntax = "proto3";
+package acme.common.v1;
+
+option go_package = "svc/pkg/gen/common/v1;commonv1";
+
+message Page {}
+`)
+
+	got, err := loadProtoAPI(root, "WebService", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := protoAPI{
+		Primary: true,
+		Services: []protoService{{
+			Name:    "WebService",
+			Primary: true,
+			Methods: []protoMethod{
+				{Name: "Version", Input: "gen.VersionRequest", Output: "gen.VersionResponse"},
+				{Name: "WatchEvents", Input: "gen.VersionRequest", Output: "gen.OuterInnerEvent", ServerStreaming: true},
+				{Name: "Upload", Input: "gen.VersionRequest", Output: "emptypb.Empty", ClientStreaming: true},
+				{Name: "Chat", Input: "commonv1.Page", Output: "gen.VersionResponse", ClientStreaming: true, ServerStreaming: true},
+			},
+		}},
+		Imports: []protoImport{
+			{Alias: "emptypb", Path: "google.golang.org/protobuf/types/known/emptypb"},
+			{Alias: "commonv1", Path: "svc/pkg/gen/common/v1"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("loadProtoAPI() = %#v, want %#v", got, want)
+	}
+}
+
+func TestLoadProtoAPIListsEveryService(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "public.proto"), `syntax = "proto3";
+package api;
+
+option go_package = "svc/pkg/gen;gen";
+
+import "google/api/annotations.proto";
+
+message VersionRequest {}
+message VersionResponse {}
+
+service WebService {
+    rpc Version(VersionRequest) returns (VersionResponse) {
+        option (google.api.http) = { get: "/version" };
+    }
+}
+`)
+	writeTestFile(t, filepath.Join(root, "admin.proto"), `syntax = "proto3";
+package api;
+
+option go_package = "svc/pkg/gen;gen";
+
+service admin_service {
+    rpc Purge(VersionRequest) returns (VersionResponse);
+}
+`)
+	got, err := loadProtoAPI(root, "WebService", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := protoAPI{
+		Primary: true,
+		Services: []protoService{
+			{Name: "AdminService"},
+			{Name: "WebService", Primary: true, HTTP: true},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("loadProtoAPI() = %#v, want %#v", got, want)
+	}
+	if !got.HTTP() {
+		t.Fatal("HTTP() = false with a bound WebService")
+	}
+}
+
+func TestLoadProtoAPIRejectsUnresolvableTypes(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "api.proto"), `syntax = "proto3";
+package api;
+
+option go_package = "svc/pkg/gen;gen";
+
+import "google/type/date.proto";
+
+message VersionRequest {}
+
+service WebService {
+    rpc Today(VersionRequest) returns (google.type.Date);
+}
+`)
+	_, err := loadProtoAPI(root, "WebService", true)
+	if err == nil || !strings.Contains(err.Error(), "rpc Today: message google.type.Date") {
+		t.Fatalf("loadProtoAPI() error = %v, want the unresolved Today response", err)
+	}
+
+	// Without the Connect bridge the method types are never named.
+	if _, err := loadProtoAPI(root, "WebService", false); err != nil {
+		t.Fatalf("loadProtoAPI() without methods: %v", err)
+	}
+}
+
+func TestGoCamelCaseMatchesProtocGenGo(t *testing.T) {
+	for input, want := range map[string]string{
+		"Version":           "Version",
+		"get_user":          "GetUser",
+		"Outer.inner_event": "OuterInnerEvent",
+		"Outer.Inner":       "Outer_Inner",
+		"_private":          "XPrivate",
+		"v2_api":            "V2Api",
+	} {
+		if got := goCamelCase(input); got != want {
+			t.Errorf("goCamelCase(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
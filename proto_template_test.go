@@ -163,7 +163,7 @@ func TestGeneratedServiceHasPreStartCompositionSeam(t *testing.T) {
 	if err != nil {
 		t.Fatalf("read gRPC adapter template: %v", err)
 	}
-	for _, want := range []string{"GRPCServerOptions []grpc.ServerOption", "Service gen.{{ .Service.Name.Title }}ServiceServer", "grpc.NewServer(c.GRPCServerOptions...)", "if c.Service != nil"} {
+	for _, want := range []string{"GRPCServerOptions []grpc.ServerOption", "Service gen.{{ .Service.Name.Title }}ServiceServer", "c.GRPCServerOptions...)", "grpc.NewServer(options...)", "if c.Service != nil"} {
 		if !strings.Contains(string(grpcTemplate), want) {
 			t.Errorf("gRPC adapter template does not contain %q", want)
 		}
@@ -277,9 +277,49 @@ func TestGeneratedServiceRegistersHealthChecks(t *testing.T) {
 	}
 }
 
+// TestGeneratedServerShutsDownGracefully keeps the listeners supervised: a
+// failure reaches main as an error, and a shutdown drains with health
+// NOT_SERVING before requests in flight get their deadline.
+func TestGeneratedServerShutsDownGracefully(t *testing.T) {
+	serverTemplate, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/server_gen.go.tmpl")
+	if err != nil {
+		t.Fatalf("read server adapter template: %v", err)
+	}
+	source := string(serverTemplate)
+	for _, want := range []string{
+		".Settings.ShutdownPolicy",
+		"errgroup.WithContext(serving)",
+		"server.grpc.gRPC.Stop()",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("server adapter template does not contain %q", want)
+		}
+	}
+	notServing := strings.Index(source, "server.grpc.health.Shutdown()")
+	drain := strings.Index(source, "time.Sleep(drain)")
+	stop := strings.Index(source, "server.grpc.gRPC.GracefulStop()")
+	if notServing < 0 || drain < notServing || stop < drain {
+		t.Error("server adapter must report NOT_SERVING, then drain, then stop the listeners")
+	}
+
+	mainTemplate, err := factoryFS.ReadFile("templates/factory/code/main.go.tmpl")
+	if err != nil {
+		t.Fatalf("read main template: %v", err)
+	}
+	// Must is the one panic left, a helper for the service's own code.
+	if strings.Contains(source, "panic(") || strings.Count(string(mainTemplate), "panic(") != 1 {
+		t.Error("a startup or listener failure still panics instead of reaching main")
+	}
+	for _, want := range []string{"serving <- server.Start(ctx)", "return <-serving", "os.Exit(1)"} {
+		if !strings.Contains(string(mainTemplate), want) {
+			t.Errorf("main template does not contain %q", want)
+		}
+	}
+}
+
 func TestGeneratedScaffoldSelectPreservesUserOwnedFiles(t *testing.T) {
 	selectGenerated := generatedScaffoldSelect()
-	for _, name := range []string{"code", "pkg", "adapters", "plugins", "main.go.tmpl", "grpc_gen.go.tmpl", "registry_gen.go.tmpl"} {
+	for _, name := range []string{"code", "pkg", "adapters", "apierrors", "plugins", "main.go.tmpl", "grpc_gen.go.tmpl", "apierrors_gen.go.tmpl", "registry_gen.go.tmpl"} {
 		if !selectGenerated.Keep(name) {
 			t.Errorf("generated scaffold selection excludes %q", name)
 		}
@@ -296,7 +336,7 @@ func TestGeneratedScaffoldTargetsRequireGeneratedRoot(t *testing.T) {
 	protoRoot := filepath.Join(root, "proto")
 	writeTestFile(t, filepath.Join(protoRoot, "api.proto"), "syntax = \"proto3\"; service WidgetService {}\n")
 	writeTestFile(t, filepath.Join(root, "code", "main.go"), "package main\n")
-	targets, err := generatedScaffoldTargets(root, protoRoot, "WidgetService")
+	targets, err := generatedScaffoldTargets(root, protoRoot)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -305,17 +345,23 @@ func TestGeneratedScaffoldTargetsRequireGeneratedRoot(t *testing.T) {
 	}
 
 	writeTestFile(t, filepath.Join(root, "code", "main.go"), "// This code is generated by the agent\npackage main\n")
-	targets, err = generatedScaffoldTargets(root, protoRoot, "WidgetService")
+	targets, err = generatedScaffoldTargets(root, protoRoot)
 	if err != nil {
 		t.Fatal(err)
 	}
 	want := []string{
 		filepath.Join("code", "main.go"),
+		filepath.Join("code", "pkg", "adapters", "accesslog_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "connect_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "cors_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "errors_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "grpc_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "migrations_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "rest_gen.go"),
 		filepath.Join("code", "pkg", "adapters", "server_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "tls_gen.go"),
+		filepath.Join("code", "pkg", "adapters", "validate_gen.go"),
+		filepath.Join("code", "pkg", "apierrors", "apierrors_gen.go"),
 		filepath.Join("code", "plugins", "registry_gen.go"),
 	}
 	if !reflect.DeepEqual(targets, want) {
@@ -323,11 +369,322 @@ func TestGeneratedScaffoldTargetsRequireGeneratedRoot(t *testing.T) {
 	}
 
 	writeTestFile(t, filepath.Join(protoRoot, "extra.proto"), "syntax = \"proto3\"; service OtherService {}\n")
-	targets, err = generatedScaffoldTargets(root, protoRoot, "WidgetService")
+	targets, err = generatedScaffoldTargets(root, protoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Fatalf("multi-service protocol lost generated scaffolding: %v", targets)
+	}
+
+	writeTestFile(t, filepath.Join(protoRoot, "extra.proto"), "syntax = \"proto3\"; option go_package = \"svc/pkg/other\"; service OtherService {}\n")
+	targets, err = generatedScaffoldTargets(root, protoRoot)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if len(targets) != 0 {
-		t.Fatalf("multi-service protocol claimed single-service scaffolding: %v", targets)
+		t.Fatalf("services split across Go packages claimed generated scaffolding: %v", targets)
+	}
+}
+
+// TestGeneratedServiceRunsPluginMigrationsBeforeServing keeps the
+// framework.Plugin Migrations() contract live: main must apply pending
+// migrations before NewServer binds a listener, and serve the `migrate`
+// subcommand the agent command shells out to.
+func TestGeneratedServiceRunsPluginMigrationsBeforeServing(t *testing.T) {
+	mainTemplate, err := factoryFS.ReadFile("templates/factory/code/main.go.tmpl")
+	if err != nil {
+		t.Fatalf("read main template: %v", err)
+	}
+	source := string(mainTemplate)
+	migrate := strings.Index(source, "adapters.Migrate(ctx, config)")
+	serve := strings.Index(source, "adapters.NewServer(config)")
+	if migrate < 0 || serve < 0 || migrate > serve {
+		t.Fatal("main template must apply plugin migrations before creating the server")
+	}
+	if !strings.Contains(source, `os.Args[1] == "migrate"`) {
+		t.Fatal("main template does not serve the migrate subcommand")
+	}
+
+	migrations, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/migrations_gen.go.tmpl")
+	if err != nil {
+		t.Fatalf("read migrations template: %v", err)
+	}
+	for _, want := range []string{
+		"p.Migrations()",
+		"fs.ReadFile(files, file)",
+		"lockMigrations(ctx, c, conn)",
+		"CREATE TABLE IF NOT EXISTS",
+		"BeginTx",
+		"was modified after it was applied",
+	} {
+		if !strings.Contains(string(migrations), want) {
+			t.Errorf("migrations template does not contain %q", want)
+		}
+	}
+}
+
+// TestGeneratedServiceAppliesCorsPolicyToBothHTTPListeners keeps the REST
+// gateway and the Connect listener on the single rendered policy.
+func TestGeneratedServiceAppliesCorsPolicyToBothHTTPListeners(t *testing.T) {
+	corsTemplate, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/cors_gen.go.tmpl")
+	if err != nil {
+		t.Fatalf("read cors template: %v", err)
+	}
+	if strings.Contains(string(corsTemplate), "TODO") {
+		t.Fatal("cors template still carries the placeholder policy")
+	}
+	if !strings.Contains(string(corsTemplate), ".Settings.CorsPolicy") {
+		t.Fatal("cors template does not render the configured policy")
+	}
+	if !strings.Contains(string(corsTemplate), "{{ .CorsOverridePrefix }}") {
+		t.Fatal("cors template does not scope its overrides to the service's own configuration")
+	}
+	for file, want := range map[string]string{
+		"rest_gen.go.tmpl":    "c, err := Cors()",
+		"connect_gen.go.tmpl": "c.Handler(mux)",
+	} {
+		content, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/" + file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%s does not contain %q", file, want)
+		}
+	}
+}
+
+// TestConnectAdapterBridgesEveryRPCToTheGRPCListener guards against Connect
+// regressing to a hand-written subset: every method comes from the proto and
+// reaches Configuration.Service through the gRPC listener.
+func TestConnectAdapterBridgesEveryRPCToTheGRPCListener(t *testing.T) {
+	connectTemplate, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/connect_gen.go.tmpl")
+	if err != nil {
+		t.Fatalf("read Connect adapter template: %v", err)
+	}
+	source := string(connectTemplate)
+	for _, want := range []string{
+		"{{- range .Methods }}",
+		"bridgeUnary(ctx, req, b.client.{{ .Name }})",
+		"bridgeServerStream(ctx, req, stream, b.client.{{ .Name }})",
+		"bridgeClientStream(ctx, stream, b.client.{{ .Name }})",
+		"bridgeBidiStream(ctx, stream, b.client.{{ .Name }})",
+		"gen.New{{ .Name }}Client(s.conn)",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("Connect adapter template does not contain %q", want)
+		}
+	}
+	if strings.Contains(source, "Version(ctx context.Context") {
+		t.Error("Connect adapter still hard-codes the Version RPC")
+	}
+}
+
+// TestGeneratedAdaptersServeStreamingRPCs keeps per-message validation on
+// every gRPC and Connect stream and the NDJSON and SSE encodings of server
+// streams on the REST listener.
+func TestGeneratedAdaptersServeStreamingRPCs(t *testing.T) {
+	for file, wants := range map[string][]string{
+		"validate_gen.go.tmpl": {
+			"grpc.ChainStreamInterceptor(stream)",
+			"func (s *validatingServerStream) RecvMsg(m any) error",
+			"func (c *validatingConnectConn) Receive(m any) error",
+		},
+		"accesslog_gen.go.tmpl": {
+			"func (rsp *accessLogWriter) Flush()",
+		},
+		"rest_gen.go.tmpl": {
+			"runtime.WithMarshalerOption(ndjsonContentType",
+			"runtime.WithMarshalerOption(sseContentType",
+		},
+	} {
+		content, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/" + file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s does not contain %q", file, want)
+			}
+		}
+	}
+}
+
+// TestGeneratedListenersLogBoundedRedactedRequests keeps request bodies out
+// of memory and out of the log unless they are small, JSON and redacted, on
+// both HTTP listeners.
+func TestGeneratedListenersLogBoundedRedactedRequests(t *testing.T) {
+	accessLogTemplate, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/accesslog_gen.go.tmpl")
+	if err != nil {
+		t.Fatalf("read access log template: %v", err)
+	}
+	for _, want := range []string{
+		".Settings.AccessLogPolicy",
+		"options.GetDebugRedact()",
+		"body = &bodyCapture{ReadCloser: r.Body, limit: accessLog.bodyLimit}",
+		"wool.Get(r.Context()).In(\"access-log\")",
+		"wool.Field(\"trace_id\", traceID(r))",
+	} {
+		if !strings.Contains(string(accessLogTemplate), want) {
+			t.Errorf("access log template does not contain %q", want)
+		}
+	}
+	if strings.Contains(string(accessLogTemplate), "io.ReadAll") {
+		t.Error("access log template buffers whole request bodies")
+	}
+	for file, want := range map[string]string{
+		"rest_gen.go.tmpl":    `AccessLog("rest", handler)`,
+		"connect_gen.go.tmpl": `AccessLog("connect", c.Handler(mux))`,
+	} {
+		content, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/" + file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%s does not contain %q", file, want)
+		}
+		for _, stale := range []string{"logRequestBody", "grpclog"} {
+			if strings.Contains(string(content), stale) {
+				t.Errorf("%s still uses %s", file, stale)
+			}
+		}
+	}
+}
+
+// TestGeneratedAdaptersValidateEveryRequest keeps protovalidate in the
+// interceptors, where a handler cannot forget it, with field violations on
+// the gRPC and Connect paths.
+func TestGeneratedAdaptersValidateEveryRequest(t *testing.T) {
+	for file, wants := range map[string][]string{
+		"validate_gen.go.tmpl": {
+			"grpc.ChainUnaryInterceptor(unary)",
+			"errdetails.BadRequest_FieldViolation",
+			"codes.InvalidArgument",
+			"func (connectValidation) WrapUnary(",
+		},
+		"grpc_gen.go.tmpl": {
+			"ValidateResponses bool",
+			"validationOptions(c.ValidateResponses)",
+		},
+		"connect_gen.go.tmpl": {
+			"connect.WithInterceptors(connectValidation{})",
+		},
+	} {
+		content, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/" + file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s does not contain %q", file, want)
+			}
+		}
+	}
+	grpcTemplate, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/grpc_gen.go.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(grpcTemplate), "protovalidate") {
+		t.Error("grpc_gen.go still builds its own validator")
+	}
+}
+
+// TestGeneratedServiceMapsErrorsConsistently keeps one error mapping behind
+// the gRPC interceptors and the REST problem+json handler.
+func TestGeneratedServiceMapsErrorsConsistently(t *testing.T) {
+	for file, wants := range map[string][]string{
+		"pkg/apierrors/apierrors_gen.go.tmpl": {
+			"func Status(err error) *status.Status",
+			"errdetails.ErrorInfo",
+			"errdetails.BadRequest",
+			"errdetails.RetryInfo",
+			`RedactEnv = "CODEFLY_ERRORS_REDACT"`,
+			`ProblemContentType = "application/problem+json"`,
+		},
+		"pkg/adapters/errors_gen.go.tmpl": {
+			"apierrors.Status(err).Err()",
+		},
+		"pkg/adapters/grpc_gen.go.tmpl": {
+			"append(errorOptions(), c.GRPCServerOptions...)",
+		},
+		"pkg/adapters/rest_gen.go.tmpl": {
+			"runtime.WithErrorHandler(problemErrorHandler)",
+			"apierrors.NewProblem(st, httpStatus, r.URL.Path)",
+		},
+	} {
+		content, err := factoryFS.ReadFile("templates/factory/code/" + file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s does not contain %q", file, want)
+			}
+		}
+	}
+}
+
+// TestGeneratedAdaptersWireEveryProtoService keeps registration, health,
+// gateway and Connect handlers driven by the declared services rather than
+// the single <Title>Service the factory proto starts with.
+func TestGeneratedAdaptersWireEveryProtoService(t *testing.T) {
+	for file, wants := range map[string][]string{
+		"grpc_gen.go.tmpl": {
+			"{{ .Name }} gen.{{ .Name }}Server",
+			"healthServer.SetServingStatus(gen.{{ .Name }}_ServiceDesc.ServiceName",
+			"gen.Register{{ .Name }}Server(grpcServer, c.{{ .Name }})",
+			"gen.Register{{ .Name }}Server(grpcServer, gen.Unimplemented{{ .Name }}Server{})",
+		},
+		"rest_gen.go.tmpl": {
+			"{{- if .HTTP }}",
+			"gen.Register{{ .Name }}HandlerFromEndpoint(ctx, gwMux",
+		},
+		"connect_gen.go.tmpl": {
+			"mux.Handle(genconnect.New{{ .Name }}Handler(",
+		},
+	} {
+		content, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/" + file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if !strings.Contains(string(content), "{{- range .Proto.Services }}") {
+			t.Errorf("%s does not iterate the declared services", file)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s does not contain %q", file, want)
+			}
+		}
+	}
+}
+
+// TestGeneratedListenersServeTLSWhenConfigured keeps every listener and both
+// loopback clients on the LoadTLS configuration instead of hard-coded
+// plaintext.
+func TestGeneratedListenersServeTLSWhenConfigured(t *testing.T) {
+	for file, wants := range map[string][]string{
+		"grpc_gen.go.tmpl":   {"grpc.Creds(credentials.NewTLS(c.TLS.Server))"},
+		"server_gen.go.tmpl": {"LoadTLS()"},
+		"rest_gen.go.tmpl": {
+			"s.config.TLS.LoopbackCredentials()",
+			`s.server.ListenAndServeTLS("", "")`,
+		},
+		"connect_gen.go.tmpl": {
+			"c.TLS.LoopbackCredentials()",
+			`s.server.ListenAndServeTLS("", "")`,
+		},
+	} {
+		content, err := factoryFS.ReadFile("templates/factory/code/pkg/adapters/" + file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if strings.Contains(string(content), "insecure.NewCredentials()") {
+			t.Errorf("%s still dials the gRPC listener without TLS", file)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s does not contain %q", file, want)
+			}
+		}
 	}
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	goast "go/ast"
+	"go/format"
+	goparser "go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// rpcStubsFile is the user-owned file in pkg/adapters that implements the
+// primary service's RPCs on GrpcServer. Sync only ever appends to it.
+const rpcStubsFile = "rpcs.go"
+
+// rpcStubPlan is what Sync does to rpcs.go: the RPCs GrpcServer has no
+// method for, and the handlers in rpcs.go left without an RPC.
+type rpcStubPlan struct {
+	Missing []protoMethod
+	Orphans []string
+}
+
+// collectGrpcServerMethods adds the GrpcServer methods declared in the files
+// of dir that keep selects to declared. It returns the RPC handlers among
+// those of rpcs.go: only that file is searched for orphans, as the generated
+// files declare helpers of the same shape.
+func collectGrpcServerMethods(dir string, keep func(name string) bool, declared map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var handlers []string
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") || !keep(name) {
+			continue
+		}
+		file, err := goparser.ParseFile(fset, filepath.Join(dir, name), nil, goparser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		for _, declaration := range file.Decls {
+			function, ok := declaration.(*goast.FuncDecl)
+			if !ok || !isGrpcServerMethod(function) {
+				continue
+			}
+			declared[function.Name.Name] = true
+			if name == rpcStubsFile && isRPCHandler(function) {
+				handlers = append(handlers, function.Name.Name)
+			}
+		}
+	}
+	return handlers, nil
+}
+
+// planRPCStubs compares the primary service with the declared GrpcServer
+// methods. Any method counts as an implementation, wherever it is declared.
+func planRPCStubs(service protoService, declared map[string]bool, handlers []string) rpcStubPlan {
+	var plan rpcStubPlan
+	rpcs := map[string]bool{}
+	for _, method := range service.Methods {
+		rpcs[method.Name] = true
+		if !declared[method.Name] {
+			plan.Missing = append(plan.Missing, method)
+		}
+	}
+	for _, handler := range handlers {
+		if !rpcs[handler] {
+			plan.Orphans = append(plan.Orphans, handler)
+		}
+	}
+	return plan
+}
+
+func isGrpcServerMethod(function *goast.FuncDecl) bool {
+	if function.Recv == nil || len(function.Recv.List) != 1 {
+		return false
+	}
+	receiver := function.Recv.List[0].Type
+	if star, ok := receiver.(*goast.StarExpr); ok {
+		receiver = star.X
+	}
+	ident, ok := receiver.(*goast.Ident)
+	return ok && ident.Name == "GrpcServer"
+}
+
+// isRPCHandler recognizes the shapes protoc-gen-go-grpc gives service
+// methods: (context.Context, *Request) returning two results, or a stream
+// parameter such as grpc.ServerStreamingServer[Response].
+func isRPCHandler(function *goast.FuncDecl) bool {
+	if !function.Name.IsExported() {
+		return false
+	}
+	params := function.Type.Params.List
+	if len(params) == 0 {
+		return false
+	}
+	if selector, ok := params[0].Type.(*goast.SelectorExpr); ok && isPackageSelector(selector, "context", "Context") {
+		results := function.Type.Results
+		return results != nil && results.NumFields() == 2 && function.Type.Params.NumFields() == 2
+	}
+	last := params[len(params)-1].Type
+	switch generic := last.(type) {
+	case *goast.IndexExpr:
+		last = generic.X
+	case *goast.IndexListExpr:
+		last = generic.X
+	}
+	selector, ok := last.(*goast.SelectorExpr)
+	return ok && strings.HasSuffix(selector.Sel.Name, "Server") &&
+		(isPackageSelector(selector, "grpc", selector.Sel.Name) || strings.Contains(selector.Sel.Name, "_"))
+}
+
+func isPackageSelector(selector *goast.SelectorExpr, pkg, name string) bool {
+	ident, ok := selector.X.(*goast.Ident)
+	return ok && ident.Name == pkg && selector.Sel.Name == name
+}
+
+// rpcStubSource is a handler that answers Unimplemented until it is written,
+// in the signature the generated <Service>Server interface expects. The
+// interceptors of validate_gen.go validate its requests.
+func rpcStubSource(method protoMethod) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "\n// %s implements the %s RPC.\n", method.Name, method.Name)
+	unimplemented := fmt.Sprintf("status.Error(codes.Unimplemented, %q)", method.Name+" is not implemented")
+	switch {
+	case method.ClientStreaming && method.ServerStreaming:
+		fmt.Fprintf(&out, "func (s *GrpcServer) %s(stream grpc.BidiStreamingServer[%s, %s]) error {\n", method.Name, method.Input, method.Output)
+		fmt.Fprintf(&out, "\t// TODO: implement %s.\n", method.Name)
+		fmt.Fprintf(&out, "\treturn %s\n}\n", unimplemented)
+	case method.ClientStreaming:
+		fmt.Fprintf(&out, "func (s *GrpcServer) %s(stream grpc.ClientStreamingServer[%s, %s]) error {\n", method.Name, method.Input, method.Output)
+		fmt.Fprintf(&out, "\t// TODO: implement %s.\n", method.Name)
+		fmt.Fprintf(&out, "\treturn %s\n}\n", unimplemented)
+	case method.ServerStreaming:
+		fmt.Fprintf(&out, "func (s *GrpcServer) %s(req *%s, stream grpc.ServerStreamingServer[%s]) error {\n", method.Name, method.Input, method.Output)
+		fmt.Fprintf(&out, "\t// TODO: implement %s.\n", method.Name)
+		fmt.Fprintf(&out, "\treturn %s\n}\n", unimplemented)
+	default:
+		fmt.Fprintf(&out, "func (s *GrpcServer) %s(ctx context.Context, req *%s) (*%s, error) {\n", method.Name, method.Input, method.Output)
+		fmt.Fprintf(&out, "\t// TODO: implement %s.\n", method.Name)
+		fmt.Fprintf(&out, "\treturn nil, %s\n}\n", unimplemented)
+	}
+	return out.String()
+}
+
+// appendRPCStubs adds a stub for each method after the existing content of
+// rpcs.go (empty when the file does not exist yet) and the imports they use.
+// Existing declarations and comments are kept byte for byte, apart from the
+// import block and gofmt's layout. genImport is the Go package the service's
+// own messages are generated in, referred to as gen.
+func appendRPCStubs(content []byte, genImport string, imports []protoImport, methods []protoMethod) ([]byte, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		content = []byte("package adapters\n")
+	}
+	source := bytes.TrimRight(content, "\n")
+	source = append(source, '\n')
+	var stubs strings.Builder
+	for _, method := range methods {
+		stubs.WriteString(rpcStubSource(method))
+	}
+	source = append(source, stubs.String()...)
+
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, rpcStubsFile, source, goparser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", rpcStubsFile, err)
+	}
+	used := func(pkg string) bool { return strings.Contains(stubs.String(), pkg+".") }
+	required := []protoImport{
+		{Alias: "context", Path: "context"},
+		{Alias: "grpc", Path: "google.golang.org/grpc"},
+		{Alias: "codes", Path: "google.golang.org/grpc/codes"},
+		{Alias: "status", Path: "google.golang.org/grpc/status"},
+		{Alias: "gen", Path: genImport},
+	}
+	for _, required := range append(required, imports...) {
+		if !used(required.Alias) {
+			continue
+		}
+		name := required.Alias
+		if name == path.Base(required.Path) {
+			name = ""
+		}
+		astutil.AddNamedImport(fset, file, name, required.Path)
+	}
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, file); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// formatRPCStubReport tells the user which handlers Sync stubbed and which
+// ones no longer match an RPC.
+func formatRPCStubReport(stubbed, orphans []string) string {
+	var out strings.Builder
+	if len(stubbed) > 0 {
+		fmt.Fprintf(&out, "Added handler stubs to %s for: %s\n", rpcStubsFile, strings.Join(stubbed, ", "))
+	}
+	if len(orphans) > 0 {
+		fmt.Fprintf(&out, "Handlers in %s without an RPC in the proto: %s\n", rpcStubsFile, strings.Join(orphans, ", "))
+	}
+	return out.String()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const userRPCs = `package adapters
+
+import (
+	"context"
+
+	"example/pkg/gen"
+)
+
+// Hello greets.
+func (s *GrpcServer) Hello(ctx context.Context, req *gen.HelloRequest) (*gen.HelloResponse, error) {
+	return &gen.HelloResponse{}, nil
+}
+
+// Goodbye lost its RPC.
+func (s *GrpcServer) Goodbye(ctx context.Context, req *gen.GoodbyeRequest) (*gen.GoodbyeResponse, error) {
+	return nil, nil
+}
+
+func (s *GrpcServer) helper() {}
+`
+
+func TestPlanRPCStubsFindsMissingAndOrphanedHandlers(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "grpc_gen.go"), `package adapters
+
+func (s *GrpcServer) Version(ctx context.Context, req *gen.VersionRequest) (*gen.VersionResponse, error) {
+	return nil, nil
+}
+
+func (s *GrpcServer) Run(ctx context.Context) error { return nil }
+`)
+	writeTestFile(t, filepath.Join(dir, rpcStubsFile), userRPCs)
+	writeTestFile(t, filepath.Join(dir, "rpcs_test.go"), "package adapters\n\nfunc (s *GrpcServer) Watch() {}\n")
+
+	declared := map[string]bool{}
+	handlers, err := collectGrpcServerMethods(dir, func(string) bool { return true }, declared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := protoService{Name: "WebService", Primary: true, Methods: []protoMethod{
+		{Name: "Version", Input: "gen.VersionRequest", Output: "gen.VersionResponse"},
+		{Name: "Hello", Input: "gen.HelloRequest", Output: "gen.HelloResponse"},
+		{Name: "Watch", Input: "gen.WatchRequest", Output: "gen.Event", ServerStreaming: true},
+	}}
+	plan := planRPCStubs(service, declared, handlers)
+	if len(plan.Missing) != 1 || plan.Missing[0].Name != "Watch" {
+		t.Fatalf("Missing = %v", plan.Missing)
+	}
+	if !reflect.DeepEqual(plan.Orphans, []string{"Goodbye"}) {
+		t.Fatalf("Orphans = %v", plan.Orphans)
+	}
+}
+
+func TestAppendRPCStubsKeepsExistingMethods(t *testing.T) {
+	methods := []protoMethod{
+		{Name: "Ping", Input: "emptypb.Empty", Output: "gen.Pong"},
+		{Name: "Watch", Input: "gen.WatchRequest", Output: "gen.Event", ServerStreaming: true},
+		{Name: "Upload", Input: "gen.Chunk", Output: "gen.Receipt", ClientStreaming: true},
+		{Name: "Chat", Input: "gen.Message", Output: "gen.Message", ClientStreaming: true, ServerStreaming: true},
+	}
+	imports := []protoImport{{Alias: "emptypb", Path: "google.golang.org/protobuf/types/known/emptypb"}}
+	stubbed, err := appendRPCStubs([]byte(userRPCs), "example/pkg/gen", imports, methods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(stubbed)
+	// The user's declarations are untouched.
+	body := userRPCs[strings.Index(userRPCs, "// Hello greets."):]
+	if !strings.Contains(source, body) {
+		t.Fatalf("existing methods were rewritten:\n%s", source)
+	}
+	for _, want := range []string{
+		`"google.golang.org/grpc"`,
+		`"google.golang.org/grpc/codes"`,
+		`"google.golang.org/grpc/status"`,
+		`"google.golang.org/protobuf/types/known/emptypb"`,
+		"func (s *GrpcServer) Ping(ctx context.Context, req *emptypb.Empty) (*gen.Pong, error) {\n\t// TODO: implement Ping.\n\treturn nil, status.Error(codes.Unimplemented, \"Ping is not implemented\")\n}",
+		"func (s *GrpcServer) Watch(req *gen.WatchRequest, stream grpc.ServerStreamingServer[gen.Event]) error {\n\t// TODO: implement Watch.\n",
+		"func (s *GrpcServer) Upload(stream grpc.ClientStreamingServer[gen.Chunk, gen.Receipt]) error {",
+		"func (s *GrpcServer) Chat(stream grpc.BidiStreamingServer[gen.Message, gen.Message]) error {",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("stubbed rpcs.go lacks %q:\n%s", want, source)
+		}
+	}
+	if strings.Count(source, `"context"`) != 1 || strings.Count(source, `"example/pkg/gen"`) != 1 {
+		t.Errorf("imports duplicated:\n%s", source)
+	}
+
+	// Appending to the stubbed file declares nothing twice.
+	declared := map[string]bool{}
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, rpcStubsFile), source)
+	if _, err := collectGrpcServerMethods(dir, func(string) bool { return true }, declared); err != nil {
+		t.Fatal(err)
+	}
+	if plan := planRPCStubs(protoService{Methods: methods}, declared, nil); len(plan.Missing) != 0 {
+		t.Fatalf("stubs were not recognized as handlers: %v", plan.Missing)
+	}
+}
+
+func TestAppendRPCStubsCreatesRPCsFile(t *testing.T) {
+	stubbed, err := appendRPCStubs(nil, "example/internal/genv1", nil, []protoMethod{{Name: "Ping", Input: "gen.Ping", Output: "gen.Pong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(stubbed), "package adapters\n\nimport (\n") || !strings.Contains(string(stubbed), `gen "example/internal/genv1"`) {
+		t.Fatalf("appendRPCStubs() =\n%s", stubbed)
+	}
+	if report := formatRPCStubReport([]string{"Ping"}, []string{"Goodbye"}); report != "Added handler stubs to rpcs.go for: Ping\nHandlers in rpcs.go without an RPC in the proto: Goodbye\n" {
+		t.Fatalf("formatRPCStubReport() = %q", report)
+	}
+}
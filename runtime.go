@@ -4,6 +4,7 @@ import (
 	"context"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/codefly-dev/core/agents/helpers/code"
@@ -55,6 +56,11 @@ type Runtime struct {
 	// aborting the rebuild. nil before the first Start.
 	runnerCancel context.CancelFunc
 	testProc     runners.Proc
+	// tls locates the listeners' certificate when the service declares a
+	// tls block; nil serves plaintext.
+	tls *tlsFiles
+	// protoSync serializes the Syncs hot reload runs on proto changes.
+	protoSync sync.Mutex
 }
 
 // NewRuntime composes a go-grpc Runtime by constructing a generic
@@ -87,6 +93,9 @@ func (s *Runtime) Load(ctx context.Context, req *runtimev0.LoadRequest) (*runtim
 	if err = s.Settings.Validate(); err != nil {
 		return s.Base.Runtime.LoadErrorf(err, "invalid Go settings")
 	}
+	if err = s.GoGrpc.recoverSync(); err != nil {
+		return s.Base.Runtime.LoadErrorf(err, "recovering interrupted sync")
+	}
 
 	s.Base.Runtime.SetEnvironment(req.Environment)
 
@@ -100,6 +109,11 @@ func (s *Runtime) Load(ctx context.Context, req *runtimev0.LoadRequest) (*runtim
 		return s.Base.Runtime.LoadErrorf(err, "creating cache location")
 	}
 
+	s.tls, err = resolveTLSFiles(s.GoGrpc.Settings.TLS, s.Location, s.cacheLocation)
+	if err != nil {
+		return s.Base.Runtime.LoadErrorf(err, "preparing tls certificates")
+	}
+
 	if s.Watcher != nil {
 		s.Watcher.Pause()
 	}
@@ -422,7 +436,8 @@ func (s *Runtime) Start(ctx context.Context, req *runtimev0.StartRequest) (*runt
 	if err != nil {
 		return s.Base.Runtime.StartErrorf(err, "getting environment variables")
 	}
-	proc.WithEnvironmentVariables(ctx, startEnvs...)
+	startEnvs = append(startEnvs, resources.Env(shutdownDrainPeriodEnv, "0s"))
+	proc.WithEnvironmentVariables(ctx, append(startEnvs, s.tls.environment(s.Service.SourceLocation)...)...)
 	proc.WithOutput(s.Logger)
 
 	s.runner = proc
@@ -527,6 +542,14 @@ func (s *Runtime) EventHandler(event code.Change) error {
 	s.Wool.Trace("stopping service for rebuild")
 	if strings.HasSuffix(event.Path, ".proto") {
 		s.Wool.Trace("proto change detected")
+		changed, err := s.syncProtoChange(s.Wool.Inject(context.Background()))
+		if err != nil {
+			// Restarting would only fail the same way until the proto is
+			// fixed; the next edit retries.
+			s.reportProtoSyncFailure(event.Path, err)
+			return nil
+		}
+		s.Wool.Info("regenerated code for proto change", wool.Field("path", event.Path), wool.Field("files", changed))
 		// Because we read endpoints in Load
 		s.Base.Runtime.DesiredLoad()
 		return nil
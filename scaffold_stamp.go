@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// generatedStampPrefix starts the last line of every scaffold target Sync
+// writes. The digest covers the rest of the file, so a hand edit shows as a
+// body that no longer matches its stamp.
+const generatedStampPrefix = "// codefly:generated sha256="
+
+// What Sync does with a scaffold target edited by hand, as
+// Settings.ScaffoldConflicts selects it.
+const (
+	// scaffoldConflictKeep leaves the edited file alone (the default).
+	scaffoldConflictKeep = "keep"
+	// scaffoldConflictOrig regenerates the file and moves the edited one
+	// beside it, with scaffoldOrigSuffix.
+	scaffoldConflictOrig = "orig"
+)
+
+const scaffoldOrigSuffix = ".orig"
+
+func validateScaffoldConflicts(policy string) error {
+	switch policy {
+	case "", scaffoldConflictKeep, scaffoldConflictOrig:
+		return nil
+	}
+	return fmt.Errorf("scaffold-conflicts %q must be keep or orig", policy)
+}
+
+// generatedStampDigest ignores trailing newlines, which editors and the
+// stamp itself add or remove.
+func generatedStampDigest(body []byte) string {
+	digest := sha256.Sum256(bytes.TrimRight(body, "\n"))
+	return hex.EncodeToString(digest[:])
+}
+
+// splitGeneratedStamp separates a stamped file into its body and the digest
+// on its last line. ok is false when the file carries no stamp.
+func splitGeneratedStamp(content []byte) (body []byte, digest string, ok bool) {
+	trimmed := bytes.TrimRight(content, "\n")
+	start := bytes.LastIndexByte(trimmed, '\n') + 1
+	line := string(trimmed[start:])
+	if !strings.HasPrefix(line, generatedStampPrefix) {
+		return content, "", false
+	}
+	return trimmed[:start], strings.TrimPrefix(line, generatedStampPrefix), true
+}
+
+// stampGenerated appends the stamp of content, replacing a previous one.
+func stampGenerated(content []byte) []byte {
+	body, _, _ := splitGeneratedStamp(content)
+	body = bytes.TrimRight(body, "\n")
+	stamped := make([]byte, 0, len(body)+len(generatedStampPrefix)+68)
+	stamped = append(stamped, body...)
+	stamped = append(stamped, "\n\n"+generatedStampPrefix+generatedStampDigest(body)+"\n"...)
+	return stamped
+}
+
+// generatedFileEdited reports whether the file at path was changed since
+// Sync stamped it. A missing file was not edited, and neither was one
+// without a stamp: it predates stamping and stays generator-owned, so its
+// first sync stamps it.
+func generatedFileEdited(path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	body, digest, ok := splitGeneratedStamp(content)
+	return ok && digest != generatedStampDigest(body), nil
+}
+
+// scaffoldConflicts lists the targets edited by hand under root.
+func scaffoldConflicts(root string, targets []string) ([]string, error) {
+	var conflicts []string
+	for _, target := range targets {
+		edited, err := generatedFileEdited(filepath.Join(root, target))
+		if err != nil {
+			return nil, fmt.Errorf("check generated file %q: %w", target, err)
+		}
+		if edited {
+			conflicts = append(conflicts, target)
+		}
+	}
+	return conflicts, nil
+}
+
+// stampStagedScaffold stamps the rendered targets once they are in their
+// final, formatted form.
+func stampStagedScaffold(stageRoot string, targets []string) error {
+	for _, target := range targets {
+		path := filepath.Join(stageRoot, target)
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, stampGenerated(content), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatScaffoldConflicts tells the user which edits Sync did not overwrite,
+// or where it moved them.
+func formatScaffoldConflicts(conflicts []string, policy string) string {
+	if len(conflicts) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	if policy == scaffoldConflictOrig {
+		fmt.Fprintf(&out, "%d generated file(s) were edited by hand; regenerated them and kept the edits as %s:\n", len(conflicts), scaffoldOrigSuffix)
+	} else {
+		fmt.Fprintf(&out, "%d generated file(s) were edited by hand and kept; delete them or set scaffold-conflicts: orig to regenerate them:\n", len(conflicts))
+	}
+	for _, conflict := range conflicts {
+		fmt.Fprintf(&out, "C %s\n", filepath.ToSlash(conflict))
+	}
+	return out.String()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStampGeneratedIsStableAndGofmtClean(t *testing.T) {
+	source := []byte("package adapters\n\nfunc Serve() {}\n")
+	stamped := stampGenerated(source)
+	if !bytes.HasPrefix(stamped, source) || !bytes.Contains(stamped, []byte("\n\n"+generatedStampPrefix)) {
+		t.Fatalf("stampGenerated() = %q", stamped)
+	}
+	formatted, err := format.Source(stamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(formatted, stamped) {
+		t.Fatalf("stamped file is not gofmt-clean:\n%s", formatted)
+	}
+	if again := stampGenerated(stamped); !bytes.Equal(again, stamped) {
+		t.Fatalf("restamping changed the file:\n%s", again)
+	}
+	body, digest, ok := splitGeneratedStamp(stamped)
+	if !ok || digest != generatedStampDigest(source) || !bytes.Equal(bytes.TrimRight(body, "\n"), bytes.TrimRight(source, "\n")) {
+		t.Fatalf("splitGeneratedStamp() = %q, %q, %t", body, digest, ok)
+	}
+}
+
+func TestScaffoldConflictsFindsHandEdits(t *testing.T) {
+	root := t.TempDir()
+	stamped := string(stampGenerated([]byte("package adapters\n\nfunc Serve() {}\n")))
+	writeTestFile(t, filepath.Join(root, "grpc_gen.go"), stamped)
+	writeTestFile(t, filepath.Join(root, "rest_gen.go"), strings.Replace(stamped, "Serve()", "Serve(port int)", 1))
+	// Written before stamping: still generator-owned.
+	writeTestFile(t, filepath.Join(root, "tls_gen.go"), "package adapters\n")
+	// Trailing newlines are not an edit.
+	writeTestFile(t, filepath.Join(root, "server_gen.go"), strings.TrimSuffix(stamped, "\n"))
+
+	targets := []string{"grpc_gen.go", "missing_gen.go", "rest_gen.go", "server_gen.go", "tls_gen.go"}
+	conflicts, err := scaffoldConflicts(root, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0] != "rest_gen.go" {
+		t.Fatalf("scaffoldConflicts() = %v", conflicts)
+	}
+
+	if message := formatScaffoldConflicts(conflicts, scaffoldConflictKeep); !strings.HasPrefix(message, "1 generated file(s) were edited by hand and kept;") ||
+		!strings.HasSuffix(message, "\nC rest_gen.go\n") {
+		t.Fatalf("formatScaffoldConflicts(keep) = %q", message)
+	}
+	if message := formatScaffoldConflicts(conflicts, scaffoldConflictOrig); !strings.Contains(message, "kept the edits as .orig") {
+		t.Fatalf("formatScaffoldConflicts(orig) = %q", message)
+	}
+	if message := formatScaffoldConflicts(nil, scaffoldConflictKeep); message != "" {
+		t.Fatalf("formatScaffoldConflicts(nil) = %q", message)
+	}
+}
+
+func TestStampStagedScaffoldStampsRenderedTargets(t *testing.T) {
+	stage := t.TempDir()
+	writeTestFile(t, filepath.Join(stage, "code", "main.go"), "package main\n\nfunc main() {}\n")
+	targets := []string{filepath.Join("code", "main.go"), filepath.Join("code", "pkg", "adapters", "rest_gen.go")}
+	if err := stampStagedScaffold(stage, targets); err != nil {
+		t.Fatal(err)
+	}
+	assertTestFile(t, filepath.Join(stage, "code", "main.go"), string(stampGenerated([]byte("package main\n\nfunc main() {}\n"))))
+	if conflicts, err := scaffoldConflicts(stage, targets); err != nil || len(conflicts) != 0 {
+		t.Fatalf("freshly stamped targets conflict: %v, %v", conflicts, err)
+	}
+}
+
+func TestValidateScaffoldConflicts(t *testing.T) {
+	for _, policy := range []string{"", scaffoldConflictKeep, scaffoldConflictOrig} {
+		if err := validateScaffoldConflicts(policy); err != nil {
+			t.Errorf("validateScaffoldConflicts(%q) = %v", policy, err)
+		}
+	}
+	if err := validateScaffoldConflicts("overwrite"); err == nil {
+		t.Error("validateScaffoldConflicts accepted an unknown policy")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ShutdownSpec configures how the generated server stops on SIGTERM. Its
+// health turns NOT_SERVING for DrainPeriod while the listeners keep serving,
+// so load balancers and the kubelet route away, then requests in flight get
+// Timeout to finish before the listeners are closed. Sync renders the policy
+// into server_gen.go and Deploy sizes terminationGracePeriodSeconds to cover
+// both.
+//
+// Both are Go durations such as "5s".
+type ShutdownSpec struct {
+	DrainPeriod string `yaml:"drain-period,omitempty"`
+	Timeout     string `yaml:"timeout,omitempty"`
+}
+
+// shutdownPolicy is the effective shutdown the server_gen.go template renders
+// and the deployment waits for.
+type shutdownPolicy struct {
+	DrainPeriod time.Duration
+	Timeout     time.Duration
+}
+
+const (
+	defaultShutdownDrainPeriod = 5 * time.Second
+	defaultShutdownTimeout     = 20 * time.Second
+	// shutdownGraceMargin leaves the process time to run its clean hooks and
+	// exit after the listeners are closed, before the kubelet kills it.
+	shutdownGraceMargin = 5 * time.Second
+)
+
+// shutdownDrainPeriodEnv overrides the drain period of the generated
+// server_gen.go, as CODEFLY_SHUTDOWN_TIMEOUT does the timeout. The local
+// runtime sets it to zero: nothing routes to the service, so a restart need
+// not wait.
+const shutdownDrainPeriodEnv = "CODEFLY_SHUTDOWN_DRAIN_PERIOD"
+
+// ShutdownPolicy is the declared shutdown with the defaults applied. Validate
+// has already rejected durations that do not parse.
+func (s *Settings) ShutdownPolicy() shutdownPolicy {
+	policy := shutdownPolicy{DrainPeriod: defaultShutdownDrainPeriod, Timeout: defaultShutdownTimeout}
+	if s.Shutdown == nil {
+		return policy
+	}
+	if drain, err := time.ParseDuration(s.Shutdown.DrainPeriod); err == nil {
+		policy.DrainPeriod = drain
+	}
+	if timeout, err := time.ParseDuration(s.Shutdown.Timeout); err == nil {
+		policy.Timeout = timeout
+	}
+	return policy
+}
+
+// TerminationGracePeriodSeconds is how long the kubelet waits after SIGTERM:
+// the drain period, the timeout and a margin for the process to exit.
+func (p shutdownPolicy) TerminationGracePeriodSeconds() int {
+	return int(math.Ceil((p.DrainPeriod + p.Timeout + shutdownGraceMargin).Seconds()))
+}
+
+// Validate rejects durations that do not parse, a negative drain period and
+// a timeout that leaves no time to finish requests.
+func (s *ShutdownSpec) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.DrainPeriod != "" {
+		drain, err := time.ParseDuration(s.DrainPeriod)
+		if err != nil {
+			return fmt.Errorf("shutdown drain-period %q is not a duration: %w", s.DrainPeriod, err)
+		}
+		if drain < 0 {
+			return fmt.Errorf("shutdown drain-period must not be negative (got %s)", s.DrainPeriod)
+		}
+	}
+	if s.Timeout != "" {
+		timeout, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return fmt.Errorf("shutdown timeout %q is not a duration: %w", s.Timeout, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("shutdown timeout must be positive (got %s)", s.Timeout)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownPolicyFitsTheDefaultGracePeriod(t *testing.T) {
+	var settings Settings
+	policy := settings.ShutdownPolicy()
+	if policy.DrainPeriod != defaultShutdownDrainPeriod || policy.Timeout != defaultShutdownTimeout {
+		t.Fatalf("ShutdownPolicy() = %+v, want the defaults", policy)
+	}
+	if got := policy.TerminationGracePeriodSeconds(); got != 30 {
+		t.Fatalf("TerminationGracePeriodSeconds() = %d, want the kubelet's 30", got)
+	}
+
+	settings.Shutdown = &ShutdownSpec{DrainPeriod: "0s", Timeout: "1m30s"}
+	policy = settings.ShutdownPolicy()
+	if policy.DrainPeriod != 0 || policy.Timeout != 90*time.Second {
+		t.Fatalf("ShutdownPolicy() = %+v, want no drain and 90s", policy)
+	}
+	if got := policy.TerminationGracePeriodSeconds(); got != 95 {
+		t.Fatalf("TerminationGracePeriodSeconds() = %d, want 95", got)
+	}
+
+	settings.Shutdown = &ShutdownSpec{Timeout: "2500ms"}
+	if got := settings.ShutdownPolicy().TerminationGracePeriodSeconds(); got != 13 {
+		t.Fatalf("TerminationGracePeriodSeconds() = %d, want 12.5s rounded up", got)
+	}
+}
+
+func TestShutdownSpecValidate(t *testing.T) {
+	tests := map[string]struct {
+		spec ShutdownSpec
+		want string
+	}{
+		"defaults":       {ShutdownSpec{}, ""},
+		"no drain":       {ShutdownSpec{DrainPeriod: "0s", Timeout: "10s"}, ""},
+		"bare number":    {ShutdownSpec{DrainPeriod: "5"}, "not a duration"},
+		"negative drain": {ShutdownSpec{DrainPeriod: "-1s"}, "must not be negative"},
+		"bad timeout":    {ShutdownSpec{Timeout: "soon"}, "not a duration"},
+		"zero timeout":   {ShutdownSpec{Timeout: "0s"}, "must be positive"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.spec.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+}
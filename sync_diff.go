@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// How a sync changes one file.
+const (
+	syncAdded       = "added"
+	syncRemoved     = "removed"
+	syncModified    = "modified"
+	syncModeChanged = "mode changed"
+)
+
+// syncPatchFile is where a dry-run Sync leaves the patch of what it would
+// change, relative to the service root.
+const syncPatchFile = ".codefly/sync.patch"
+
+// syncDiffInlineLimit bounds the patch a dry-run SyncResponse carries in its
+// message; a larger one is only summarized there.
+const syncDiffInlineLimit = 64 << 10
+
+// syncChange is one file a transaction would change. Path is relative to the
+// service root. Diff is a git-style patch of the file: full hunks for text,
+// only the headers and a summary line for binary content.
+type syncChange struct {
+	Path    string
+	Kind    string
+	Binary  bool
+	Added   int
+	Removed int
+	Diff    string
+}
+
+// Changes classifies and diffs every changed file, from the current tree (a/)
+// to the staged one (b/).
+func (transaction *syncTransaction) Changes() ([]syncChange, error) {
+	var changes []syncChange
+	for _, target := range transaction.sortedTargets() {
+		changed, err := transaction.targetChanges(target)
+		if err != nil {
+			return nil, err
+		}
+		for _, relative := range changed {
+			before, err := readSyncNode(filepath.Join(transaction.actualRoot, relative))
+			if err != nil {
+				return nil, fmt.Errorf("read generated file %q: %w", relative, err)
+			}
+			after, err := readSyncNode(filepath.Join(transaction.stageRoot, relative))
+			if err != nil {
+				return nil, fmt.Errorf("read staged file %q: %w", relative, err)
+			}
+			changes = append(changes, diffSyncNodes(filepath.ToSlash(relative), before, after))
+		}
+	}
+	return changes, nil
+}
+
+// syncPatch joins the per-file diffs. It applies with `git apply` from the
+// service root, binary files aside.
+func syncPatch(changes []syncChange) string {
+	var out strings.Builder
+	for _, change := range changes {
+		out.WriteString(change.Diff)
+	}
+	return out.String()
+}
+
+// syncNode is what a diff shows of a file: its bytes, or a symlink's target,
+// with the mode git records.
+type syncNode struct {
+	content []byte
+	mode    string
+}
+
+// readSyncNode returns nil when path does not exist.
+func readSyncNode(path string) (*syncNode, error) {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		return &syncNode{content: []byte(target), mode: "120000"}, err
+	case info.Mode().Perm()&0o100 != 0:
+		// The owner-execute bit, as syncNodeDigest compares it.
+		content, err := os.ReadFile(path)
+		return &syncNode{content: content, mode: "100755"}, err
+	default:
+		content, err := os.ReadFile(path)
+		return &syncNode{content: content, mode: "100644"}, err
+	}
+}
+
+func diffSyncNodes(relative string, before, after *syncNode) syncChange {
+	change := syncChange{Path: relative, Kind: syncModified}
+	from, to := "a/"+relative, "b/"+relative
+	var header strings.Builder
+	fmt.Fprintf(&header, "diff --git %s %s\n", from, to)
+	var left, right []byte
+	switch {
+	case before == nil:
+		change.Kind = syncAdded
+		fmt.Fprintf(&header, "new file mode %s\n", after.mode)
+		from, right = "/dev/null", after.content
+	case after == nil:
+		change.Kind = syncRemoved
+		fmt.Fprintf(&header, "deleted file mode %s\n", before.mode)
+		to, left = "/dev/null", before.content
+	default:
+		if before.mode != after.mode {
+			fmt.Fprintf(&header, "old mode %s\nnew mode %s\n", before.mode, after.mode)
+		}
+		if bytes.Equal(before.content, after.content) {
+			change.Kind = syncModeChanged
+		}
+		left, right = before.content, after.content
+	}
+	if change.Kind == syncModeChanged {
+		change.Diff = header.String()
+		return change
+	}
+	if bytes.IndexByte(left, 0) >= 0 || bytes.IndexByte(right, 0) >= 0 {
+		change.Binary = true
+		fmt.Fprintf(&header, "Binary files %s and %s differ\n", from, to)
+		change.Diff = header.String()
+		return change
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        syncDiffLines(left),
+		B:        syncDiffLines(right),
+		FromFile: from,
+		ToFile:   to,
+		Context:  3,
+	})
+	for i, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case i < 2:
+			// The ---/+++ file lines.
+		case strings.HasPrefix(line, "+"):
+			change.Added++
+		case strings.HasPrefix(line, "-"):
+			change.Removed++
+		}
+	}
+	change.Diff = header.String() + diff
+	return change
+}
+
+// syncDiffLines splits content into newline-terminated lines, as difflib
+// writes them verbatim. A missing final newline is marked the way git does.
+func syncDiffLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	text := string(content)
+	complete := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i := range lines {
+		lines[i] += "\n"
+	}
+	if !complete {
+		lines[len(lines)-1] += "\\ No newline at end of file\n"
+	}
+	return lines
+}
+
+// formatSyncChanges is a one-line-per-file summary such as
+// "M code/pkg/gen/api.pb.go (+12 -3)".
+func formatSyncChanges(changes []syncChange) string {
+	var out strings.Builder
+	for _, change := range changes {
+		switch {
+		case change.Kind == syncModeChanged:
+			fmt.Fprintf(&out, "T %s (mode)\n", change.Path)
+		case change.Binary:
+			fmt.Fprintf(&out, "%s %s (binary)\n", syncChangeLetter(change.Kind), change.Path)
+		default:
+			fmt.Fprintf(&out, "%s %s (+%d -%d)\n", syncChangeLetter(change.Kind), change.Path, change.Added, change.Removed)
+		}
+	}
+	return out.String()
+}
+
+func syncChangeLetter(kind string) string {
+	switch kind {
+	case syncAdded:
+		return "A"
+	case syncRemoved:
+		return "D"
+	default:
+		return "M"
+	}
+}
+
+// writeSyncPatch records the patch of a dry-run under the service root, or
+// removes a stale one when nothing would change.
+func writeSyncPatch(root string, changes []syncChange) error {
+	target := filepath.Join(root, syncPatchFile)
+	if len(changes) == 0 {
+		if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, []byte(syncPatch(changes)), 0o644)
+}
+
+// syncDryRunMessage is what a dry-run SyncResponse reports beside its changed
+// files: the per-file summary and, when it is small enough, the patch itself.
+func syncDryRunMessage(changes []syncChange) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d file(s) would change; patch written to %s\n", len(changes), syncPatchFile)
+	out.WriteString(formatSyncChanges(changes))
+	if patch := syncPatch(changes); len(patch) <= syncDiffInlineLimit {
+		out.WriteString("\n" + patch)
+	}
+	return out.String()
+}
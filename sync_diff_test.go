@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func stageDiffFixture(t *testing.T) (string, *syncTransaction) {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "gen", "changed.go"), "package gen\n\nconst A = 1\nconst B = 2\n")
+	writeTestFile(t, filepath.Join(root, "gen", "stale.go"), "package gen\n")
+	writeTestFile(t, filepath.Join(root, "gen", "same.go"), "package gen\n")
+	writeTestFile(t, filepath.Join(root, "gen", "image.bin"), "\x00old")
+	writeTestFile(t, filepath.Join(root, "gen", "run.sh"), "#!/bin/sh\n")
+	writeTestFile(t, filepath.Join(root, "gen", "tail.txt"), "one\ntwo")
+
+	transaction, err := newSyncTransaction(root, "modules/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = transaction.Close() })
+	stage := transaction.StageRoot()
+	writeTestFile(t, filepath.Join(stage, "gen", "changed.go"), "package gen\n\nconst A = 1\nconst B = 3\n")
+	writeTestFile(t, filepath.Join(stage, "gen", "new.go"), "package gen\n")
+	writeTestFile(t, filepath.Join(stage, "gen", "same.go"), "package gen\n")
+	writeTestFile(t, filepath.Join(stage, "gen", "image.bin"), "\x00new")
+	writeTestFile(t, filepath.Join(stage, "gen", "run.sh"), "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(stage, "gen", "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(stage, "gen", "tail.txt"), "one\ntwo\n")
+	if err := transaction.TrackDirectory("gen"); err != nil {
+		t.Fatal(err)
+	}
+	return root, transaction
+}
+
+func TestSyncTransactionChangesClassifyAndDiffEveryFile(t *testing.T) {
+	root, transaction := stageDiffFixture(t)
+	changes, err := transaction.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := formatSyncChanges(changes)
+	wantSummary := `M gen/changed.go (+1 -1)
+M gen/image.bin (binary)
+A gen/new.go (+1 -0)
+T gen/run.sh (mode)
+D gen/stale.go (+0 -1)
+M gen/tail.txt (+1 -1)
+`
+	if summary != wantSummary {
+		t.Fatalf("formatSyncChanges() =\n%s\nwant\n%s", summary, wantSummary)
+	}
+
+	want := `diff --git a/gen/changed.go b/gen/changed.go
+--- a/gen/changed.go
++++ b/gen/changed.go
+@@ -1,4 +1,4 @@
+ package gen
+` + " " + `
+ const A = 1
+-const B = 2
++const B = 3
+diff --git a/gen/image.bin b/gen/image.bin
+Binary files a/gen/image.bin and b/gen/image.bin differ
+diff --git a/gen/new.go b/gen/new.go
+new file mode 100644
+--- /dev/null
++++ b/gen/new.go
+@@ -0,0 +1 @@
++package gen
+diff --git a/gen/run.sh b/gen/run.sh
+old mode 100644
+new mode 100755
+diff --git a/gen/stale.go b/gen/stale.go
+deleted file mode 100644
+--- a/gen/stale.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package gen
+diff --git a/gen/tail.txt b/gen/tail.txt
+--- a/gen/tail.txt
++++ b/gen/tail.txt
+@@ -1,2 +1,2 @@
+ one
+-two
+\ No newline at end of file
++two
+`
+	if patch := syncPatch(changes); patch != want {
+		t.Fatalf("syncPatch() =\n%s\nwant\n%s", patch, want)
+	}
+	// Reporting leaves the tree alone.
+	assertTestFile(t, filepath.Join(root, "gen", "changed.go"), "package gen\n\nconst A = 1\nconst B = 2\n")
+}
+
+// TestSyncPatchAppliesWithGit proves the written patch is what Apply does,
+// for every text change.
+func TestSyncPatchAppliesWithGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, transaction := stageDiffFixture(t)
+	// Binary changes are only summarized.
+	writeTestFile(t, filepath.Join(transaction.StageRoot(), "gen", "image.bin"), "\x00old")
+	changes, err := transaction.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSyncPatch(root, changes); err != nil {
+		t.Fatal(err)
+	}
+	command := exec.Command("git", "apply", filepath.Join(root, syncPatchFile))
+	command.Dir = root
+	if out, err := command.CombinedOutput(); err != nil {
+		t.Fatalf("git apply: %v\n%s", err, out)
+	}
+	after, err := transaction.ChangedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 0 {
+		t.Fatalf("applying the patch left drift: %v", after)
+	}
+
+	// A clean dry-run removes the stale patch.
+	if err := writeSyncPatch(root, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, syncPatchFile)); !os.IsNotExist(err) {
+		t.Fatalf("stale sync patch kept: %v", err)
+	}
+}
+
+func TestSyncDryRunMessageInlinesSmallPatches(t *testing.T) {
+	_, transaction := stageDiffFixture(t)
+	changes, err := transaction.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := syncDryRunMessage(changes)
+	if !strings.HasPrefix(message, "6 file(s) would change; patch written to .codefly/sync.patch\nM gen/changed.go (+1 -1)\n") ||
+		!strings.Contains(message, "\n+const B = 3\n") {
+		t.Fatalf("syncDryRunMessage() = %q", message)
+	}
+
+	large := []syncChange{{Path: "gen/large.go", Kind: syncAdded, Added: 1, Diff: strings.Repeat("+x\n", syncDiffInlineLimit)}}
+	if message := syncDryRunMessage(large); message != "1 file(s) would change; patch written to .codefly/sync.patch\nA gen/large.go (+1 -0)\n" {
+		t.Fatalf("syncDryRunMessage() of a large patch = %q", message)
+	}
+}
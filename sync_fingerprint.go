@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// syncStateFile records the last sync that left the tree matching its stage,
+// relative to the service root.
+const syncStateFile = ".codefly/sync-state.json"
+
+// syncInputs is everything a Sync generates from. Paths are files or
+// directories relative to the service root; a missing one is an input too.
+// Exclude lists outputs below Paths, which would otherwise change the
+// fingerprint on every sync. Values are the inputs that are not files:
+// settings, the agent version, dependency endpoints.
+type syncInputs struct {
+	Paths   []string
+	Exclude []string
+	Values  map[string][]byte
+}
+
+// fingerprint hashes the inputs by content and mode, never by time, so
+// touching a file or checking it out again does not force a sync.
+func (inputs syncInputs) fingerprint(root string) (string, error) {
+	hash := sha256.New()
+	for _, relative := range slices.Sorted(slices.Values(inputs.Paths)) {
+		base := filepath.Join(root, relative)
+		if _, err := os.Lstat(base); errors.Is(err, os.ErrNotExist) {
+			_, _ = fmt.Fprintf(hash, "path %q missing\n", filepath.ToSlash(relative))
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		err := filepath.WalkDir(base, func(path string, entry fs.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			file, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if entry.Name() == syncCacheDir || slices.Contains(inputs.Exclude, file) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			digest, err := syncNodeDigest(path)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(hash, "path %q %x\n", filepath.ToSlash(file), digest)
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("fingerprint sync input %q: %w", relative, err)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(inputs.Values)) {
+		value := sha256.Sum256(inputs.Values[key])
+		_, _ = fmt.Fprintf(hash, "value %q %x\n", key, value)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// syncState is the fingerprint of the inputs of the last complete sync, and
+// the digest of every file its targets held afterwards.
+type syncState struct {
+	Fingerprint string            `json:"fingerprint"`
+	Targets     []syncStateTarget `json:"targets"`
+	Outputs     map[string]string `json:"outputs"`
+}
+
+type syncStateTarget struct {
+	Path      string `json:"path"`
+	Directory bool   `json:"directory,omitempty"`
+}
+
+// RecordState remembers the transaction's fingerprint with the outputs now in
+// the tree. Call it once the tree matches the stage: after Apply, or when
+// nothing changed. A transaction without a fingerprint records nothing, nor
+// does one with conflicts or orphaned handlers, so the next sync reports
+// them again.
+func (transaction *syncTransaction) RecordState() error {
+	if transaction.fingerprint == "" || len(transaction.conflicts) > 0 || len(transaction.orphanRPCs) > 0 {
+		return nil
+	}
+	state := syncState{Fingerprint: transaction.fingerprint}
+	for _, target := range transaction.sortedTargets() {
+		state.Targets = append(state.Targets, syncStateTarget{Path: filepath.ToSlash(target.relative), Directory: target.directory})
+	}
+	outputs, err := syncOutputDigests(transaction.actualRoot, state.Targets)
+	if err != nil {
+		return err
+	}
+	state.Outputs = outputs
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(transaction.actualRoot, syncStateFile)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, append(content, '\n'), 0o644)
+}
+
+// syncUpToDate reports whether the last complete sync had these inputs and
+// its outputs are still untouched, in which case a new one changes nothing.
+// A missing or unreadable state is simply not up to date.
+func syncUpToDate(root, fingerprint string) (bool, error) {
+	content, err := os.ReadFile(filepath.Join(root, syncStateFile))
+	if err != nil {
+		return false, nil
+	}
+	var state syncState
+	if err := json.Unmarshal(content, &state); err != nil || state.Fingerprint != fingerprint {
+		return false, nil
+	}
+	for _, target := range state.Targets {
+		if _, err := cleanSyncRelative(filepath.FromSlash(target.Path)); err != nil {
+			return false, nil
+		}
+	}
+	outputs, err := syncOutputDigests(root, state.Targets)
+	if err != nil {
+		return false, err
+	}
+	return maps.Equal(outputs, state.Outputs), nil
+}
+
+// syncOutputDigests hashes every file the targets hold in the tree at root,
+// keyed by its slash-separated path relative to root.
+func syncOutputDigests(root string, targets []syncStateTarget) (map[string]string, error) {
+	outputs := map[string]string{}
+	for _, target := range targets {
+		actual := filepath.Join(root, filepath.FromSlash(target.Path))
+		if !target.Directory {
+			digest, err := syncNodeDigest(actual)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("hash generated file %q: %w", target.Path, err)
+			}
+			outputs[target.Path] = hex.EncodeToString(digest)
+			continue
+		}
+		entries, err := syncTreeEntries(actual)
+		if err != nil {
+			return nil, fmt.Errorf("hash generated directory %q: %w", target.Path, err)
+		}
+		for relative, digest := range entries {
+			outputs[target.Path+"/"+filepath.ToSlash(relative)] = hex.EncodeToString(digest)
+		}
+	}
+	return outputs, nil
+}
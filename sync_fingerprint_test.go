@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncInputsFingerprintTracksContentOnly(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "proto", "api.proto"), "syntax = \"proto3\";\n")
+	writeTestFile(t, filepath.Join(root, "proto", "buf.yaml"), "version: v2\n")
+	inputs := syncInputs{
+		Paths:   []string{"proto", "code/go.mod"},
+		Exclude: []string{filepath.Join("proto", "gen")},
+		Values:  map[string][]byte{"agent": []byte("go-grpc@1")},
+	}
+	fingerprint := func() string {
+		t.Helper()
+		value, err := inputs.fingerprint(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	base := fingerprint()
+
+	// Outputs below an input and rewriting identical content are not changes.
+	writeTestFile(t, filepath.Join(root, "proto", "gen", "api.pb.go"), "package gen\n")
+	writeTestFile(t, filepath.Join(root, "proto", "api.proto"), "syntax = \"proto3\";\n")
+	if got := fingerprint(); got != base {
+		t.Fatal("fingerprint changed without an input change")
+	}
+
+	writeTestFile(t, filepath.Join(root, "proto", "buf.yaml"), "version: v2\nmodules: []\n")
+	edited := fingerprint()
+	if edited == base {
+		t.Fatal("fingerprint ignored a buf.yaml edit")
+	}
+	writeTestFile(t, filepath.Join(root, "code", "go.mod"), "module example\n")
+	if got := fingerprint(); got == edited {
+		t.Fatal("fingerprint ignored a new input file")
+	}
+	created := fingerprint()
+	inputs.Values["agent"] = []byte("go-grpc@2")
+	if got := fingerprint(); got == created {
+		t.Fatal("fingerprint ignored the agent version")
+	}
+}
+
+func TestSyncUpToDateRequiresUntouchedOutputs(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "gen", "api.pb.go"), "package gen\n")
+	writeTestFile(t, filepath.Join(root, "main.go"), "package main\n")
+	transaction, err := newSyncTransaction(root, "modules/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = transaction.Close() }()
+	for _, track := range []func() error{
+		func() error { return transaction.TrackDirectory("gen") },
+		func() error { return transaction.TrackFile("main.go") },
+		func() error { return transaction.TrackFile("buf.lock") },
+	} {
+		if err := track(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if upToDate, err := syncUpToDate(root, "inputs"); err != nil || upToDate {
+		t.Fatalf("syncUpToDate() without a state = %t, %v", upToDate, err)
+	}
+	// Without a fingerprint the transaction did not generate anything.
+	if err := transaction.RecordState(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, syncStateFile)); !os.IsNotExist(err) {
+		t.Fatalf("state recorded without a fingerprint: %v", err)
+	}
+	transaction.fingerprint = "inputs"
+	if err := transaction.RecordState(); err != nil {
+		t.Fatal(err)
+	}
+
+	upToDate := func(fingerprint string) bool {
+		t.Helper()
+		value, err := syncUpToDate(root, fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	if !upToDate("inputs") {
+		t.Fatal("recorded sync is not up to date")
+	}
+	if upToDate("other inputs") {
+		t.Fatal("changed inputs are up to date")
+	}
+
+	writeTestFile(t, filepath.Join(root, "gen", "extra.go"), "package gen\n")
+	if upToDate("inputs") {
+		t.Fatal("an added output file is up to date")
+	}
+	if err := os.Remove(filepath.Join(root, "gen", "extra.go")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, "main.go"), "package main // edited\n")
+	if upToDate("inputs") {
+		t.Fatal("an edited output file is up to date")
+	}
+	writeTestFile(t, filepath.Join(root, "main.go"), "package main\n")
+	writeTestFile(t, filepath.Join(root, "buf.lock"), "version: v2\n")
+	if upToDate("inputs") {
+		t.Fatal("a created output file is up to date")
+	}
+	if err := os.Remove(filepath.Join(root, "buf.lock")); err != nil {
+		t.Fatal(err)
+	}
+	if !upToDate("inputs") {
+		t.Fatal("restored outputs are not up to date")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// syncJournalFile is the write-ahead journal of an Apply in progress,
+// relative to the service root. It only exists while Apply runs, or after
+// the agent died during one.
+const syncJournalFile = ".codefly/sync-journal"
+
+// Apply phases, as recorded in the journal before each one starts.
+const (
+	// syncPhasePrepare: replacements are being copied beside their targets;
+	// the tree is untouched.
+	syncPhasePrepare = "prepare"
+	// syncPhaseCommit: targets are being swapped; recovery rolls back.
+	syncPhaseCommit = "commit"
+	// syncPhaseCommitted: every target swapped; recovery rolls forward.
+	syncPhaseCommitted = "committed"
+)
+
+// syncJournal lists the swaps of one Apply. Sibling paths are derived from
+// Relative, so the journal holds no absolute path and survives a move of
+// the service.
+type syncJournal struct {
+	Phase string            `json:"phase"`
+	Swaps []syncJournalSwap `json:"swaps"`
+
+	root string
+}
+
+type syncJournalSwap struct {
+	Relative string `json:"relative"`
+	// Original is set when the target existed before the swap.
+	Original bool `json:"original,omitempty"`
+	// Replacement is set when a staged replacement swaps in; otherwise the
+	// swap removes the target.
+	Replacement bool `json:"replacement,omitempty"`
+}
+
+func newSyncJournal(root string, swaps []*pendingSwap) *syncJournal {
+	journal := &syncJournal{root: root}
+	for _, swap := range swaps {
+		journal.Swaps = append(journal.Swaps, syncJournalSwap{
+			Relative:    filepath.ToSlash(swap.relative),
+			Original:    swap.original,
+			Replacement: swap.incoming != "",
+		})
+	}
+	return journal
+}
+
+// record durably writes the journal at phase: to a temporary file that is
+// synced, renamed over the journal, and the rename synced in turn.
+func (journal *syncJournal) record(phase string) error {
+	journal.Phase = phase
+	content, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(journal.root, syncJournalFile)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("record sync journal: %w", err)
+	}
+	temporary := target + ".tmp"
+	file, err := os.OpenFile(temporary, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("record sync journal: %w", err)
+	}
+	_, writeErr := file.Write(append(content, '\n'))
+	syncErr := file.Sync()
+	closeErr := file.Close()
+	if err := errors.Join(writeErr, syncErr, closeErr); err != nil {
+		_ = os.Remove(temporary)
+		return fmt.Errorf("record sync journal: %w", err)
+	}
+	if err := os.Rename(temporary, target); err != nil {
+		return fmt.Errorf("record sync journal: %w", err)
+	}
+	return syncDirectory(filepath.Dir(target))
+}
+
+// remove ends the journal once the tree is consistent again.
+func (journal *syncJournal) remove() error {
+	target := filepath.Join(journal.root, syncJournalFile)
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove sync journal: %w", err)
+	}
+	return syncDirectory(filepath.Dir(target))
+}
+
+// syncDirectory flushes renames and removals within dir to disk.
+func syncDirectory(dir string) error {
+	directory, err := os.Open(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	syncErr := directory.Sync()
+	closeErr := directory.Close()
+	return errors.Join(syncErr, closeErr)
+}
+
+// recoverSyncJournal finishes an Apply the agent did not survive. Before
+// every target swapped, the tree is rolled back to its originals; after,
+// it is rolled forward. Either way the suffixed siblings the Apply left are
+// removed. It returns the phase the Apply was interrupted in, or "" when
+// there was nothing to recover. A journal recovery fails to finish is kept,
+// so the next Load or Sync tries again.
+func recoverSyncJournal(root string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(root, syncJournalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("read sync journal: %w", err)
+	}
+	journal := &syncJournal{root: root}
+	if err := json.Unmarshal(content, journal); err != nil {
+		return "", fmt.Errorf("read sync journal: %w", err)
+	}
+	var failures []error
+	for index := len(journal.Swaps) - 1; index >= 0; index-- {
+		swap := journal.Swaps[index]
+		relative, err := cleanSyncRelative(filepath.FromSlash(swap.Relative))
+		if err != nil {
+			return "", fmt.Errorf("read sync journal: %w", err)
+		}
+		actual := filepath.Join(root, relative)
+		if journal.Phase == syncPhaseCommit {
+			if err := rollbackJournalSwap(actual, swap); err != nil {
+				failures = append(failures, fmt.Errorf("roll back generated target %q: %w", swap.Relative, err))
+				continue
+			}
+		}
+		// Leftovers of the other phases are inert siblings, never live targets.
+		for _, leftover := range []string{actual + syncIncomingSuffix, actual + syncBackupSuffix} {
+			if err := os.RemoveAll(leftover); err != nil {
+				failures = append(failures, err)
+			}
+		}
+	}
+	if err := errors.Join(failures...); err != nil {
+		return journal.Phase, err
+	}
+	return journal.Phase, journal.remove()
+}
+
+// rollbackJournalSwap undoes whatever part of one commit ran, reading how
+// far it got from the siblings on disk. prepareSwaps clears stale backups,
+// so a backup present during the commit phase is always this Apply's.
+func rollbackJournalSwap(actual string, swap syncJournalSwap) error {
+	backup := actual + syncBackupSuffix
+	incoming := actual + syncIncomingSuffix
+	if swap.Original {
+		if _, err := os.Lstat(backup); errors.Is(err, os.ErrNotExist) {
+			// The original was never moved aside.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(actual); err != nil {
+			return err
+		}
+		return os.Rename(backup, actual)
+	}
+	if !swap.Replacement {
+		return nil
+	}
+	// A new target: it swapped in when its replacement is no longer beside it.
+	if _, err := os.Lstat(incoming); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.RemoveAll(actual)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// interruptedApply stands in for an Apply the agent did not survive: the
+// journal at phase over an original "gen/api.go" and a new "gen/new.go",
+// each with its replacement materialized beside it.
+func interruptedApply(t *testing.T, phase string) (string, []*pendingSwap) {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "gen", "api.go"), "api-before")
+	api := filepath.Join(root, "gen", "api.go")
+	fresh := filepath.Join(root, "gen", "new.go")
+	writeTestFile(t, api+syncIncomingSuffix, "api-after")
+	writeTestFile(t, fresh+syncIncomingSuffix, "new-after")
+	swaps := []*pendingSwap{
+		{relative: filepath.Join("gen", "api.go"), actual: api, original: true, incoming: api + syncIncomingSuffix},
+		{relative: filepath.Join("gen", "new.go"), actual: fresh, incoming: fresh + syncIncomingSuffix},
+	}
+	if err := newSyncJournal(root, swaps).record(phase); err != nil {
+		t.Fatal(err)
+	}
+	return root, swaps
+}
+
+func assertNoSyncLeftovers(t *testing.T, root string) {
+	t.Helper()
+	err := filepath.Walk(root, func(path string, _ os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if strings.Contains(path, ".codefly-sync-") || strings.HasSuffix(path, syncJournalFile) {
+			t.Errorf("sync leftover %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverSyncJournalRollsBackEveryCommitStep(t *testing.T) {
+	steps := map[string]func(t *testing.T, swaps []*pendingSwap){
+		"before any swap": func(*testing.T, []*pendingSwap) {},
+		"original moved aside": func(t *testing.T, swaps []*pendingSwap) {
+			if err := os.Rename(swaps[0].actual, swaps[0].actual+syncBackupSuffix); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"first swapped": func(t *testing.T, swaps []*pendingSwap) {
+			if err := swaps[0].commit(); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"all swapped": func(t *testing.T, swaps []*pendingSwap) {
+			for _, swap := range swaps {
+				if err := swap.commit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+	}
+	for name, step := range steps {
+		t.Run(name, func(t *testing.T) {
+			root, swaps := interruptedApply(t, syncPhaseCommit)
+			step(t, swaps)
+
+			phase, err := recoverSyncJournal(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if phase != syncPhaseCommit {
+				t.Fatalf("recoverSyncJournal() phase = %q", phase)
+			}
+			assertTestFile(t, filepath.Join(root, "gen", "api.go"), "api-before")
+			if _, err := os.Lstat(filepath.Join(root, "gen", "new.go")); !os.IsNotExist(err) {
+				t.Fatalf("new target kept after rollback: %v", err)
+			}
+			assertNoSyncLeftovers(t, root)
+		})
+	}
+}
+
+func TestRecoverSyncJournalRollsForwardOnceCommitted(t *testing.T) {
+	root, swaps := interruptedApply(t, syncPhaseCommitted)
+	for _, swap := range swaps {
+		if err := swap.commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if phase, err := recoverSyncJournal(root); err != nil || phase != syncPhaseCommitted {
+		t.Fatalf("recoverSyncJournal() = %q, %v", phase, err)
+	}
+	assertTestFile(t, filepath.Join(root, "gen", "api.go"), "api-after")
+	assertTestFile(t, filepath.Join(root, "gen", "new.go"), "new-after")
+	assertNoSyncLeftovers(t, root)
+}
+
+func TestRecoverSyncJournalDiscardsPreparedReplacements(t *testing.T) {
+	root, _ := interruptedApply(t, syncPhasePrepare)
+	// A backup orphaned by an older crash is cleaned up too.
+	writeTestFile(t, filepath.Join(root, "gen", "api.go")+syncBackupSuffix, "stale")
+	if phase, err := recoverSyncJournal(root); err != nil || phase != syncPhasePrepare {
+		t.Fatalf("recoverSyncJournal() = %q, %v", phase, err)
+	}
+	assertTestFile(t, filepath.Join(root, "gen", "api.go"), "api-before")
+	assertNoSyncLeftovers(t, root)
+
+	if phase, err := recoverSyncJournal(root); err != nil || phase != "" {
+		t.Fatalf("recoverSyncJournal() without a journal = %q, %v", phase, err)
+	}
+}
+
+func TestSyncTransactionApplyLeavesNoJournal(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "gen", "api.go"), "before")
+	// An earlier crash left a backup of the target behind.
+	writeTestFile(t, filepath.Join(root, "gen", "api.go")+syncBackupSuffix, "stale")
+	transaction, err := newSyncTransaction(root, "modules/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = transaction.Close() }()
+	writeTestFile(t, filepath.Join(transaction.StageRoot(), "gen", "api.go"), "after")
+	if err := transaction.TrackFile(filepath.Join("gen", "api.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := transaction.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	assertTestFile(t, filepath.Join(root, "gen", "api.go"), "after")
+	assertNoSyncLeftovers(t, root)
+}
+
+func TestRecoverSyncJournalRejectsEscapingPaths(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, syncJournalFile), `{"phase":"commit","swaps":[{"relative":"../outside","original":true}]}`)
+	if _, err := recoverSyncJournal(root); err == nil {
+		t.Fatal("journal escaping the service root was accepted")
+	}
+}
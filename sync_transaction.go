@@ -23,6 +23,16 @@ type syncTransaction struct {
 	stageRoot       string
 	workspacePrefix string
 	targets         map[string]syncTarget
+	// fingerprint identifies the inputs the stage was generated from; see
+	// RecordState.
+	fingerprint string
+	// conflicts are generated files edited by hand, relative to the service
+	// root; see scaffoldConflicts.
+	conflicts []string
+	// stubbedRPCs and orphanRPCs are the handlers the transaction adds to
+	// rpcs.go, and those there without an RPC; see planRPCStubs.
+	stubbedRPCs []string
+	orphanRPCs  []string
 }
 
 func newSyncTransaction(actualRoot, workspacePrefix string) (*syncTransaction, error) {
@@ -142,6 +152,7 @@ const (
 type pendingSwap struct {
 	relative string
 	actual   string
+	original bool   // actual existed when the swap was planned
 	incoming string // staged replacement beside actual; "" when the target is being removed
 	backup   string // displaced original beside actual; "" when no original existed
 	swapped  bool
@@ -153,37 +164,57 @@ type pendingSwap struct {
 // happens before the real tree is touched. Each target then swaps in via
 // renames within its parent directory, keeping the displaced original until
 // every target has swapped; a failure mid-swap renames the originals back,
-// so the tree is not left partially updated.
+// so the tree is not left partially updated. A journal records each phase
+// first, so recoverSyncJournal can finish the job after a crash.
 func (transaction *syncTransaction) Apply() error {
-	swaps, err := transaction.prepareSwaps()
-	if err != nil {
-		discardIncoming(swaps)
+	swaps, err := transaction.planSwaps()
+	if err != nil || len(swaps) == 0 {
+		return err
+	}
+	journal := newSyncJournal(transaction.actualRoot, swaps)
+	if err := journal.record(syncPhasePrepare); err != nil {
 		return err
 	}
+	if err := transaction.prepareSwaps(swaps); err != nil {
+		discardIncoming(swaps)
+		return errors.Join(err, journal.remove())
+	}
+	if err := journal.record(syncPhaseCommit); err != nil {
+		discardIncoming(swaps)
+		return errors.Join(err, journal.remove())
+	}
 	for index, swap := range swaps {
 		if err := swap.commit(); err != nil {
 			err = fmt.Errorf("apply generated target %q: %w", swap.relative, err)
 			if rollbackErr := rollbackSwaps(swaps[:index+1]); rollbackErr != nil {
-				err = fmt.Errorf("%w (rollback also failed, displaced originals kept at %q siblings: %v)", err, syncBackupSuffix, rollbackErr)
+				// The journal stays: the next Load or Sync rolls back again.
+				discardIncoming(swaps)
+				return fmt.Errorf("%w (rollback also failed, displaced originals kept at %q siblings: %v)", err, syncBackupSuffix, rollbackErr)
 			}
 			discardIncoming(swaps)
-			return err
+			return errors.Join(err, journal.remove())
 		}
 	}
+	// Past this point the new tree is in place: recovery rolls forward.
+	if err := journal.record(syncPhaseCommitted); err != nil {
+		return err
+	}
 	for _, swap := range swaps {
 		if swap.backup != "" {
 			_ = os.RemoveAll(swap.backup)
 		}
 	}
-	return nil
+	return journal.remove()
 }
 
-func (transaction *syncTransaction) prepareSwaps() ([]*pendingSwap, error) {
+// planSwaps lists the changed targets, noting whether each has an original
+// to displace and a staged replacement.
+func (transaction *syncTransaction) planSwaps() ([]*pendingSwap, error) {
 	var swaps []*pendingSwap
 	for _, target := range transaction.sortedTargets() {
 		changed, err := transaction.targetChanges(target)
 		if err != nil {
-			return swaps, err
+			return nil, err
 		}
 		if len(changed) == 0 {
 			continue
@@ -192,26 +223,45 @@ func (transaction *syncTransaction) prepareSwaps() ([]*pendingSwap, error) {
 			relative: target.relative,
 			actual:   filepath.Join(transaction.actualRoot, target.relative),
 		}
-		swaps = append(swaps, swap)
+		if _, err := os.Lstat(swap.actual); err == nil {
+			swap.original = true
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("stat generated target %q: %w", target.relative, err)
+		}
 		staged := filepath.Join(transaction.stageRoot, target.relative)
-		if _, err := os.Lstat(staged); os.IsNotExist(err) {
-			continue // nothing staged: the swap removes the target
-		} else if err != nil {
-			return swaps, fmt.Errorf("stat staged target %q: %w", target.relative, err)
+		if _, err := os.Lstat(staged); err == nil {
+			swap.incoming = swap.actual + syncIncomingSuffix
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("stat staged target %q: %w", target.relative, err)
 		}
-		incoming := swap.actual + syncIncomingSuffix
-		if err := os.RemoveAll(incoming); err != nil {
-			return swaps, fmt.Errorf("prepare generated target %q: %w", target.relative, err)
+		// Without a staged node the swap removes the target.
+		swaps = append(swaps, swap)
+	}
+	return swaps, nil
+}
+
+// prepareSwaps materializes each replacement beside its target. A stale
+// backup is cleared first, so one present while committing is always this
+// Apply's own.
+func (transaction *syncTransaction) prepareSwaps(swaps []*pendingSwap) error {
+	for _, swap := range swaps {
+		if err := os.RemoveAll(swap.actual + syncBackupSuffix); err != nil {
+			return fmt.Errorf("prepare generated target %q: %w", swap.relative, err)
+		}
+		if swap.incoming == "" {
+			continue
+		}
+		if err := os.RemoveAll(swap.incoming); err != nil {
+			return fmt.Errorf("prepare generated target %q: %w", swap.relative, err)
 		}
 		if err := os.MkdirAll(filepath.Dir(swap.actual), 0o755); err != nil {
-			return swaps, fmt.Errorf("prepare generated target %q: %w", target.relative, err)
+			return fmt.Errorf("prepare generated target %q: %w", swap.relative, err)
 		}
-		swap.incoming = incoming
-		if err := copySyncPath(staged, incoming); err != nil {
-			return swaps, fmt.Errorf("prepare generated target %q: %w", target.relative, err)
+		if err := copySyncPath(filepath.Join(transaction.stageRoot, swap.relative), swap.incoming); err != nil {
+			return fmt.Errorf("prepare generated target %q: %w", swap.relative, err)
 		}
 	}
-	return swaps, nil
+	return nil
 }
 
 // commit moves the original aside and the replacement into place. Both steps
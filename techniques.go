@@ -16,6 +16,7 @@ Editable files (YOUR code):
   pkg/adapters/rpcs.go     — RPC method implementations
   pkg/business/**           — Business logic, domain types, helpers
   proto/api.proto           — gRPC service and message definitions
+  plugins/plugins.yaml      — Active framework.Plugin list (name, import, constructor, config)
 
 Auto-generated files (NEVER edit manually):
   pkg/gen/*.pb.go           — Protobuf message Go code
@@ -26,9 +27,18 @@ Auto-generated files (NEVER edit manually):
   pkg/adapters/rest_gen.go  — REST gateway constructor
   pkg/adapters/server_gen.go— Unified server startup
   pkg/adapters/cors_gen.go  — CORS middleware
+  pkg/adapters/tls_gen.go   — Listener TLS from the service's tls settings
+  pkg/adapters/validate_gen.go — protovalidate interceptors for every request
+  pkg/adapters/accesslog_gen.go — Bounded, redacted request log of the REST and Connect listeners
+  pkg/apierrors/apierrors_gen.go — Error mapping shared by gRPC, REST and Connect
+  plugins/registry_gen.go   — Plugin instantiation, rendered from plugins.yaml during Sync
   go.sum                    — Dependency lock file
 
-If you need to change generated files, modify the source (proto or templates) and regenerate.`,
+If you need to change generated files, modify the source (proto or templates) and regenerate.
+Generated adapter files end with a "// codefly:generated sha256=" stamp. Sync
+reports a file whose content no longer matches its stamp as a conflict and
+leaves it alone, or with scaffold-conflicts: orig regenerates it and keeps the
+edited copy beside it as .orig.`,
 		},
 		{
 			Id:          "go-grpc-proto-flow",
@@ -38,6 +48,9 @@ If you need to change generated files, modify the source (proto or templates) an
 			Prompt: `GO-GRPC PROTO FLOW:
 1. Define your service in proto/api.proto (messages, RPCs, HTTP annotations).
 2. Run codefly to regenerate: proto/api.proto → buf generate → pkg/gen/*.pb.go
+   With hot reload, saving a .proto regenerates, rebuilds and restarts; a
+   generation error is logged with its file:line:column and the running
+   service keeps the previous API until the proto is fixed.
 3. The plugin auto-generates adapter wiring in pkg/adapters/*_gen.go.
 4. YOU implement RPC handlers in pkg/adapters/rpcs.go, calling business logic in pkg/business/.
 
@@ -45,8 +58,17 @@ Adding a new RPC:
   a) Add the rpc definition in proto/api.proto
   b) Add HTTP annotation if REST is enabled
   c) Regenerate (codefly handles this)
-  d) Implement the handler method in pkg/adapters/rpcs.go
-  e) Add domain logic in pkg/business/`,
+  d) Implement the handler method in pkg/adapters/rpcs.go: Sync appends a
+     stub that validates the request and answers Unimplemented, and reports
+     handlers there whose RPC was removed
+  e) Add domain logic in pkg/business/
+
+Breaking changes: Sync compares proto/ with a baseline (the stored
+.codefly/proto-baseline.binpb, else the last commit) and refuses removed or
+renumbered fields, changed types, removed or renamed RPCs and dropped HTTP
+bindings. Run the proto-breaking command to list them; reserve removed field
+numbers instead, or set proto-breaking.allow-breaking when every client moves
+with the change.`,
 		},
 		{
 			Id:          "go-grpc-rpc-authoring",
@@ -69,9 +91,24 @@ Example:
 
 Rules:
 - Return proper gRPC status codes (NotFound, InvalidArgument, Internal, etc.)
+  through pkg/apierrors: apierrors.NotFound("WIDGET_NOT_FOUND", "...") carries
+  ErrorInfo, BadRequest and RetryInfo details, and apierrors.Map gives a
+  business sentinel error its code. REST answers the same error as
+  application/problem+json; services deployed to a production environment
+  (errors.production-environments, "production" by default) redact Internal
+  messages
 - Keep handlers thin — delegate to pkg/business/ for domain logic
 - Use the generated request/response types from pkg/gen/
-- Access injected dependencies through the server struct`,
+- Access injected dependencies through the server struct
+- Handlers need no Validate call: interceptors check every request, streamed
+  messages included, against its protovalidate rules and answer
+  InvalidArgument with the field violations. Set
+  Configuration.ValidateResponses to check responses too
+- On the REST listener a server stream answers newline-delimited JSON, or
+  Server-Sent Events with Accept: text/event-stream
+- Mark secrets in the proto with [debug_redact = true]: the REST and Connect
+  access log replaces their values in logged request bodies. Log through
+  wool.Get(ctx), never by printing requests`,
 		},
 		{
 			Id:          "go-grpc-infra-pattern",
@@ -84,7 +121,24 @@ Infrastructure code lives in pkg/infra/.
 - Wire them into main.go and pass to business logic constructors.
 - main.go is the composition root: it creates infra, creates business, creates adapters, starts server.
 - The server auto-handles health checks, graceful shutdown, and signal handling.
-- Environment variables and service endpoints are injected by codefly at runtime.`,
+  On SIGTERM health turns NOT_SERVING for the shutdown drain-period, then
+  requests in flight get the shutdown timeout; the deployment's grace period
+  covers both. Errors from Configure, Work or a listener exit main non-zero.
+- Environment variables and service endpoints are injected by codefly at runtime.
+- Container ports default to 9090 (gRPC), 8080 (REST) and 8081 (Connect); the
+  ports block of service.codefly.yaml changes them for the Dockerfile, the
+  Deployment and the Service, and must match the environment's network mappings.
+- The Deployment's probes call the gRPC health server (grpc.health.v1), which
+  reports SERVING for the whole server and each proto service. The probes block
+  picks grpc, http (/healthz, needs REST) or tcp, a service name and timing.
+- The deployment block sizes the pods (replicas, resources, autoscaling,
+  disruption budget, topology spread) with per-environment overrides; Deploy
+  validates it and renders the overrides into the environment's overlay.
+- deployment-format: helm makes Deploy write a linted chart (helm/ by default)
+  for the environment it deploys to instead of applying the kustomize
+  manifests. values.yaml carries the built image, the namespace, the
+  environment's workload and the ConfigMap; secrets are secretKeyRefs to
+  secret-<service>, which must exist in the namespace.`,
 		},
 	}
 }
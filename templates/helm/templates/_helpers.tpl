@@ -0,0 +1,51 @@
+{{/*
+The pod selector, shared by the Deployment, the Service, the spread
+constraints and the disruption budget.
+*/}}
+{{- define "service.selector" -}}
+app: {{ .Chart.Name }}
+{{- end }}
+
+{{/*
+The namespace values.yaml deploys to, or the release's.
+*/}}
+{{- define "service.namespace" -}}
+{{ .Values.namespace | default .Release.Namespace }}
+{{- end }}
+
+{{- define "service.labels" -}}
+{{ include "service.selector" . }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+helm.sh/chart: {{ printf "%s-%s" .Chart.Name .Chart.Version }}
+{{- end }}
+
+{{/*
+One probe of .Values.probes, as the kustomize base renders it: grpc calls the
+gRPC health server, http GETs the REST listener's /healthz, tcp only checks
+the gRPC listener accepts connections.
+*/}}
+{{- define "service.probe" -}}
+{{- if eq .root.Values.probes.type "grpc" -}}
+grpc:
+  port: {{ .root.Values.endpoints.grpc.port }}
+{{- with .probe.service }}
+  service: {{ . }}
+{{- end }}
+{{- else if eq .root.Values.probes.type "http" -}}
+httpGet:
+  path: /healthz
+  port: http
+{{- if .root.Values.tls.enabled }}
+  scheme: HTTPS
+{{- end }}
+{{- else -}}
+tcpSocket:
+  port: grpc
+{{- end }}
+{{- with .probe.initialDelaySeconds }}
+initialDelaySeconds: {{ . }}
+{{- end }}
+periodSeconds: {{ .probe.periodSeconds }}
+timeoutSeconds: {{ .probe.timeoutSeconds }}
+failureThreshold: {{ .probe.failureThreshold }}
+{{- end }}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codefly-dev/core/resources"
+)
+
+// TLSSpec serves the gRPC, REST and Connect listeners over TLS, optionally
+// verifying client certificates (mTLS).
+//
+// Cert, Key and CA are PEM files relative to the service root, used when the
+// service runs under codefly. Left empty, the runtime issues a certificate
+// from a development CA it keeps in .cache/tls. Secret names the
+// kubernetes.io/tls secret (tls.crt, tls.key, and ca.crt for client-auth) the
+// deployment mounts instead.
+type TLSSpec struct {
+	Cert   string `yaml:"cert,omitempty"`
+	Key    string `yaml:"key,omitempty"`
+	CA     string `yaml:"ca,omitempty"`
+	Secret string `yaml:"secret,omitempty"`
+	// ClientAuth is none (the default), request (verify a certificate when
+	// the client presents one) or require (mTLS).
+	ClientAuth string `yaml:"client-auth,omitempty"`
+}
+
+// Client-auth modes, as the generated tls_gen.go reads them from
+// CODEFLY_TLS_CLIENT_AUTH.
+const (
+	tlsClientAuthNone    = "none"
+	tlsClientAuthRequest = "request"
+	tlsClientAuthRequire = "require"
+)
+
+// The environment the generated tls_gen.go reads the listeners' TLS files
+// from.
+const (
+	tlsCertFileEnv   = "CODEFLY_TLS_CERT_FILE"
+	tlsKeyFileEnv    = "CODEFLY_TLS_KEY_FILE"
+	tlsCAFileEnv     = "CODEFLY_TLS_CA_FILE"
+	tlsClientAuthEnv = "CODEFLY_TLS_CLIENT_AUTH"
+)
+
+// tlsSecretMount is where the deployment mounts TLSSpec.Secret.
+const tlsSecretMount = "/etc/codefly/tls"
+
+// Validate rejects a tls block that would serve without a key pair or verify
+// clients against nothing.
+func (s *TLSSpec) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if (s.Cert == "") != (s.Key == "") {
+		return fmt.Errorf("tls cert and key must be set together")
+	}
+	for _, file := range []string{s.Cert, s.Key, s.CA} {
+		if file != "" && (!filepath.IsLocal(file) || strings.ContainsAny(file, "\x00\\")) {
+			return fmt.Errorf("tls file %q must stay below the service root", file)
+		}
+	}
+	if s.Secret != "" && (len(s.Secret) > 253 || !dns1123Subdomain.MatchString(s.Secret)) {
+		return fmt.Errorf("tls secret %q must be a DNS-1123 subdomain", s.Secret)
+	}
+	switch s.ClientAuth {
+	case "", tlsClientAuthNone:
+	case tlsClientAuthRequest, tlsClientAuthRequire:
+		// The development CA verifies clients when no certificate is given.
+		if s.Cert != "" && s.CA == "" {
+			return fmt.Errorf("tls client-auth %s requires a ca to verify client certificates", s.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("tls client-auth %q must be none, request or require", s.ClientAuth)
+	}
+	return nil
+}
+
+// clientAuth is the effective client-auth mode.
+func (s *TLSSpec) clientAuth() string {
+	if s.ClientAuth == "" {
+		return tlsClientAuthNone
+	}
+	return s.ClientAuth
+}
+
+// tlsFiles locates the PEM files a running service serves with. CA is empty
+// when clients are expected to trust the certificate through the system roots.
+type tlsFiles struct {
+	Cert       string
+	Key        string
+	CA         string
+	ClientAuth string
+}
+
+// environment is what the generated tls_gen.go reads. Paths are made relative
+// to dir, the process working directory, so they resolve the same way in
+// native and container runners that mount the service tree.
+func (f *tlsFiles) environment(dir string) []*resources.EnvironmentVariable {
+	if f == nil {
+		return nil
+	}
+	envs := []*resources.EnvironmentVariable{
+		resources.Env(tlsCertFileEnv, relativeTo(dir, f.Cert)),
+		resources.Env(tlsKeyFileEnv, relativeTo(dir, f.Key)),
+		resources.Env(tlsClientAuthEnv, f.ClientAuth),
+	}
+	if f.CA != "" {
+		envs = append(envs, resources.Env(tlsCAFileEnv, relativeTo(dir, f.CA)))
+	}
+	return envs
+}
+
+// clientConfig is how the agent's own commands reach the running service:
+// trusting the CA (the system roots without one) and presenting the
+// certificate when the service verifies clients. nil means plaintext.
+func (f *tlsFiles) clientConfig() (*tls.Config, error) {
+	if f == nil {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if f.CA != "" {
+		ca, err := os.ReadFile(f.CA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read tls ca: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in tls ca %s", f.CA)
+		}
+	}
+	if f.ClientAuth != tlsClientAuthNone {
+		pair, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load tls key pair: %w", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
+
+func relativeTo(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		return rel
+	}
+	return file
+}
+
+// resolveTLSFiles returns the files the service runs with under codefly:
+// the declared pair, or one issued by the development CA under cacheDir.
+// It returns nil when the service has no tls block.
+func resolveTLSFiles(spec *TLSSpec, root, cacheDir string) (*tlsFiles, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	if spec.Cert == "" {
+		files, err := ensureDevCertificate(filepath.Join(cacheDir, "tls"), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		files.ClientAuth = spec.clientAuth()
+		return files, nil
+	}
+	files := &tlsFiles{
+		Cert:       filepath.Join(root, spec.Cert),
+		Key:        filepath.Join(root, spec.Key),
+		ClientAuth: spec.clientAuth(),
+	}
+	if spec.CA != "" {
+		files.CA = filepath.Join(root, spec.CA)
+	}
+	if _, err := tls.LoadX509KeyPair(files.Cert, files.Key); err != nil {
+		return nil, fmt.Errorf("cannot load tls key pair: %w", err)
+	}
+	return files, nil
+}
+
+// devCertificateRenewal is how long before expiry the development certificate
+// is reissued.
+const devCertificateRenewal = 7 * 24 * time.Hour
+
+// ensureDevCertificate keeps a development CA (ca.crt, ca.key) and a
+// certificate it issued for localhost (tls.crt, tls.key) in dir. Both are
+// created on first use; the certificate is reissued when it nears expiry or
+// no longer chains to the CA, so trusting ca.crt once keeps working.
+func ensureDevCertificate(dir string, now time.Time) (*tlsFiles, error) {
+	files := &tlsFiles{
+		Cert: filepath.Join(dir, "tls.crt"),
+		Key:  filepath.Join(dir, "tls.key"),
+		CA:   filepath.Join(dir, "ca.crt"),
+	}
+	caKeyFile := filepath.Join(dir, "ca.key")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	ca, caKey, err := loadCertificate(files.CA, caKeyFile)
+	if err != nil || now.Add(devCertificateRenewal).After(ca.NotAfter) {
+		ca, caKey, err = issueCertificate(&x509.Certificate{
+			Subject:               pkix.Name{Organization: []string{"codefly"}, CommonName: "codefly development CA"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.AddDate(10, 0, 0),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, nil, nil, files.CA, caKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create development CA: %w", err)
+		}
+	}
+
+	leaf, _, err := loadCertificate(files.Cert, files.Key)
+	if err == nil && now.Add(devCertificateRenewal).Before(leaf.NotAfter) && leaf.CheckSignatureFrom(ca) == nil {
+		return files, nil
+	}
+	_, _, err = issueCertificate(&x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"codefly"}, CommonName: "localhost"},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(1, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:    []string{"localhost", "host.docker.internal"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback, net.IPv4zero},
+	}, ca, caKey, files.Cert, files.Key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot issue development certificate: %w", err)
+	}
+	return files, nil
+}
+
+func loadCertificate(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not an ECDSA key", keyFile)
+	}
+	certificate, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return certificate, key, nil
+}
+
+// issueCertificate signs template with parent (self-signed when nil) and
+// writes the certificate and its new key as PEM.
+func issueCertificate(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var certPEM, keyPEM bytes.Buffer
+	if err := pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return nil, nil, err
+	}
+	if err := pem.Encode(&keyPEM, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(keyFile, keyPEM.Bytes(), 0o600); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(certFile, certPEM.Bytes(), 0o644); err != nil {
+		return nil, nil, err
+	}
+	return certificate, key, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSSpecValidate(t *testing.T) {
+	tests := map[string]struct {
+		spec TLSSpec
+		want string
+	}{
+		"development CA":       {TLSSpec{}, ""},
+		"development mTLS":     {TLSSpec{ClientAuth: tlsClientAuthRequire}, ""},
+		"declared pair":        {TLSSpec{Cert: "certs/tls.crt", Key: "certs/tls.key", Secret: "api-tls"}, ""},
+		"declared mTLS":        {TLSSpec{Cert: "certs/tls.crt", Key: "certs/tls.key", CA: "certs/ca.crt", ClientAuth: tlsClientAuthRequest}, ""},
+		"cert without key":     {TLSSpec{Cert: "certs/tls.crt"}, "set together"},
+		"key without cert":     {TLSSpec{Key: "certs/tls.key"}, "set together"},
+		"escaping path":        {TLSSpec{Cert: "../tls.crt", Key: "tls.key"}, "below the service root"},
+		"absolute ca":          {TLSSpec{CA: "/etc/ssl/ca.crt"}, "below the service root"},
+		"invalid secret":       {TLSSpec{Secret: "API_TLS"}, "DNS-1123"},
+		"unknown client-auth":  {TLSSpec{ClientAuth: "optional"}, "none, request or require"},
+		"mTLS without a ca":    {TLSSpec{Cert: "tls.crt", Key: "tls.key", ClientAuth: tlsClientAuthRequire}, "requires a ca"},
+		"explicit none no ca":  {TLSSpec{Cert: "tls.crt", Key: "tls.key", ClientAuth: tlsClientAuthNone}, ""},
+		"request without a ca": {TLSSpec{Cert: "tls.crt", Key: "tls.key", ClientAuth: tlsClientAuthRequest}, "requires a ca"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.spec.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, test.want)
+			}
+		})
+	}
+
+	var spec *TLSSpec
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("nil tls block: %v", err)
+	}
+}
+
+func TestEnsureDevCertificateIssuesAndReusesALocalhostCertificate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	now := time.Now()
+	files, err := ensureDevCertificate(dir, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _, err := loadCertificate(files.CA, filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, err := loadCertificate(files.Cert, files.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots, KeyUsages: []x509.ExtKeyUsage{usage}}); err != nil {
+			t.Fatalf("certificate does not verify for %v: %v", usage, err)
+		}
+	}
+	if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Fatalf("certificate does not cover the loopback address: %v", err)
+	}
+	if info, err := os.Stat(files.Key); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	before, err := os.ReadFile(files.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ensureDevCertificate(dir, now); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(files.Cert); string(after) != string(before) {
+		t.Fatal("a valid certificate was reissued")
+	}
+
+	// Near expiry the certificate is reissued from the same CA.
+	if _, err := ensureDevCertificate(dir, leaf.NotAfter.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	renewed, _, err := loadCertificate(files.Cert, files.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.Equal(leaf) || renewed.CheckSignatureFrom(ca) != nil {
+		t.Fatal("an expiring certificate was not reissued from the development CA")
+	}
+}
+
+func TestDeploymentTLSRequiresASecret(t *testing.T) {
+	if got, err := deploymentTLS(nil); got != nil || err != nil {
+		t.Fatalf("deploymentTLS(nil) = %v, %v", got, err)
+	}
+	if _, err := deploymentTLS(&TLSSpec{Cert: "tls.crt", Key: "tls.key"}); err == nil || !strings.Contains(err.Error(), "requires a secret") {
+		t.Fatalf("deploymentTLS() error = %v, want the missing secret", err)
+	}
+	got, err := deploymentTLS(&TLSSpec{Secret: "api-tls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&DeploymentTLS{Secret: "api-tls", MountPath: tlsSecretMount, ClientAuth: tlsClientAuthNone}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("deploymentTLS() = %#v, want %#v", got, want)
+	}
+}